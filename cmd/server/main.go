@@ -1,23 +1,95 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"os"
 
 	"github.com/mmanjoura/race-picks-backend/pkg/api"
+	"github.com/mmanjoura/race-picks-backend/pkg/api/preparation"
+	settings "github.com/mmanjoura/race-picks-backend/pkg/config"
 	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/ingest"
+	"github.com/mmanjoura/race-picks-backend/pkg/jobs"
+	"github.com/mmanjoura/race-picks-backend/pkg/racedata"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+	"github.com/mmanjoura/race-picks-backend/pkg/scheduler"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
 
-	database.ConnectDatabase()
+	// `server migrate` brings the database schema up to date and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		cfg, err := settings.Load(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		migrate(cfg)
+		return
+	}
+
+	cfg, err := settings.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	database.ConnectDatabase(cfg)
 	config := database.Database.Config
 
+	// One writer for the whole process, so concurrent ingests, jobs and
+	// handlers queue their writes instead of fighting over SQLite's lock
+	writer := database.NewWriter(database.Database.DB)
+
+	// Run long scrapes in the background and flag jobs cut short by a restart
+	if _, err := jobs.Start(context.Background(), database.Database.DB, writer); err != nil {
+		log.Fatal(err)
+	}
+
+	repos := repository.New(database.Database.DB, writer)
+	preparationHandler := preparation.NewHandler(repos, racedata.FromConfig(config), cfg.DataDir, ingest.OptionsFromConfig(config))
+
+	// Refresh features saved before the store or its going columns existed;
+	// until then missing ones are read straight from SelectionsForm
+	if jobID, err := preparation.BackfillFeatures(context.Background(), repos); err != nil {
+		log.Println("backfilling features:", err)
+	} else if jobID != 0 {
+		log.Printf("backfilling features in job %d", jobID)
+	}
+
+	// Run the daily ingest pipeline at the times set in Configurations
+	if _, err := scheduler.Start(context.Background(), database.Database.DB, writer, repos, preparationHandler); err != nil {
+		log.Fatal(err)
+	}
+
 	//gin.SetMode(gin.ReleaseMode)
 	gin.SetMode(gin.DebugMode)
-	r := api.InitRouter()
+	r := api.InitRouter(repos, preparationHandler)
 	if err := r.Run(config["PORT"]); err != nil {
 		log.Fatal(err)
 	}
 }
+
+func migrate(cfg settings.Config) {
+	db, err := database.Open(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	applied, err := database.Migrate(db)
+	for _, migration := range applied {
+		fmt.Printf("applied %04d_%s\n", migration.Version, migration.Name)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	version, err := database.SchemaVersion(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("schema is at version %d\n", version)
+}
@@ -0,0 +1,82 @@
+package analysis
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/race-picks-backend/pkg/backtest"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/predict"
+	"github.com/mmanjoura/race-picks-backend/pkg/staking"
+)
+
+// BacktestRequest is the body of /analysis/Backtest. Dates are YYYY-MM-DD;
+// Model, Years, Positions and Ages are as in TodayPredictions. Staking
+// defaults to one unit level stakes.
+type BacktestRequest struct {
+	From         string       `json:"from" binding:"required"`
+	To           string       `json:"to" binding:"required"`
+	Model        string       `json:"model"`
+	ModelVersion string       `json:"model_version"`
+	Commission   float64      `json:"commission"`
+	Details      bool         `json:"details"`
+	Staking      staking.Plan `json:"staking"`
+	Bankroll     float64      `json:"bankroll"`
+	Years        string       `json:"years"`
+	Positions    string       `json:"positions"`
+	Ages         string       `json:"ages"`
+}
+
+// Backtest replays the scoring model over a date range and reports how its
+// top pick in each race would have done.
+func (h *Handler) Backtest(c *gin.Context) {
+	var req BacktestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	from, to, err := dateRange(req.From, req.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.Staking.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	predictor, err := h.registry.Get(c, req.Model, req.ModelVersion)
+	if err != nil {
+		c.JSON(predictorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	engine := backtest.NewEngine(h.repos, backtestScorer(predictor, models.RaceParameters{Years: req.Years, Positions: req.Positions, Ages: req.Ages}))
+	report, err := engine.Run(c, backtest.Options{
+		From:       from,
+		To:         to,
+		Commission: req.Commission,
+		Details:    req.Details,
+		Staking:    req.Staking,
+		Bankroll:   req.Bankroll,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"model": predictor.Name(), "model_version": predictor.Version(), "backtest": report})
+}
+
+// backtestScorer scores a day's runners the way RunTodayPredictions does,
+// with the Years, Positions and Ages filters of filters.
+func backtestScorer(predictor predict.Predictor, filters models.RaceParameters) backtest.Scorer {
+	return func(ctx context.Context, date string, runners []models.Runner, asOf time.Time) ([]models.SelectionResult, error) {
+		raceParams := filters
+		raceParams.EventDate = date
+		return predictor.Predict(ctx, predict.Race{Params: raceParams, AsOf: asOf}, runners)
+	}
+}
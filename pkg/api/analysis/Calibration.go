@@ -0,0 +1,292 @@
+package analysis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/race-picks-backend/pkg/backtest"
+	"github.com/mmanjoura/race-picks-backend/pkg/calibration"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/predict"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+)
+
+// CalibrationRequest is the body of /analysis/Calibrate. Method is
+// temperature (the default) or isotonic; the rest is as in Backtest.
+type CalibrationRequest struct {
+	From         string `json:"from" binding:"required"`
+	To           string `json:"to" binding:"required"`
+	Model        string `json:"model"`
+	ModelVersion string `json:"model_version"`
+	Method       string `json:"method"`
+	Years        string `json:"years"`
+	Positions    string `json:"positions"`
+	Ages         string `json:"ages"`
+}
+
+// ReliabilityRequest is the body of /analysis/Reliability. An empty Model
+// reports on every model that can be loaded.
+type ReliabilityRequest struct {
+	From         string `json:"from" binding:"required"`
+	To           string `json:"to" binding:"required"`
+	Model        string `json:"model"`
+	ModelVersion string `json:"model_version"`
+	Bins         int    `json:"bins"`
+	Years        string `json:"years"`
+	Positions    string `json:"positions"`
+	Ages         string `json:"ages"`
+}
+
+// CalibrationStats compares the log loss of the probabilities served before
+// and after a calibration, on the races it was fitted to.
+type CalibrationStats struct {
+	Races       int     `json:"races"`
+	LossBefore  float64 `json:"log_loss_before"`
+	LossAfter   float64 `json:"log_loss_after"`
+	UniformLoss float64 `json:"uniform_loss"`
+}
+
+// ModelReliability is the reliability report of one model version.
+type ModelReliability struct {
+	Model        string `json:"model"`
+	ModelVersion string `json:"model_version"`
+	Calibration  string `json:"calibration"`
+	calibration.Report
+}
+
+// Calibrate replays a model over settled races and fits the calibrator its
+// scores are turned into win probabilities with from now on.
+func (h *Handler) Calibrate(c *gin.Context) {
+	var req CalibrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Method == "" {
+		req.Method = calibration.Temperature
+	}
+	if req.Method != calibration.Temperature && req.Method != calibration.Isotonic {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "method must be temperature or isotonic"})
+		return
+	}
+
+	from, to, err := dateRange(req.From, req.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	predictor, err := h.registry.Get(c, req.Model, req.ModelVersion)
+	if err != nil {
+		c.JSON(predictorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	filters := models.RaceParameters{Years: req.Years, Positions: req.Positions, Ages: req.Ages}
+	outcomes, err := backtest.NewEngine(h.repos, backtestScorer(predictor, filters)).Races(c, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	races := make([]calibration.Race, len(outcomes))
+	forecasts := outcomeForecasts(outcomes)
+	stats := CalibrationStats{Races: len(outcomes)}
+	for i, outcome := range outcomes {
+		for j, runner := range outcome {
+			races[i].Scores = append(races[i].Scores, runner.TotalScore)
+			if runner.Won {
+				races[i].Winner = j
+			}
+		}
+		stats.UniformLoss += math.Log(float64(len(outcome))) / float64(len(outcomes))
+	}
+
+	calibrator, err := calibration.Fit(req.Method, races)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	stats.LossBefore = calibration.Reliability(forecasts, 1).LogLoss
+	stats.LossAfter = calibrator.LogLoss(races)
+
+	params, err := json.Marshal(calibrator)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	encodedStats, err := json.Marshal(stats)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	saved, err := h.repos.Calibrations.Save(c, predictor.Name(), predictor.Version(), calibrator.Method, params, encodedStats)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"calibration": saved, "calibrator": calibrator, "stats": stats})
+}
+
+// Reliability replays models over settled races and compares the win
+// probabilities they serve with how often the runners won.
+func (h *Handler) Reliability(c *gin.Context) {
+	var req ReliabilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	from, to, err := dateRange(req.From, req.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	names := []string{req.Model}
+	if req.Model == "" {
+		names = h.registry.Names()
+	}
+
+	filters := models.RaceParameters{Years: req.Years, Positions: req.Positions, Ages: req.Ages}
+	reports := []ModelReliability{}
+	for _, name := range names {
+		predictor, err := h.registry.Get(c, name, req.ModelVersion)
+		if err != nil {
+			if req.Model == "" && errors.Is(err, predict.ErrNotTrained) {
+				continue
+			}
+			c.JSON(predictorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		outcomes, err := backtest.NewEngine(h.repos, backtestScorer(predictor, filters)).Races(c, from, to)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		method := "none"
+		if calibrated, ok := predictor.(*calibratedPredictor); ok && calibrated.calibrator != nil {
+			method = calibrated.calibrator.Method
+		}
+		reports = append(reports, ModelReliability{
+			Model:        predictor.Name(),
+			ModelVersion: predictor.Version(),
+			Calibration:  method,
+			Report:       calibration.Reliability(outcomeForecasts(outcomes), req.Bins),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reliability": reports})
+}
+
+// outcomeForecasts pairs the win probability served for each runner with
+// its result.
+func outcomeForecasts(outcomes [][]backtest.Outcome) [][]calibration.Forecast {
+	forecasts := make([][]calibration.Forecast, len(outcomes))
+	for i, outcome := range outcomes {
+		for _, runner := range outcome {
+			forecasts[i] = append(forecasts[i], calibration.Forecast{Probability: runner.WinProbability, Won: runner.Won})
+		}
+	}
+	return forecasts
+}
+
+// calibratedPredictor sets the win probability and fair odds of every
+// result. With no calibrator fitted, probabilities a model makes itself
+// are kept and scores are turned into probabilities by calibration.Default.
+type calibratedPredictor struct {
+	predict.Predictor
+	calibrator *calibration.Calibrator
+}
+
+func (p *calibratedPredictor) Predict(ctx context.Context, race predict.Race, runners []models.Runner) ([]models.SelectionResult, error) {
+	results, err := p.Predictor.Predict(ctx, race, runners)
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[string][]int{}
+	var keys []string
+	for i, result := range results {
+		key := result.EventName + "|" + result.EventTime
+		if _, ok := index[key]; !ok {
+			keys = append(keys, key)
+		}
+		index[key] = append(index[key], i)
+	}
+
+	for _, key := range keys {
+		field := index[key]
+		calibrator := p.calibrator
+		if calibrator == nil {
+			calibrator = calibration.Default
+			for _, i := range field {
+				if results[i].WinProbability > 0 {
+					calibrator = nil
+					break
+				}
+			}
+		}
+
+		if calibrator != nil {
+			scores := make([]float64, len(field))
+			for j, i := range field {
+				scores[j] = results[i].TotalScore
+			}
+			for j, probability := range calibrator.Probabilities(scores) {
+				results[field[j]].WinProbability = probability
+			}
+		}
+		for _, i := range field {
+			results[i].FairDecimalOdds = calibration.FairOdds(results[i].WinProbability)
+		}
+	}
+	return results, nil
+}
+
+// calibrated wraps the models load returns with the calibrator last fitted
+// to their version.
+func calibrated(repos repository.Repositories, load predict.Loader) predict.Loader {
+	return func(ctx context.Context, version string) (predict.Predictor, error) {
+		predictor, err := load(ctx, version)
+		if err != nil {
+			return nil, err
+		}
+
+		saved, ok, err := repos.Calibrations.Latest(ctx, predictor.Name(), predictor.Version())
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return &calibratedPredictor{Predictor: predictor}, nil
+		}
+
+		var calibrator calibration.Calibrator
+		if err := json.Unmarshal(saved.Params, &calibrator); err != nil {
+			return nil, err
+		}
+		return &calibratedPredictor{Predictor: predictor, calibrator: &calibrator}, nil
+	}
+}
+
+// dateRange parses the YYYY-MM-DD bounds of a replay.
+func dateRange(fromDate, toDate string) (from, to time.Time, err error) {
+	if from, err = time.Parse("2006-01-02", fromDate); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if to, err = time.Parse("2006-01-02", toDate); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, errors.New("to is before from")
+	}
+	return from, to, nil
+}
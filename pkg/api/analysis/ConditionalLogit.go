@@ -0,0 +1,170 @@
+package analysis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/race-picks-backend/pkg/api/common"
+	"github.com/mmanjoura/race-picks-backend/pkg/features"
+	"github.com/mmanjoura/race-picks-backend/pkg/jobs"
+	"github.com/mmanjoura/race-picks-backend/pkg/logit"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/predict"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+)
+
+// ConditionalLogitModel names the conditional logit's rows in ModelWeights.
+const ConditionalLogitModel = "conditional_logit"
+
+// ConditionalLogitTrainRequest is the body of /analysis/ConditionalLogitTrain.
+// Only races before Before (YYYY-MM-DD) are used; empty uses every race.
+type ConditionalLogitTrainRequest struct {
+	Before string `json:"before"`
+	logit.Options
+}
+
+// TrainConditionalLogit fits the conditional logit on the stored form in the
+// background and saves the weights as a new version.
+func (h *Handler) TrainConditionalLogit(c *gin.Context) {
+	var req ConditionalLogitTrainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var before time.Time
+	if req.Before != "" {
+		var err error
+		if before, err = common.AsOf(req.Before); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	jobID, err := jobs.Submit(c, "Train:"+ConditionalLogitModel, func(ctx context.Context, progress *jobs.Progress) (interface{}, error) {
+		return TrainConditionalLogit(ctx, h.repos, before, req.Options, progress)
+	})
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job_id": jobID})
+}
+
+// TrainConditionalLogit rebuilds the races run before the cut-off from the
+// form history, fits the conditional logit to their winners and stores the
+// result. Progress counts iterations.
+func TrainConditionalLogit(ctx context.Context, repos repository.Repositories, before time.Time, opts logit.Options, progress *jobs.Progress) (interface{}, error) {
+	history, err := repos.Form.History(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+
+	var races []logit.Race
+	for _, race := range features.Races(features.Samples(history)) {
+		var r logit.Race
+		for i, sample := range race {
+			r.X = append(r.X, sample.X)
+			if sample.Won {
+				r.Winner = i
+			}
+		}
+		races = append(races, r)
+	}
+	if len(races) == 0 {
+		return nil, fmt.Errorf("no races to train on")
+	}
+
+	opts = opts.WithDefaults()
+	progress.SetTotal(opts.Iterations)
+	model, stats, err := logit.Train(features.Names, races, opts, func(int) { progress.Done() })
+	if err != nil {
+		return nil, err
+	}
+
+	weights, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	encodedStats, err := json.Marshal(stats)
+	if err != nil {
+		return nil, err
+	}
+	saved, err := repos.Weights.Save(ctx, ConditionalLogitModel, weights, encodedStats)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"model": saved.Model, "version": saved.Version, "stats": stats}, nil
+}
+
+// conditionalLogitPredictor serves one stored version of the conditional
+// logit. Runners without form are left out and the rest of each race share
+// a win probability of 1.
+type conditionalLogitPredictor struct {
+	version int
+	model   *logit.Model
+	store   *repository.FeatureRepo
+}
+
+func (p *conditionalLogitPredictor) Name() string    { return ConditionalLogitModel }
+func (p *conditionalLogitPredictor) Version() string { return strconv.Itoa(p.version) }
+
+func (p *conditionalLogitPredictor) Predict(ctx context.Context, race predict.Race, runners []models.Runner) ([]models.SelectionResult, error) {
+	var results []models.SelectionResult
+	for _, field := range groupByRace(runners) {
+		var x [][]float64
+		var scored []models.SelectionResult
+		for _, runner := range field {
+			f, _, err := p.store.At(ctx, runner.ID, race.AsOf)
+			if err != nil {
+				return nil, err
+			}
+			row, ok := features.FromSnapshot(f, race.AsOf, runner.TrackCondition)
+			if !ok {
+				continue
+			}
+			x = append(x, features.Select(row, p.model.Features))
+			scored = append(scored, models.SelectionResult{
+				SelectionID:   runner.ID,
+				EventName:     runner.EventName,
+				EventDate:     runner.EventDate,
+				EventTime:     runner.EventTime,
+				SelectionName: runner.Name,
+				Odds:          runner.Odds,
+				AvgPosition:   row[1],
+				AvgRating:     row[2],
+				RunCount:      f.NumRuns,
+			})
+		}
+		if len(scored) == 0 {
+			continue
+		}
+
+		for i, probability := range p.model.Probabilities(x) {
+			scored[i].WinProbability = probability
+			scored[i].TotalScore = probability
+		}
+		results = append(results, scored...)
+	}
+	return predict.Stamp(p, results), nil
+}
+
+// loadConditionalLogitPredictor decodes stored weights and checks the
+// features they were trained on are still computed.
+func loadConditionalLogitPredictor(saved models.ModelWeights, store *repository.FeatureRepo) (predict.Predictor, error) {
+	var model logit.Model
+	if err := json.Unmarshal(saved.Weights, &model); err != nil {
+		return nil, err
+	}
+	if err := features.Check(model.Features); err != nil {
+		return nil, fmt.Errorf("stored conditional logit was trained on %v, retrain it: %v", model.Features, err)
+	}
+	return &conditionalLogitPredictor{version: saved.Version, model: &model, store: store}, nil
+}
@@ -0,0 +1,16 @@
+package analysis
+
+import (
+	"github.com/mmanjoura/race-picks-backend/pkg/predict"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+)
+
+// Handler serves the analysis routes from the repositories it is given.
+type Handler struct {
+	repos    repository.Repositories
+	registry *predict.Registry
+}
+
+func NewHandler(repos repository.Repositories) *Handler {
+	return &Handler{repos: repos, registry: NewRegistry(repos)}
+}
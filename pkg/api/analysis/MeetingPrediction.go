@@ -1,6 +1,7 @@
 package analysis
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"math"
@@ -13,13 +14,17 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/mmanjoura/race-picks-backend/pkg/api/common"
-	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/features"
+	"github.com/mmanjoura/race-picks-backend/pkg/going"
 	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/predict"
+	"github.com/mmanjoura/race-picks-backend/pkg/racing"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
 )
 
-// RacePicksSimulation handles the simulation of race picks and calculates win probabilities.
-func GetMeetingPrediction(c *gin.Context) {
-	db := database.Database.DB
+// GetMeetingPrediction scores the runners of one race with the requested
+// model and returns the top 3.
+func (h *Handler) GetMeetingPrediction(c *gin.Context) {
 	var raceParams models.RaceParameters
 
 	// Bind JSON input to optimalParams
@@ -28,158 +33,59 @@ func GetMeetingPrediction(c *gin.Context) {
 		return
 	}
 
-	// Query for today's runners
-	rows, err := db.Query(`
-		SELECT selection_id,
-			selection_name,
-			event_name,
-			event_date,
-			event_time,
-			price,
-			race_distance,
-			race_category,
-			track_condition,
-			number_of_runners,
-			race_track,
-			race_class
-		FROM EventRunners
-		WHERE DATE(event_date) = ?  AND event_name = ? AND event_time = ?`,
-		raceParams.EventDate, raceParams.EventName, raceParams.EventTime)
-
+	asOf, err := common.AsOf(raceParams.EventDate)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
-
-	var selections []common.Selection
-	for rows.Next() {
-		var selection common.Selection
-
-		// Use sql.NullString for nullable fields
-		var selectionName, eventName, eventDate, eventTime, raceDistance, raceCategory, trackCondition, numberOfRunners, raceTrack, raceClass, odds sql.NullString
-
-		// Scan the row values into the nullable types
-		if err := rows.Scan(
-			&selection.ID,
-			&selectionName,
-			&eventName,
-			&eventDate,
-			&eventTime,
-			&odds,
-			&raceDistance,
-			&raceCategory,
-			&trackCondition,
-			&numberOfRunners,
-			&raceTrack,
-			&raceClass,
-		); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		// Convert sql.NullString to regular strings
-		selection.Name = nullableToString(selectionName)
-		selection.EventName = nullableToString(eventName)
-		selection.EventDate = nullableToString(eventDate)
-		selection.EventTime = nullableToString(eventTime)
-		selection.RaceDistance = nullableToString(raceDistance)
-		selection.RaceCategory = nullableToString(raceCategory)
-		selection.TrackCondition = nullableToString(trackCondition)
-		selection.NumberOfRunners = nullableToString(numberOfRunners)
-		selection.RaceTrack = nullableToString(raceTrack)
-		selection.RaceClass = nullableToString(raceClass)
 
-		// Convert sql.NullFloat64 to float64 or set to a default value
-		selection.Odds = nullableToString(odds)
+	predictor, err := h.registry.Get(c, raceParams.Model, raceParams.ModelVersion)
+	if err != nil {
+		c.JSON(predictorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
 
-		// Append the selection to the list
-		selections = append(selections, selection)
+	selections, err := h.repos.Runners.ByRace(c, raceParams.EventDate, raceParams.EventName, raceParams.EventTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	// Get the selection with the least number of runs
-	selectionCount, err := getSelectionWithLeastRuns(db, raceParams.EventName, raceParams.EventTime, raceParams.EventDate)
+	sortedResults, err := predictor.Predict(c, predict.Race{Params: raceParams, AsOf: asOf}, selections)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// var selectonsForm []models.SelectionForm
-	var analysisData []models.AnalysisData
+	top3HighestScores := getTop3ScoresByTime(sortedResults)
+
+	c.JSON(http.StatusOK, gin.H{"simulationResults": top3HighestScores})
+}
 
+// scoreSelections scores each selection against its form before asOf,
+// skipping horses with no form or excluded by raceParams, and returns the
+// results sorted by event name.
+func scoreSelections(ctx context.Context, form *repository.FormRepo, selections []common.Selection, raceParams models.RaceParameters, weights models.ScoringWeights, asOf time.Time) ([]models.SelectionResult, error) {
+	// Get the number of runs of the least experienced runner
+	leastRuns := math.MaxInt
+	runs, ok, err := form.LeastRuns(ctx, raceParams.EventName, raceParams.EventTime, raceParams.EventDate, asOf)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		leastRuns = runs
+	}
+
+	var analysisData []models.AnalysisData
 	for _, selection := range selections {
-		// Execute the query
-		rows, err = db.Query(`
-			SELECT
-				COALESCE(selection_id, 0),
-				selection_name,	
-				substr(position, 1, 1) as positon, 
-				Age,
-				Trainer,
-				Sex,
-				Sire,
-				Dam,
-				Owner,	
-				race_class,					
-				COUNT(*) AS num_runs,
-				MAX(race_date) AS last_run_date,
-				MAX(race_date) - MIN(race_date) AS duration,
-				COUNT(CASE WHEN position = '1' THEN 1 END) AS win_count,
-				AVG(position) AS avg_position,
-				AVG(rating) AS avg_rating,
-				AVG(distance) AS avg_distance_furlongs,
-				AVG(sp_odds) AS sp_odds,
-				GROUP_CONCAT(position, ', ') AS all_positions,
-				GROUP_CONCAT(distance, ', ') AS all_distances,
-				GROUP_CONCAT(racecourse, ', ') AS all_racecources,
-				GROUP_CONCAT(DATE(race_date), ', ') AS all_race_dates 
-			FROM
-				SelectionsForm	WHERE selection_id = ?  order by race_date desc`, selection.ID)
+		data, err := form.Summary(ctx, selection.ID, asOf)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		defer rows.Close()
-
-		var data models.AnalysisData
-
-		for rows.Next() {
-			err := rows.Scan(
-				&data.SelectionID,
-				&data.SelectionName,
-				&data.Position,
-				&data.Age,
-				&data.Trainer,
-				&data.Sex,
-				&data.Sire,
-				&data.Dam,
-				&data.Owner,
-				&data.EventClass,
-				&data.NumRuns,
-				&data.LastRunDate,
-				&data.Duration,
-				&data.WinCount,
-				&data.AvgPosition,
-				&data.AvgRating,
-				&data.AvgDistanceFurlongs,
-				&data.AvgOdds,
-				&data.AllPositions,
-				&data.AllDistances,
-				&data.AllCources,
-				&data.AllRaceDates,
-			)
-			if err != nil {
-				continue
-			}
-		}
-
-		if selection.ID == 1154889 {
-			fmt.Println("Selection ID: ", selection.ID)
+			return nil, err
 		}
 
 		// Ignore selections with given parameters
-		if yearExistsInDates(raceParams.Years, strings.Split(data.AllRaceDates, ",")) ||
-			positionExistsInArray(raceParams.Positions, strings.Split(data.AllPositions, ",")) ||
+		if yearExistsInDates(raceParams.Years, data.Features.RaceDates) ||
+			positionExistsInArray(raceParams.Positions, data.Features.Positions) ||
 			ageExistsInString(raceParams.Ages, data.Age) {
 
 			continue
@@ -191,13 +97,11 @@ func GetMeetingPrediction(c *gin.Context) {
 		}
 	}
 
-	mapResult := make(map[int]models.SelectionResult)
 	var sortedResults []models.SelectionResult
 
 	result := models.SelectionResult{}
 	selectionsIds := []int{}
 
-	leastRuns := selectionCount[0].NumberOfRuns
 	for _, data := range analysisData {
 		if data.NumRuns < leastRuns {
 			leastRuns = data.NumRuns
@@ -210,15 +114,16 @@ func GetMeetingPrediction(c *gin.Context) {
 
 	for id, selecion := range newSelections {
 
-
-	
 		if selecion.ID == analysisData[id].SelectionID {
-			foatDistance := common.ParseDistance(selecion.RaceDistance)
+			foatDistance := racing.ParseDistance(selecion.RaceDistance)
 			analysisData[id].CurrentDistance = foatDistance
+			analysisData[id].CurrentCourse = features.RaceCourse(selecion)
+			analysisData[id].GoingForm = going.Form(analysisData[id].Features, selecion.TrackCondition)
 
-			averagePostion := calculateAveragePosition(analysisData[id].AllPositions, leastRuns)
-			analysisData[id].AvgPosition = averagePostion
-			totalScore := ScoreSelection(analysisData[id], raceParams, leastRuns)
+			averagePostion := calculateAveragePosition(analysisData[id].Features.Positions, leastRuns)
+			totalScore := ScoreSelection(analysisData[id], weights, leastRuns)
+			result.EventDate = selecion.EventDate
+			result.SelectionID = selecion.ID
 			result.EventName = selecion.EventName
 			result.EventTime = selecion.EventTime
 			result.SelectionName = selecion.Name
@@ -229,7 +134,6 @@ func GetMeetingPrediction(c *gin.Context) {
 			result.TotalScore = totalScore
 			result.Age = analysisData[id].Age
 			result.RunCount = analysisData[id].NumRuns
-			mapResult[selecion.ID] = result
 
 			sortedResults = append(sortedResults, result)
 		}
@@ -241,9 +145,7 @@ func GetMeetingPrediction(c *gin.Context) {
 		return sortedResults[i].EventName > sortedResults[j].EventName
 	})
 
-	top3HighestScores := getTop3ScoresByTime(sortedResults)
-
-	c.JSON(http.StatusOK, gin.H{"simulationResults": top3HighestScores})
+	return sortedResults, nil
 }
 
 func filterSelectionsByID(selections []common.Selection, ids []int) []common.Selection {
@@ -476,50 +378,62 @@ func stringInSlice(target string, slice []string) bool {
 	return false
 }
 
-// Scoring Function
-func ScoreSelection(selection models.AnalysisData, params models.RaceParameters, limit int) float64 {
+// ScoreSelection scores a runner's last limit runs with weights.
+func ScoreSelection(selection models.AnalysisData, weights models.ScoringWeights, limit int) float64 {
 	var score float64
 
 
 	// Scoring based on number of runs
-	if selection.NumRuns < 20 {
-		score += 2
+	if selection.NumRuns < weights.FewRuns {
+		score += weights.FewRunsBonus
 	}
 
 
 	// Distance Analysis
-	distances := strings.Split(selection.AllDistances, ",")
+	distances := selection.Features.Distances
 	if len(distances) > limit {
 		distances = distances[:limit]
 	}
 
-	var totalDistance float64
+	var totalDistance, avgDistance float64
 	for _, distance := range distances {
-		distance = strings.TrimSpace(distance)
-		convertedDistance := convertDistance(distance)
-		fd, err := strconv.ParseFloat(convertedDistance, 64)
-		if err != nil {
-			continue
-		}
-		totalDistance += fd
+		totalDistance += distance
+	}
+	if len(distances) > 0 {
+		avgDistance = totalDistance / float64(len(distances))
 	}
-
-	avgDistance := totalDistance / float64(len(distances))
 
 	// Distance and Age-Based Scoring
 	distanceDiff := math.Abs(avgDistance - selection.CurrentDistance)
 	switch {
-	case avgDistance <= 12:
+	case avgDistance <= weights.DistanceSplit:
 
-		score += calculateDistanceScore(distanceDiff, []float64{0.5, 1.0, 1.5}, []float64{30, 15, 10, 8, 5})
+		score += calculateDistanceScore(distanceDiff, weights.ShortDistanceThresholds, weights.DistanceScores)
 	default:
 	
-		score += calculateDistanceScore(distanceDiff, []float64{1.5, 2.0, 3.5}, []float64{30, 15, 10, 8, 5})
+		score += calculateDistanceScore(distanceDiff, weights.LongDistanceThresholds, weights.DistanceScores)
 	}
 
 	// Position Analysis
-	positions := strings.Split(selection.AllPositions, ",")
-	score += calculatePositionScore(positions, limit)
+	score += calculatePositionScore(selection.Features.Positions, limit, weights)
+
+	// Going Analysis
+	if record := selection.GoingForm.Record; record.Runs > 0 && record.Runs >= weights.GoingMinRuns {
+		score += weights.GoingScore * record.Relative
+	}
+
+	// Course and Distance Analysis
+	cd := features.CourseDistance(selection.Features, selection.CurrentCourse, selection.CurrentDistance, weights.DistanceTolerance)
+	if cd.CourseWinner {
+		score += weights.CourseWinnerScore
+	}
+	if cd.DistanceWinner {
+		score += weights.DistanceWinnerScore
+	}
+	if cd.CourseDistanceWinner {
+		score += weights.CourseDistanceWinnerScore
+	}
+	score += weights.CourseStrikeRateScore*cd.CourseStrikeRate + weights.DistanceStrikeRateScore*cd.DistanceStrikeRate
 
 	return score
 }
@@ -680,10 +594,7 @@ func getTop3ScoresByTime(sortedResults []models.SelectionResult) map[string][]mo
 	return groupedResults
 }
 
-func calculateAveragePosition(positionsString string, n int) float64 {
-	// Split the input string into an array of positions
-	positionsArray := strings.Split(positionsString, ", ")
-
+func calculateAveragePosition(positionsArray []string, n int) float64 {
 	// Check if n is greater than the length of the positions array
 	if n > len(positionsArray) {
 		n = len(positionsArray)
@@ -757,7 +668,7 @@ func calculateDistanceScore(distanceDiff float64, thresholds, scores []float64)
 }
 
 // Calculate Position Score
-func calculatePositionScore(positions []string, limit int) float64 {
+func calculatePositionScore(positions []string, limit int, weights models.ScoringWeights) float64 {
 	var score float64
 	if len(positions) > limit {
 		positions = positions[:limit]
@@ -765,8 +676,11 @@ func calculatePositionScore(positions []string, limit int) float64 {
 
 	for _, pos := range positions {
 		pos = strings.TrimSpace(pos)
-		if strings.Contains(pos, "F") || strings.Contains(pos, "PU") || strings.Contains(pos, "U") || strings.Contains(pos, "R") {
-			score -= 5
+		for _, code := range weights.NonFinishCodes {
+			if strings.Contains(pos, code) {
+				score -= weights.NonFinishPenalty
+				break
+			}
 		}
 		if strings.Contains(pos, "/") {
 			p := strings.Split(pos, "/")
@@ -776,10 +690,10 @@ func calculatePositionScore(positions []string, limit int) float64 {
 			numerator, err1 := strconv.Atoi(strings.TrimSpace(p[0]))
 			denominator, err2 := strconv.Atoi(strings.TrimSpace(p[1]))
 			if err1 != nil || err2 != nil || denominator == 0 {
-				score -= 1
+				score -= weights.UnreadablePositionPenalty
 				continue
 			}
-			score += math.Round(safeDivide(float64(denominator), float64(numerator))) * 10
+			score += math.Round(safeDivide(float64(denominator), float64(numerator))) * weights.PositionMultiplier
 		}
 	}
 	return score
@@ -1,220 +1,237 @@
 package analysis
 
-// import (
-// 	"database/sql"
-// 	"fmt"
-// 	"math/rand"
-// 	"net/http"
-// 	"sort"
-// 	"strconv"
-// 	"strings"
-// 	"time"
-
-// 	"github.com/gin-gonic/gin"
-// 	"github.com/mmanjoura/race-picks-backend/pkg/api/common"
-// 	"github.com/mmanjoura/race-picks-backend/pkg/database"
-// )
-
-// type SimulationResult struct {
-// 	SelectionID    int   `json:"selection_id"`
-// 	SelectionName  string  `json:"selection_name"`
-// 	EventName      string  `json:"event_name"`
-// 	EventDate      string  `json:"event_date"`
-// 	EventTime      string  `json:"event_time"`
-// 	Odds           string  `json:"odds"`
-// 	WinProbability float64 `json:"win_probability"`
-// }
-
-// func MonteCarloSimulation(c *gin.Context) {
-// 	db := database.Database.DB
-// 	var modelparams common.Selection
-
-// 	if err := c.ShouldBindJSON(&modelparams); err != nil {
-// 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-// 		return
-// 	}
-
-// 	// Get today's runners for the given event_name and event_date
-// 	rows, err := db.Query(`
-// 		SELECT selection_id, 
-// 			   selection_name,
-// 			   event_date,
-// 			   event_name,
-// 			   event_time,
-// 			   price
-	
-// 		FROM EventRunners	 
-// 		WHERE event_name = ? AND DATE(event_date) = ? AND event_time = ?`,
-// 		modelparams.EventName, modelparams.EventDate, modelparams.EventTime)
-// 	if err != nil {
-// 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-// 		return
-// 	}
-// 	defer rows.Close()
-
-// 	var selections []common.Selection
-// 	for rows.Next() {
-// 		var selection common.Selection
-// 		if err := rows.Scan(&selection.ID, &selection.Name, selection.EventDate, &selection.EventName, &selection.EventTime, &selection.Odds); err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-// 			return
-// 		}
-// 		selections = append(selections, selection)
-// 	}
-
-// 	// Create a new random generator with a seed
-// 	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-
-// 	// Number of simulations
-// 	const numSimulations = 10000
-
-// 	// Simulate the race multiple times
-// 	results := make(map[int64]int)
-// 	for i := 0; i < numSimulations; i++ {
-// 		winner := simulateRace(selections, db, rng, modelparams.Distance)
-// 		results[winner]++
-// 	}
-
-// 	// Calculate win probabilities
-// 	var simulationResults []SimulationResult
-// 	for _, selection := range selections {
-// 		winCount := results[selection.ID]
-// 		winProbability := float64(winCount) / float64(numSimulations)
-// 		simulationResults = append(simulationResults, SimulationResult{
-// 			SelectionID:    selection.ID,
-// 			SelectionName:  selection.Name,
-// 			EventName:      selection.EventName,
-// 			EventDate:      selection.EventDate,
-// 			EventTime:      selection.EventTime,
-// 			Odds:           selection.Odds,
-// 			WinProbability: winProbability,
-// 		})
-// 	}
-
-// 	sort.SliceStable(simulationResults, func(i, j int) bool {
-// 		return simulationResults[i].WinProbability > simulationResults[j].WinProbability
-// 	})
-
-// 	// Sort results by win probability (optional)
-
-// 	c.JSON(http.StatusOK, gin.H{"data": simulationResults})
-// }
-
-// func simulateRace(selections []common.Selection, db *sql.DB, rng *rand.Rand, eventDistance string) int64 {
-// 	// Define probabilities for each selection based on historical data
-// 	probabilities := make(map[int64]float64)
-
-// 	for _, selection := range selections {
-// 		probability := calculateProbability(selection.ID, eventDistance, db)
-// 		probabilities[selection.ID] = probability
-// 	}
-
-// 	// Randomly pick a winner based on the calculated probabilities
-// 	totalProb := 0.0
-// 	for _, prob := range probabilities {
-// 		totalProb += prob
-// 	}
-// 	threshold := rng.Float64() * totalProb
-// 	cumulative := 0.0
-// 	for id, prob := range probabilities {
-// 		cumulative += prob
-// 		if threshold <= cumulative {
-// 			return id
-// 		}
-// 	}
-
-// 	// Fallback: return the last one if something went wrong
-// 	return selections[len(selections)-1].ID
-// }
-
-// func calculateProbability(selectionID int64, distance string, db *sql.DB) float64 {
-// 	// Query historical data for this selection, including all parameters
-// 	rows, err := db.Query(`
-// 		SELECT 
-// 			COUNT(*) AS count, 
-// 			Age,
-// 			Trainer,
-// 			Sex,
-// 			Sire,
-// 			Dam,
-// 			Owner,
-// 			position, 
-// 			rating, 
-// 			distance, 
-// 			sp_odds,
-// 			AVG(recovery_days) AS avg_recovery_days,
-// 			AVG(num_runs) AS avg_num_runs,
-// 			AVG(years_running) AS avg_years_running,
-// 			AVG(win_count) AS avg_win_count,
-// 			AVG(avg_position) AS avg_avg_position,
-// 			AVG(avg_distance_furlongs) AS avg_avg_distance_furlongs
-// 		FROM SelectionsForm
-// 		WHERE selection_id = ?
-// 		GROUP BY selection_id, position, rating, distance, sp_odds
-// 	`, selectionID)
-// 	if err != nil {
-// 		fmt.Println("Error querying historical data:", err)
-// 		return 0.0
-// 	}
-// 	defer rows.Close()
-
-// 	var totalRuns int
-// 	var totalScore float64
-
-// 	for rows.Next() {
-// 		var positionStr, distanceStr string
-// 		var rating, count int
-// 		var odds float64
-// 		var avgRecoveryDays, avgNumRuns, avgYearsRunning, avgWinCount, avgAvgPosition, avgAvgDistanceFurlongs float64
-		
-
-// 		if err := rows.Scan(
-// 			&count,
-// 			&positionStr,
-// 			&rating,
-// 			&distanceStr,
-// 			&odds,
-// 			&avgRecoveryDays,
-// 			&avgNumRuns,
-// 			&avgYearsRunning,
-// 			&avgWinCount,
-// 			&avgAvgPosition,
-// 			&avgAvgDistanceFurlongs); err != nil {
-// 			fmt.Println("Error scanning historical data:", err)
-// 			continue
-// 		}
-
-// 		// Parse the position string (e.g., "3/11" -> 3)
-// 		positionParts := strings.Split(positionStr, "/")
-// 		if len(positionParts) > 0 {
-// 			// Check if the position is a numeric value
-// 			position, err := strconv.Atoi(positionParts[0])
-// 			if err != nil {
-// 				fmt.Println("Non-numeric position encountered, skipping:", positionParts[0])
-// 				continue
-// 			}
-// 			totalRuns++
-// 			// Invert position to score (lower position = higher score)
-// 			totalScore += 1 / float64(position)
-// 		}
-
-// 		// Factor in other parameters to adjust the score
-// 		// You can adjust the weight of each parameter according to its significance
-// 		totalScore *= (avgRecoveryDays + avgNumRuns + avgYearsRunning + avgWinCount + avgAvgPosition + avgAvgDistanceFurlongs)
-
-// 		// Compare distances (use a scaling factor based on distance difference)
-// 		historicalDistance := common.ParseDistance(distanceStr)
-// 		currentDistance := common.ParseDistance(distance)
-
-// 		// Weight by how close the historical distance is to the current distance
-// 		distanceWeight := 1.0 / (1.0 + float64(common.Abs(historicalDistance-currentDistance))/1000.0)
-// 		totalScore *= distanceWeight
-// 	}
-
-// 	if totalRuns == 0 {
-// 		return 0.0
-// 	}
-
-// 	// Normalize the score to be used as a probability
-// 	return totalScore / float64(totalRuns)
-// }
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/race-picks-backend/pkg/api/common"
+	"github.com/mmanjoura/race-picks-backend/pkg/backtest"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+const (
+	defaultSimulations = 10000
+	maxSimulations     = 1000000
+	defaultSeed        = 1
+)
+
+// MonteCarloRequest is the body of /analysis/MonteCarloSimulation. The same
+// seed and settings always give the same distributions. Temperature scales
+// TotalScore into log-strength; 0 uses the spread of the field's scores.
+// ScoringProfile is the ID of the scoring profile the runners are scored
+// with; empty uses the active one.
+type MonteCarloRequest struct {
+	EventName      string  `json:"event_name" binding:"required"`
+	EventDate      string  `json:"event_date" binding:"required"`
+	EventTime      string  `json:"event_time" binding:"required"`
+	Simulations    int     `json:"simulations"`
+	Seed           int64   `json:"seed"`
+	Temperature    float64 `json:"temperature"`
+	ScoringProfile string  `json:"scoring_profile"`
+}
+
+// SimulationResult is one runner's share of the simulated finishing orders.
+// PositionProbabilities[i] is the chance of finishing in position i+1.
+type SimulationResult struct {
+	SelectionID           int       `json:"selection_id"`
+	SelectionName         string    `json:"selection_name"`
+	EventName             string    `json:"event_name"`
+	EventDate             string    `json:"event_date"`
+	EventTime             string    `json:"event_time"`
+	Odds                  string    `json:"odds"`
+	TotalScore            float64   `json:"total_score"`
+	HasForm               bool      `json:"has_form"`
+	WinProbability        float64   `json:"win_probability"`
+	PlaceProbability      float64   `json:"place_probability"`
+	ExpectedPosition      float64   `json:"expected_position"`
+	PositionProbabilities []float64 `json:"position_probabilities"`
+}
+
+// MonteCarloSimulation simulates the full finishing order of one race many
+// times and returns each runner's win, place and position distribution.
+func (h *Handler) MonteCarloSimulation(c *gin.Context) {
+	var req MonteCarloRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Simulations == 0 {
+		req.Simulations = defaultSimulations
+	}
+	if req.Simulations < 0 || req.Simulations > maxSimulations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("simulations must be between 1 and %d", maxSimulations)})
+		return
+	}
+	if req.Seed == 0 {
+		req.Seed = defaultSeed
+	}
+	if req.Temperature < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "temperature must not be negative"})
+		return
+	}
+
+	asOf, err := common.AsOf(req.EventDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	runners, err := h.repos.Runners.ByRace(c, req.EventDate, req.EventName, req.EventTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(runners) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no runners found for this race"})
+		return
+	}
+
+	heuristic, err := loadHeuristic(c, h.repos, HeuristicModel, req.ScoringProfile)
+	if err != nil {
+		c.JSON(predictorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	raceParams := models.RaceParameters{EventName: req.EventName, EventDate: req.EventDate, EventTime: req.EventTime}
+	scored, err := scoreSelections(c, h.repos.Form, runners, raceParams, heuristic.weights, asOf)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := simulateRace(runners, scored, req.Simulations, req.Seed, req.Temperature)
+
+	c.JSON(http.StatusOK, gin.H{
+		"simulations": req.Simulations,
+		"seed":        req.Seed,
+		"places":      backtest.PlacePositions(len(results)),
+		"data":        results,
+	})
+}
+
+// simulateRace draws n finishing orders of the runners. Each runner's
+// log-strength is its TotalScore over the temperature; runners without
+// form get the field's lowest score. Orders are drawn from the
+// Plackett-Luce model by ranking log-strength plus Gumbel noise.
+func simulateRace(runners []models.Runner, scored []models.SelectionResult, n int, seed int64, temperature float64) []SimulationResult {
+	scores := map[int]float64{}
+	for _, result := range scored {
+		scores[result.SelectionID] = result.TotalScore
+	}
+
+	// Fix the order the runners are drawn in so a seed always replays the same race
+	runners = append([]models.Runner(nil), runners...)
+	sort.Slice(runners, func(i, j int) bool { return runners[i].ID < runners[j].ID })
+
+	results := make([]SimulationResult, len(runners))
+	var known []float64
+	for i, runner := range runners {
+		score, ok := scores[runner.ID]
+		results[i] = SimulationResult{
+			SelectionID:           runner.ID,
+			SelectionName:         runner.Name,
+			EventName:             runner.EventName,
+			EventDate:             runner.EventDate,
+			EventTime:             runner.EventTime,
+			Odds:                  runner.Odds,
+			TotalScore:            score,
+			HasForm:               ok,
+			PositionProbabilities: make([]float64, len(runners)),
+		}
+		if ok {
+			known = append(known, score)
+		}
+	}
+
+	floor := 0.0
+	if len(known) > 0 {
+		floor = known[0]
+		for _, score := range known {
+			floor = math.Min(floor, score)
+		}
+	}
+	for i := range results {
+		if !results[i].HasForm {
+			results[i].TotalScore = floor
+		}
+	}
+
+	if temperature == 0 {
+		temperature = scoreSpread(results)
+	}
+
+	strengths := make([]float64, len(results))
+	for i, result := range results {
+		strengths[i] = result.TotalScore / temperature
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	places := backtest.PlacePositions(len(results))
+	counts := make([][]int, len(results))
+	for i := range counts {
+		counts[i] = make([]int, len(results))
+	}
+	order := make([]int, len(results))
+	keys := make([]float64, len(results))
+
+	for sim := 0; sim < n; sim++ {
+		for i, strength := range strengths {
+			order[i] = i
+			keys[i] = strength + gumbel(rng)
+		}
+		sort.Slice(order, func(a, b int) bool { return keys[order[a]] > keys[order[b]] })
+		for position, i := range order {
+			counts[i][position]++
+		}
+	}
+
+	for i := range results {
+		for position, count := range counts[i] {
+			p := float64(count) / float64(n)
+			results[i].PositionProbabilities[position] = p
+			results[i].ExpectedPosition += float64(position+1) * p
+			if position < places {
+				results[i].PlaceProbability += p
+			}
+		}
+		results[i].WinProbability = results[i].PositionProbabilities[0]
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].WinProbability > results[j].WinProbability
+	})
+	return results
+}
+
+// scoreSpread returns the standard deviation of the field's scores, or 1
+// when they are all equal.
+func scoreSpread(results []SimulationResult) float64 {
+	var mean float64
+	for _, result := range results {
+		mean += result.TotalScore
+	}
+	mean /= float64(len(results))
+
+	var variance float64
+	for _, result := range results {
+		variance += (result.TotalScore - mean) * (result.TotalScore - mean)
+	}
+	spread := math.Sqrt(variance / float64(len(results)))
+	if spread == 0 {
+		return 1
+	}
+	return spread
+}
+
+// gumbel draws from the standard Gumbel distribution.
+func gumbel(rng *rand.Rand) float64 {
+	u := rng.Float64()
+	for u == 0 {
+		u = rng.Float64()
+	}
+	return -math.Log(-math.Log(u))
+}
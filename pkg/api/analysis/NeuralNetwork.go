@@ -1,132 +1,236 @@
-// // Explanation
-// // Data Preparation:
-
-// // Retrieve the relevant selections from the database.
-// // Format the data into JSON suitable for the neural network service. This typically involves normalizing or transforming features as needed by the model.
-// // External Neural Network Service:
-
-// // Send a POST request to the neural network service with the prepared data.
-// // Adjust the URL (http://localhost:5000/predict_nn) as necessary based on where your neural network model is served.
-// // Processing Predictions:
-
-// // Receive predictions from the neural network service and map these to the corresponding selections.
-// // Determine if a selection is predicted to win based on a threshold (e.g., 0.5 for binary classification).
-// // Sort results by win probability and return them in the JSON response.
-// // Helper Functions:
-
-// // parseDistance: Convert distance strings to numeric values. Implement this based on your specific distance format.
-// // parseOdds: Convert odds from fractional to decimal format. Modify this function according to your odds format.
-
 package analysis
 
-// import (
-// 	"bytes"
-// 	"encoding/json"
-// 	"net/http"
-// 	"sort"
-// 	"github.com/gin-gonic/gin"
-// 	"github.com/mmanjoura/race-picks-backend/pkg/api/common"
-// 	"github.com/mmanjoura/race-picks-backend/pkg/database"
-// )
-
-
-// type NeuralNetworkPrediction struct {
-// 	SelectionID    int64   `json:"selection_id"`
-// 	SelectionName  string  `json:"selection_name"`
-// 	EventName      string  `json:"event_name"`
-// 	EventTime      string  `json:"event_time"`
-// 	PredictedWin   bool    `json:"predicted_win"`
-// 	WinProbability float64 `json:"win_probability"`
-// }
-
-// func NeuralNetwork_Prediction(c *gin.Context) {
-// 	db := database.Database.DB
-// 	var modelparams common.Selection
-
-// 	if err := c.ShouldBindJSON(&modelparams); err != nil {
-// 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-// 		return
-// 	}
-
-// 	// Get today's runners for the given event_name and event_date
-// 	rows, err := db.Query(`
-// 		SELECT selection_id, 
-// 			   selection_name,
-// 			   event_name,
-// 			   event_time,
-// 			   distance,
-// 			   odds
-// 		FROM EventRunners
-// 		WHERE event_name = ? AND DATE(event_date) = DATE('now') AND event_time = ?`,
-// 		modelparams.EventName, modelparams.EventTime)
-// 	if err != nil {
-// 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-// 		return
-// 	}
-// 	defer rows.Close()
-
-// 	var selections []common.Selection
-// 	for rows.Next() {
-// 		var selection common.Selection
-// 		if err := rows.Scan(&selection.ID, &selection.Name, &selection.EventName, &selection.EventTime, &selection.Distance, &selection.Odds); err != nil {
-// 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-// 			return
-// 		}
-// 		selections = append(selections, selection)
-// 	}
-
-// 	// Prepare data for external Neural Network service
-// 	neuralNetData := make([]map[string]interface{}, len(selections))
-// 	for i, selection := range selections {
-// 		neuralNetData[i] = map[string]interface{}{
-// 			"selection_id": selection.ID,
-// 			"distance":     common.ParseDistance(selection.Distance),
-// 			"odds":         common.ParseOdds(selection.Odds),
-// 		}
-// 	}
-
-// 	// Send data to Neural Network prediction service
-// 	nnURL := "http://localhost:5000/predict_nn"
-// 	data, err := json.Marshal(neuralNetData)
-// 	if err != nil {
-// 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-// 		return
-// 	}
-
-// 	resp, err := http.Post(nnURL, "application/json", bytes.NewBuffer(data))
-// 	if err != nil {
-// 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-// 		return
-// 	}
-// 	defer resp.Body.Close()
-
-// 	var predictions []struct {
-// 		Probability float64 `json:"probability"`
-// 	}
-// 	if err := json.NewDecoder(resp.Body).Decode(&predictions); err != nil {
-// 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-// 		return
-// 	}
-
-// 	// Process predictions and prepare results
-// 	var results []NeuralNetworkPrediction
-// 	for i, selection := range selections {
-// 		results = append(results, NeuralNetworkPrediction{
-// 			SelectionID:    selection.ID,
-// 			SelectionName:  selection.Name,
-// 			EventName:      selection.EventName,
-// 			EventTime:      selection.EventTime,
-// 			PredictedWin:   predictions[i].Probability > 0.5, // Example threshold for classification
-// 			WinProbability: predictions[i].Probability,
-// 		})
-// 	}
-
-// 	// Sort results by win probability
-// 	sort.SliceStable(results, func(i, j int) bool {
-// 		return results[i].WinProbability > results[j].WinProbability
-// 	})
-
-// 	c.JSON(http.StatusOK, gin.H{"data": results})
-// }
-
-
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/race-picks-backend/pkg/api/common"
+	"github.com/mmanjoura/race-picks-backend/pkg/features"
+	"github.com/mmanjoura/race-picks-backend/pkg/jobs"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/neural"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+)
+
+// NeuralNetworkModel names the perceptron's rows in ModelWeights.
+const NeuralNetworkModel = "neural_network"
+
+// NeuralNetworkTrainRequest is the body of /analysis/NeuralNetworkTrain.
+// Model is neural_network (the default) or logistic. Only runs before
+// Before (YYYY-MM-DD) are used; empty uses every run.
+type NeuralNetworkTrainRequest struct {
+	Model  string `json:"model"`
+	Before string `json:"before"`
+	neural.Options
+}
+
+// NeuralNetworkRequest is the body of /analysis/NeuralNetworkPrediction.
+// An empty ModelVersion uses the latest trained weights.
+type NeuralNetworkRequest struct {
+	EventName    string `json:"event_name" binding:"required"`
+	EventDate    string `json:"event_date" binding:"required"`
+	EventTime    string `json:"event_time" binding:"required"`
+	ModelVersion string `json:"model_version"`
+}
+
+// NeuralNetworkPrediction is the network's view of one runner. Probability
+// is the network's output for the horse on its own; WinProbability shares
+// the race out between the runners.
+type NeuralNetworkPrediction struct {
+	SelectionID    int                `json:"selection_id"`
+	SelectionName  string             `json:"selection_name"`
+	EventName      string             `json:"event_name"`
+	EventDate      string             `json:"event_date"`
+	EventTime      string             `json:"event_time"`
+	Odds           string             `json:"odds"`
+	HasForm        bool               `json:"has_form"`
+	RunCount       int                `json:"run_count"`
+	Features       map[string]float64 `json:"features,omitempty"`
+	Probability    float64            `json:"probability"`
+	WinProbability float64            `json:"win_probability"`
+}
+
+// TrainNeuralNetwork trains the perceptron, or the logistic regression, on
+// the stored form in the background and saves the weights as a new version.
+func (h *Handler) TrainNeuralNetwork(c *gin.Context) {
+	var req NeuralNetworkTrainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Model == "" {
+		req.Model = NeuralNetworkModel
+	}
+	if req.Model != NeuralNetworkModel && req.Model != LogisticModel {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("model %q cannot be trained", req.Model)})
+		return
+	}
+
+	var before time.Time
+	if req.Before != "" {
+		var err error
+		if before, err = common.AsOf(req.Before); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	jobID, err := jobs.Submit(c, "Train:"+req.Model, func(ctx context.Context, progress *jobs.Progress) (interface{}, error) {
+		return TrainNeuralNetwork(ctx, h.repos, req.Model, before, req.Options, progress)
+	})
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job_id": jobID})
+}
+
+// TrainNeuralNetwork fits model, the perceptron or the logistic regression,
+// to every run before the cut-off, labelled by whether the horse won, and
+// stores the result. Progress counts epochs.
+func TrainNeuralNetwork(ctx context.Context, repos repository.Repositories, model string, before time.Time, opts neural.Options, progress *jobs.Progress) (interface{}, error) {
+	history, err := repos.Form.History(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := features.Samples(history)
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no runs to train on")
+	}
+	x := make([][]float64, len(samples))
+	y := make([]bool, len(samples))
+	for i, sample := range samples {
+		x[i] = sample.X
+		y[i] = sample.Won
+	}
+
+	opts = opts.WithDefaults()
+	progress.SetTotal(opts.Epochs)
+	train := neural.Train
+	if model == LogisticModel {
+		train = neural.TrainLogistic
+	}
+	network, stats, err := train(features.Names, x, y, opts, func(int) { progress.Done() })
+	if err != nil {
+		return nil, err
+	}
+
+	weights, err := json.Marshal(network)
+	if err != nil {
+		return nil, err
+	}
+	encodedStats, err := json.Marshal(stats)
+	if err != nil {
+		return nil, err
+	}
+	saved, err := repos.Weights.Save(ctx, model, weights, encodedStats)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{"model": saved.Model, "version": saved.Version, "stats": stats}, nil
+}
+
+// NeuralNetworkPrediction scores the runners of one race with a trained
+// perceptron, the latest unless a version is asked for.
+func (h *Handler) NeuralNetworkPrediction(c *gin.Context) {
+	var req NeuralNetworkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	asOf, err := common.AsOf(req.EventDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	predictor, err := trainedLoader(h.repos, NeuralNetworkModel, loadNetworkPredictor)(c, req.ModelVersion)
+	if err != nil {
+		c.JSON(predictorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	network := predictor.(*networkPredictor)
+
+	runners, err := h.repos.Runners.ByRace(c, req.EventDate, req.EventName, req.EventTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	predictions, err := networkPredictions(c, h.repos.Features, network.network, runners, asOf)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sort.SliceStable(predictions, func(i, j int) bool {
+		return predictions[i].WinProbability > predictions[j].WinProbability
+	})
+
+	c.JSON(http.StatusOK, gin.H{"model": network.Name(), "version": network.Version(), "data": predictions})
+}
+
+// networkPredictions runs network over each runner's form before asOf and
+// shares each race out between its runners with form.
+func networkPredictions(ctx context.Context, store *repository.FeatureRepo, network *neural.Network, runners []models.Runner, asOf time.Time) ([]NeuralNetworkPrediction, error) {
+	var predictions []NeuralNetworkPrediction
+	for _, field := range groupByRace(runners) {
+		start := len(predictions)
+		var total float64
+		for _, runner := range field {
+			prediction := NeuralNetworkPrediction{
+				SelectionID:   runner.ID,
+				SelectionName: runner.Name,
+				EventName:     runner.EventName,
+				EventDate:     runner.EventDate,
+				EventTime:     runner.EventTime,
+				Odds:          runner.Odds,
+			}
+
+			f, _, err := store.At(ctx, runner.ID, asOf)
+			if err != nil {
+				return nil, err
+			}
+			if x, ok := features.FromSnapshot(f, asOf, runner.TrackCondition); ok {
+				prediction.HasForm = true
+				prediction.RunCount = f.NumRuns
+				prediction.Features = map[string]float64{}
+				for i, name := range features.Names {
+					prediction.Features[name] = x[i]
+				}
+				prediction.Probability = network.Predict(features.Select(x, network.Features))
+				total += prediction.Probability
+			}
+			predictions = append(predictions, prediction)
+		}
+
+		if total > 0 {
+			for i := start; i < len(predictions); i++ {
+				predictions[i].WinProbability = predictions[i].Probability / total
+			}
+		}
+	}
+	return predictions, nil
+}
+
+// loadNetwork decodes stored weights and checks the features they were
+// trained on are still computed. A network trained before a feature was
+// added is fed the features it knows.
+func loadNetwork(weights []byte) (*neural.Network, error) {
+	var network neural.Network
+	if err := json.Unmarshal(weights, &network); err != nil {
+		return nil, err
+	}
+	if err := features.Check(network.Features); err != nil {
+		return nil, fmt.Errorf("stored network was trained on %v, retrain it: %v", network.Features, err)
+	}
+	return &network, nil
+}
@@ -0,0 +1,129 @@
+package analysis
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/race-picks-backend/pkg/jobs"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/optimise"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+)
+
+// OptimiseWeightsRequest is the body of /analysis/OptimiseWeights. Dates
+// are YYYY-MM-DD. The search starts from the weights of ScoringProfile,
+// by default the active profile. With DryRun nothing is written to
+// OptimalParameters or ScoringProfiles.
+type OptimiseWeightsRequest struct {
+	From           string `json:"from" binding:"required"`
+	To             string `json:"to" binding:"required"`
+	ScoringProfile string `json:"scoring_profile"`
+	DryRun         bool   `json:"dry_run"`
+	optimise.Options
+}
+
+// OptimiseWeightsReport is the search report with the rows written.
+type OptimiseWeightsReport struct {
+	optimise.Report
+	BaseProfile string                     `json:"base_profile"`
+	Saved       []models.OptimalParameters `json:"saved"`
+	Profiles    []models.ScoringProfile    `json:"profiles"`
+}
+
+// OptimisedProfileName is the scoring profile the weights optimised for
+// raceType are saved under, one version per run of the optimiser.
+func OptimisedProfileName(raceType string) string {
+	return "optimised " + raceType
+}
+
+// OptimiseWeights searches the heuristic scorer's weights for each race
+// type over past races in the background, and writes the best of each to
+// OptimalParameters and as the next version of its race type's scoring
+// profile. The profiles are not activated; predictions use them once one
+// is activated or asked for as the heuristic model's version.
+func (h *Handler) OptimiseWeights(c *gin.Context) {
+	var req OptimiseWeightsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	from, to, err := dateRange(req.From, req.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	opts := req.Options.WithDefaults()
+	if err := opts.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	base, err := loadHeuristic(c, h.repos, HeuristicModel, req.ScoringProfile)
+	if err != nil {
+		c.JSON(predictorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	jobID, err := jobs.Submit(c, "OptimiseWeights", func(ctx context.Context, progress *jobs.Progress) (interface{}, error) {
+		return OptimiseWeights(ctx, h.repos, from, to, base, opts, req.DryRun, progress)
+	})
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job_id": jobID})
+}
+
+// OptimiseWeights rebuilds the races from from to to, searches weights for
+// each race type starting from base's, and unless dryRun stores the best
+// of each with the optimal parameters derived from them, and as a scoring
+// profile based on base's. Progress counts the days loaded.
+func OptimiseWeights(ctx context.Context, repos repository.Repositories, from, to time.Time, base *heuristicPredictor, opts optimise.Options, dryRun bool, progress *jobs.Progress) (OptimiseWeightsReport, error) {
+	races, err := optimise.Load(ctx, repos, from, to, progress)
+	if err != nil {
+		return OptimiseWeightsReport{}, err
+	}
+
+	report, err := optimise.Optimise(races, base.weights, ScoreSelection, opts)
+	if err != nil {
+		return OptimiseWeightsReport{}, err
+	}
+
+	result := OptimiseWeightsReport{
+		Report:      report,
+		BaseProfile: base.version,
+		Saved:       []models.OptimalParameters{},
+		Profiles:    []models.ScoringProfile{},
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	now := time.Now()
+	for _, r := range report.Results {
+		params := r.Parameters
+		weights := r.Weights
+		params.Weights = &weights
+		params.Objective = report.Objective
+		params.TrainScore = r.Best.Train
+		params.TestScore = r.Best.Test
+		params.OptimisedAt = &now
+
+		saved, err := repos.Predictions.SaveOptimalParameters(ctx, params)
+		if err != nil {
+			return result, err
+		}
+		result.Saved = append(result.Saved, saved)
+
+		profile, err := repos.Scoring.Save(ctx, OptimisedProfileName(r.RaceType), weights, base.profile)
+		if err != nil {
+			return result, err
+		}
+		result.Profiles = append(result.Profiles, profile)
+	}
+	return result, nil
+}
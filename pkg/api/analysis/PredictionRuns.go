@@ -0,0 +1,226 @@
+package analysis
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/race-picks-backend/pkg/api/common"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// RunPick is a pick of a prediction run with its rank in its race.
+type RunPick struct {
+	Rank int `json:"rank"`
+	models.SelectionResult
+}
+
+// PickChange is a selection picked in the same race by both runs of a diff.
+type PickChange struct {
+	SelectionID   int     `json:"selection_id"`
+	SelectionName string  `json:"selection_name"`
+	FromRank      int     `json:"from_rank"`
+	ToRank        int     `json:"to_rank"`
+	FromScore     float64 `json:"from_score"`
+	ToScore       float64 `json:"to_score"`
+}
+
+// RaceDiff is how the picks of one race differ between two runs.
+type RaceDiff struct {
+	EventName string       `json:"event_name"`
+	EventTime string       `json:"event_time"`
+	Added     []RunPick    `json:"added"`
+	Removed   []RunPick    `json:"removed"`
+	Changed   []PickChange `json:"changed"`
+}
+
+// PredictionRuns lists the prediction runs of the event_date query
+// parameter, newest first, optionally for one model or strategy.
+func (h *Handler) PredictionRuns(c *gin.Context) {
+	date := c.Query("event_date")
+	if _, err := common.AsOf(date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	runs, err := h.repos.Predictions.Runs(c, date, c.Query("model"), c.Query("strategy"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"runs": runs})
+}
+
+// PredictionRun returns a run and its picks.
+func (h *Handler) PredictionRun(c *gin.Context) {
+	run, ok := h.run(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	picks, err := h.repos.Predictions.ForRun(c, run.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"run": run, "picks": rankPicks(picks)})
+}
+
+// DiffPredictionRuns compares the picks of run :id with those of run
+// :other, race by race. Races whose picks are the same are left out.
+func (h *Handler) DiffPredictionRuns(c *gin.Context) {
+	from, ok := h.run(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	to, ok := h.run(c, c.Param("other"))
+	if !ok {
+		return
+	}
+
+	fromPicks, err := h.repos.Predictions.ForRun(c, from.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	toPicks, err := h.repos.Predictions.ForRun(c, to.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":  from,
+		"to":    to,
+		"races": diffRuns(rankPicks(fromPicks), rankPicks(toPicks)),
+	})
+}
+
+// PublishPredictionRun marks run :id as published. The latest published
+// run of a date, model and strategy is the one GetWinners serves and the
+// ledger settles.
+func (h *Handler) PublishPredictionRun(c *gin.Context) {
+	run, ok := h.run(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if _, err := h.repos.Predictions.Publish(c, run.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	run, _, err := h.repos.Predictions.Run(c, run.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"run": run})
+}
+
+// run loads the run with the given ID, writing the error response if it
+// cannot.
+func (h *Handler) run(c *gin.Context, param string) (models.PredictionRun, bool) {
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid run id " + strconv.Quote(param)})
+		return models.PredictionRun{}, false
+	}
+
+	run, ok, err := h.repos.Predictions.Run(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return models.PredictionRun{}, false
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no prediction run " + param})
+		return models.PredictionRun{}, false
+	}
+	return run, true
+}
+
+// rankPicks numbers the picks of each race from 1, in the order ForRun
+// returns them: best scored first.
+func rankPicks(picks []models.SelectionResult) []RunPick {
+	ranked := make([]RunPick, len(picks))
+	ranks := map[string]int{}
+	for i, pick := range picks {
+		key := pick.EventTime + "|" + pick.EventName
+		ranks[key]++
+		ranked[i] = RunPick{Rank: ranks[key], SelectionResult: pick}
+	}
+	return ranked
+}
+
+// diffRuns lists, for each race either run picked in, the picks only in
+// to (added), only in from (removed) and in both with a different rank or
+// score (changed).
+func diffRuns(from, to []RunPick) []RaceDiff {
+	type race struct {
+		from, to []RunPick
+	}
+	races := map[string]*race{}
+	var order []string
+	byRace := func(pick RunPick) *race {
+		key := pick.EventTime + "|" + pick.EventName
+		r, ok := races[key]
+		if !ok {
+			r = &race{}
+			races[key] = r
+			order = append(order, key)
+		}
+		return r
+	}
+	for _, pick := range from {
+		r := byRace(pick)
+		r.from = append(r.from, pick)
+	}
+	for _, pick := range to {
+		r := byRace(pick)
+		r.to = append(r.to, pick)
+	}
+
+	diffs := []RaceDiff{}
+	for _, key := range order {
+		r := races[key]
+		before := map[int]RunPick{}
+		for _, pick := range r.from {
+			before[pick.SelectionID] = pick
+		}
+		after := map[int]bool{}
+
+		var diff RaceDiff
+		for _, pick := range r.to {
+			diff.EventName, diff.EventTime = pick.EventName, pick.EventTime
+			after[pick.SelectionID] = true
+			old, ok := before[pick.SelectionID]
+			switch {
+			case !ok:
+				diff.Added = append(diff.Added, pick)
+			case old.Rank != pick.Rank || old.TotalScore != pick.TotalScore:
+				diff.Changed = append(diff.Changed, PickChange{
+					SelectionID:   pick.SelectionID,
+					SelectionName: pick.SelectionName,
+					FromRank:      old.Rank,
+					ToRank:        pick.Rank,
+					FromScore:     old.TotalScore,
+					ToScore:       pick.TotalScore,
+				})
+			}
+		}
+		for _, pick := range r.from {
+			diff.EventName, diff.EventTime = pick.EventName, pick.EventTime
+			if !after[pick.SelectionID] {
+				diff.Removed = append(diff.Removed, pick)
+			}
+		}
+
+		if len(diff.Added)+len(diff.Removed)+len(diff.Changed) > 0 {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,250 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/neural"
+	"github.com/mmanjoura/race-picks-backend/pkg/predict"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+	"github.com/mmanjoura/race-picks-backend/pkg/scoring"
+	"github.com/mmanjoura/race-picks-backend/pkg/strategy"
+)
+
+// Names of the models in the registry.
+const (
+	HeuristicModel  = predict.DefaultModel
+	MonteCarloModel = "monte_carlo"
+	LogisticModel   = "logistic"
+)
+
+// heuristicVersion is the version of the heuristic model when it scores
+// with scoring.Default because no profile is stored. Otherwise its version
+// is the ID of the scoring profile it scores with.
+const heuristicVersion = "1"
+
+// NewRegistry returns every prediction model, reading from repos. Each
+// serves win probabilities through its latest calibration.
+func NewRegistry(repos repository.Repositories) *predict.Registry {
+	registry := predict.NewRegistry()
+	registry.Register(HeuristicModel, calibrated(repos, func(ctx context.Context, version string) (predict.Predictor, error) {
+		return loadHeuristic(ctx, repos, HeuristicModel, version)
+	}))
+	registry.Register(MonteCarloModel, calibrated(repos, func(ctx context.Context, version string) (predict.Predictor, error) {
+		heuristic, err := loadHeuristic(ctx, repos, MonteCarloModel, version)
+		if err != nil {
+			return nil, err
+		}
+		return &monteCarloPredictor{heuristic: heuristic}, nil
+	}))
+	registry.Register(LogisticModel, calibrated(repos, trainedLoader(repos, LogisticModel, loadNetworkPredictor)))
+	registry.Register(NeuralNetworkModel, calibrated(repos, trainedLoader(repos, NeuralNetworkModel, loadNetworkPredictor)))
+	registry.Register(ConditionalLogitModel, calibrated(repos, trainedLoader(repos, ConditionalLogitModel, loadConditionalLogitPredictor)))
+	return registry
+}
+
+// predictorStatus is the HTTP status for an error loading a model.
+func predictorStatus(err error) int {
+	var unknown *predict.UnknownModelError
+	switch {
+	case errors.As(err, &unknown):
+		return http.StatusBadRequest
+	case errors.Is(err, predict.ErrNotTrained):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// strategyStatus is the HTTP status for an error resolving a strategy.
+func strategyStatus(err error) int {
+	var unknown *strategy.UnknownStrategyError
+	if errors.As(err, &unknown) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// heuristicPredictor is ScoreSelection, the points-based model the picks
+// have always been made with, scoring with the weights of one profile.
+// profile is the ID of that profile, 0 for scoring.Default.
+type heuristicPredictor struct {
+	form    *repository.FormRepo
+	version string
+	profile int
+	weights models.ScoringWeights
+}
+
+func (p *heuristicPredictor) Name() string    { return HeuristicModel }
+func (p *heuristicPredictor) Version() string { return p.version }
+
+func (p *heuristicPredictor) Predict(ctx context.Context, race predict.Race, runners []models.Runner) ([]models.SelectionResult, error) {
+	results, err := scoreSelections(ctx, p.form, runners, race.Params, p.weights, race.AsOf)
+	if err != nil {
+		return nil, err
+	}
+	return predict.Stamp(p, results), nil
+}
+
+// monteCarloPredictor turns the heuristic scores into win probabilities by
+// simulating each race with a fixed seed.
+type monteCarloPredictor struct {
+	heuristic *heuristicPredictor
+}
+
+func (p *monteCarloPredictor) Name() string    { return MonteCarloModel }
+func (p *monteCarloPredictor) Version() string { return p.heuristic.version }
+
+func (p *monteCarloPredictor) Predict(ctx context.Context, race predict.Race, runners []models.Runner) ([]models.SelectionResult, error) {
+	scored, err := scoreSelections(ctx, p.heuristic.form, runners, race.Params, p.heuristic.weights, race.AsOf)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int]models.SelectionResult{}
+	for _, result := range scored {
+		byID[result.SelectionID] = result
+	}
+
+	var results []models.SelectionResult
+	for _, field := range groupByRace(runners) {
+		for _, simulated := range simulateRace(field, scored, defaultSimulations, defaultSeed, 0) {
+			result, ok := byID[simulated.SelectionID]
+			if !ok {
+				continue
+			}
+			result.WinProbability = simulated.WinProbability
+			result.TotalScore = simulated.WinProbability
+			results = append(results, result)
+		}
+	}
+	return predict.Stamp(p, results), nil
+}
+
+// networkPredictor serves one stored version of a trained network or
+// logistic regression.
+type networkPredictor struct {
+	name    string
+	version int
+	network *neural.Network
+	store   *repository.FeatureRepo
+}
+
+func (p *networkPredictor) Name() string    { return p.name }
+func (p *networkPredictor) Version() string { return strconv.Itoa(p.version) }
+
+func (p *networkPredictor) Predict(ctx context.Context, race predict.Race, runners []models.Runner) ([]models.SelectionResult, error) {
+	predictions, err := networkPredictions(ctx, p.store, p.network, runners, race.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.SelectionResult
+	for _, prediction := range predictions {
+		if !prediction.HasForm {
+			continue
+		}
+		results = append(results, models.SelectionResult{
+			SelectionID:    prediction.SelectionID,
+			EventName:      prediction.EventName,
+			EventDate:      prediction.EventDate,
+			EventTime:      prediction.EventTime,
+			SelectionName:  prediction.SelectionName,
+			Odds:           prediction.Odds,
+			AvgPosition:    prediction.Features["avg_position"],
+			AvgRating:      prediction.Features["avg_rating"],
+			RunCount:       prediction.RunCount,
+			TotalScore:     prediction.WinProbability,
+			WinProbability: prediction.WinProbability,
+		})
+	}
+	return predict.Stamp(p, results), nil
+}
+
+// loadHeuristic returns the heuristic scorer with the weights of the
+// scoring profile whose ID is version, or of the active profile for an
+// empty version. name is the model asked for, for errors.
+func loadHeuristic(ctx context.Context, repos repository.Repositories, name, version string) (*heuristicPredictor, error) {
+	if version == "" {
+		profile, ok, err := repos.Scoring.Active(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return &heuristicPredictor{form: repos.Form, version: heuristicVersion, weights: scoring.Default()}, nil
+		}
+		return &heuristicPredictor{form: repos.Form, version: strconv.Itoa(profile.ID), profile: profile.ID, weights: profile.Weights}, nil
+	}
+
+	id, err := strconv.Atoi(version)
+	if err != nil {
+		return nil, &predict.UnknownModelError{Name: name, Version: version}
+	}
+	profile, ok, err := repos.Scoring.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if version == heuristicVersion {
+			return &heuristicPredictor{form: repos.Form, version: heuristicVersion, weights: scoring.Default()}, nil
+		}
+		return nil, &predict.UnknownModelError{Name: name, Version: version}
+	}
+	return &heuristicPredictor{form: repos.Form, version: version, profile: profile.ID, weights: profile.Weights}, nil
+}
+
+// trainedLoader loads a stored version of a trained model, building the
+// predictor from its weights with build.
+func trainedLoader(repos repository.Repositories, name string, build func(saved models.ModelWeights, store *repository.FeatureRepo) (predict.Predictor, error)) predict.Loader {
+	return func(ctx context.Context, version string) (predict.Predictor, error) {
+		number := 0
+		if version != "" {
+			var err error
+			if number, err = strconv.Atoi(version); err != nil || number < 1 {
+				return nil, &predict.UnknownModelError{Name: name, Version: version}
+			}
+		}
+
+		saved, ok, err := repos.Weights.Version(ctx, name, number)
+		if err != nil {
+			return nil, err
+		}
+		if !ok && number == 0 {
+			return nil, fmt.Errorf("%s: %w", name, predict.ErrNotTrained)
+		}
+		if !ok {
+			return nil, &predict.UnknownModelError{Name: name, Version: version}
+		}
+
+		return build(saved, repos.Features)
+	}
+}
+
+func loadNetworkPredictor(saved models.ModelWeights, store *repository.FeatureRepo) (predict.Predictor, error) {
+	network, err := loadNetwork(saved.Weights)
+	if err != nil {
+		return nil, err
+	}
+	return &networkPredictor{name: saved.Model, version: saved.Version, network: network, store: store}, nil
+}
+
+// groupByRace splits runners into their races, keeping the order races are
+// first seen in.
+func groupByRace(runners []models.Runner) [][]models.Runner {
+	index := map[string]int{}
+	var races [][]models.Runner
+	for _, runner := range runners {
+		key := runner.EventName + "|" + runner.EventTime
+		i, ok := index[key]
+		if !ok {
+			i = len(races)
+			index[key] = i
+			races = append(races, nil)
+		}
+		races[i] = append(races[i], runner)
+	}
+	return races
+}
@@ -0,0 +1,75 @@
+package analysis
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/race-picks-backend/pkg/staking"
+)
+
+// StakeRequest is the body of /analysis/Stake. Bets with the same Race are
+// on runners of one race and are staked together.
+type StakeRequest struct {
+	Bankroll float64      `json:"bankroll" binding:"required"`
+	Staking  staking.Plan `json:"staking"`
+	Bets     []StakeBet   `json:"bets" binding:"required"`
+}
+
+// StakeBet is one bet to size. Race and Selection only identify it.
+type StakeBet struct {
+	Race      string `json:"race"`
+	Selection string `json:"selection"`
+	staking.Bet
+}
+
+// StakedBet is a bet with its stake and the Kelly share of the bank it
+// would have on its own.
+type StakedBet struct {
+	StakeBet
+	Stake         float64 `json:"stake"`
+	KellyFraction float64 `json:"kelly_fraction"`
+}
+
+// Stake sizes bets from a bankroll under a staking plan.
+func (h *Handler) Stake(c *gin.Context) {
+	var req StakeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.Staking.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, bet := range req.Bets {
+		if bet.Probability < 0 || bet.Probability > 1 || bet.Odds <= 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "each bet needs a probability in [0, 1] and decimal odds above 1"})
+			return
+		}
+	}
+
+	races := map[string][]int{}
+	var order []string
+	for i, bet := range req.Bets {
+		if _, ok := races[bet.Race]; !ok {
+			order = append(order, bet.Race)
+		}
+		races[bet.Race] = append(races[bet.Race], i)
+	}
+
+	staked := make([]StakedBet, len(req.Bets))
+	var total float64
+	for _, race := range order {
+		bets := make([]staking.Bet, len(races[race]))
+		for j, i := range races[race] {
+			bets[j] = req.Bets[i].Bet
+		}
+		for j, stake := range req.Staking.Race(req.Bankroll, bets) {
+			i := races[race][j]
+			staked[i] = StakedBet{StakeBet: req.Bets[i], Stake: stake, KellyFraction: staking.KellyFraction(bets[j])}
+			total += stake
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"bankroll": req.Bankroll, "total_stake": total, "bets": staked})
+}
@@ -0,0 +1,108 @@
+package analysis
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/race-picks-backend/pkg/api/common"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/predict"
+	"github.com/mmanjoura/race-picks-backend/pkg/staking"
+	"github.com/mmanjoura/race-picks-backend/pkg/value"
+)
+
+// ValueBetsRequest is the body of /analysis/ValueBets. MinEdge is in
+// percentage points of win probability; Commission defaults to
+// value.DefaultCommission. With a Bankroll, the value bets are staked
+// under Staking. Model and the filters are as in TodayPredictions.
+type ValueBetsRequest struct {
+	EventDate    string       `json:"event_date" binding:"required"`
+	Model        string       `json:"model"`
+	ModelVersion string       `json:"model_version"`
+	MinEdge      float64      `json:"min_edge"`
+	Commission   *float64     `json:"commission"`
+	Bankroll     float64      `json:"bankroll"`
+	Staking      staking.Plan `json:"staking"`
+	Years        string       `json:"years"`
+	Positions    string       `json:"positions"`
+	Ages         string       `json:"ages"`
+}
+
+// ValueBets scores every runner of the day and assesses each against its
+// price and, for races already run, its BSP. It returns every assessment,
+// best expected value first, and the value bet of each race.
+func (h *Handler) ValueBets(c *gin.Context) {
+	var req ValueBetsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	asOf, err := common.AsOf(req.EventDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	opts := value.Options{MinEdge: req.MinEdge, Commission: value.DefaultCommission}
+	if req.Commission != nil {
+		opts.Commission = *req.Commission
+	}
+	if err := req.Staking.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	predictor, err := h.registry.Get(c, req.Model, req.ModelVersion)
+	if err != nil {
+		c.JSON(predictorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	runners, err := h.repos.Runners.ByDate(c, req.EventDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	raceParams := models.RaceParameters{EventDate: req.EventDate, Years: req.Years, Positions: req.Positions, Ages: req.Ages}
+	results, err := predictor.Predict(c, predict.Race{Params: raceParams, AsOf: asOf}, runners)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	bsp, err := value.LoadBSP(c, h.repos.MarketData, req.EventDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	assessments := value.Assess(results, bsp, opts)
+	if req.Bankroll > 0 {
+		value.Stake(assessments, req.Bankroll, req.Staking, opts)
+	}
+	sort.SliceStable(assessments, func(i, j int) bool {
+		return bestExpectedValue(assessments[i]) > bestExpectedValue(assessments[j])
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"model":         predictor.Name(),
+		"model_version": predictor.Version(),
+		"bets":          value.Best(assessments),
+		"assessments":   assessments,
+	})
+}
+
+// bestExpectedValue is the higher expected value of an assessment's price
+// and BSP, or -1, a lost stake, with neither.
+func bestExpectedValue(a value.Assessment) float64 {
+	ev := -1.0
+	if a.Price != nil {
+		ev = a.Price.ExpectedValue
+	}
+	if a.BSP != nil && a.BSP.ExpectedValue > ev {
+		ev = a.BSP.ExpectedValue
+	}
+	return ev
+}
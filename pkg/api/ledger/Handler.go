@@ -0,0 +1,12 @@
+package ledger
+
+import "github.com/mmanjoura/race-picks-backend/pkg/repository"
+
+// Handler serves the settlement and profit and loss routes.
+type Handler struct {
+	repos repository.Repositories
+}
+
+func NewHandler(repos repository.Repositories) *Handler {
+	return &Handler{repos: repos}
+}
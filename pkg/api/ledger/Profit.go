@@ -0,0 +1,58 @@
+package ledger
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+)
+
+// Daily returns the profit of each strategy on each day.
+func (h *Handler) Daily(c *gin.Context) {
+	h.profit(c, repository.ByDay)
+}
+
+// Weekly returns the profit of each strategy in each week.
+func (h *Handler) Weekly(c *gin.Context) {
+	h.profit(c, repository.ByWeek)
+}
+
+// ByStrategy returns the profit of each strategy over the whole range.
+func (h *Handler) ByStrategy(c *gin.Context) {
+	h.profit(c, repository.ByStrategy)
+}
+
+// Entries returns the settled picks themselves.
+func (h *Handler) Entries(c *gin.Context) {
+	from, to, err := dateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := h.repos.Ledger.Entries(c, from, to, c.Query("strategy"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+// profit serves the totals grouped by groupBy, for the from, to and
+// strategy query parameters.
+func (h *Handler) profit(c *gin.Context, groupBy string) {
+	from, to, err := dateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	summaries, err := h.repos.Ledger.Profit(c, groupBy, from, to, c.Query("strategy"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "profit": summaries})
+}
@@ -0,0 +1,75 @@
+package ledger
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/race-picks-backend/pkg/api/common"
+	"github.com/mmanjoura/race-picks-backend/pkg/jobs"
+	"github.com/mmanjoura/race-picks-backend/pkg/racing"
+	"github.com/mmanjoura/race-picks-backend/pkg/settlement"
+	"github.com/mmanjoura/race-picks-backend/pkg/staking"
+	"github.com/mmanjoura/race-picks-backend/pkg/value"
+)
+
+// SettleRequest is the body of /ledger/Settle. Through (YYYY-MM-DD)
+// defaults to today and Commission to value.DefaultCommission; Staking and
+// Bankroll are as in settlement.Options.
+type SettleRequest struct {
+	Through    string       `json:"through"`
+	Commission *float64     `json:"commission"`
+	Staking    staking.Plan `json:"staking"`
+	Bankroll   float64      `json:"bankroll"`
+}
+
+// Settle settles the stored picks whose races have finished in the
+// background.
+func (h *Handler) Settle(c *gin.Context) {
+	var req SettleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := settlement.Options{Commission: value.DefaultCommission, Staking: req.Staking, Bankroll: req.Bankroll}
+	if req.Commission != nil {
+		opts.Commission = *req.Commission
+	}
+	if req.Through != "" {
+		var err error
+		if opts.Through, err = common.AsOf(req.Through); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := opts.Staking.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	jobID, err := jobs.Submit(c, "SettlePredictions", func(ctx context.Context, progress *jobs.Progress) (interface{}, error) {
+		return settlement.Settle(ctx, h.repos, opts, progress)
+	})
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job_id": jobID})
+}
+
+// dateRange reads the from and to query parameters (YYYY-MM-DD). from
+// defaults to the start of the ledger and to to today.
+func dateRange(c *gin.Context) (from, to string, err error) {
+	from = c.DefaultQuery("from", "0001-01-01")
+	to = c.DefaultQuery("to", time.Now().Format(racing.EventDateLayout))
+	if _, err = common.AsOf(from); err != nil {
+		return "", "", err
+	}
+	if _, err = common.AsOf(to); err != nil {
+		return "", "", err
+	}
+	return from, to, nil
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -20,20 +21,20 @@ import (
 // @Param endDate query string true "End Date"
 // @Success 200
 // @Router /analytics/download-market-data [get]
-func GetMarketData(c *gin.Context) {
+func (h *Handler) GetMarketData(c *gin.Context) {
 
 	// Get the data
 	startDate := c.Query("startDate")
 	endDate := c.Query("endDate")
 
-	err := getFiles(startDate, endDate)
+	err := getFiles(h.dataDir, startDate, endDate)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 }
 
-func getFiles(startDate, endDate string) error {
+func getFiles(dataDir, startDate, endDate string) error {
 	// Parse the start and end dates
 	start, err := time.Parse("2006-01-02", startDate)
 	if err != nil {
@@ -50,14 +51,14 @@ func getFiles(startDate, endDate string) error {
 
 		// Download dwbfpricesireplace file
 		fileUrl := "https://promo.betfair.com/betfairsp/prices/dwbfpricesireplace" + meetingDate + ".csv"
-		if err = DownloadFile("./data/dwbfpricesirewin"+meetingDate+".csv", fileUrl); err != nil {
+		if err = DownloadFile(filepath.Join(dataDir, "dwbfpricesirewin"+meetingDate+".csv"), fileUrl); err != nil {
 			return fmt.Errorf("failed to download dwbfpricesireplace file for %s: %w", meetingDate, err)
 		}
 		fmt.Println("Finished downloading result for " + meetingDate + " from Betfair API.")
 
 		// Download dwbfpricesukplace file
 		fileUrl = "https://promo.betfair.com/betfairsp/prices/dwbfpricesukplace" + meetingDate + ".csv"
-		if err = DownloadFile("./data/dwbfpricesukwin"+meetingDate+".csv", fileUrl); err != nil {
+		if err = DownloadFile(filepath.Join(dataDir, "dwbfpricesukwin"+meetingDate+".csv"), fileUrl); err != nil {
 			return fmt.Errorf("failed to download dwbfpricesukplace file for %s: %w", meetingDate, err)
 		}
 		fmt.Println("Finished downloading result for " + meetingDate + " from Betfair API.")
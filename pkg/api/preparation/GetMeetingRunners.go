@@ -2,39 +2,21 @@ package preparation
 
 import (
 	"database/sql"
-	"fmt"
-	"math"
 	"net/http"
 	"sort"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/mmanjoura/race-picks-backend/pkg/api/common"
-	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/features"
+	"github.com/mmanjoura/race-picks-backend/pkg/going"
 	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/racing"
 
 	"github.com/gin-gonic/gin"
 )
 
-type DaySince struct {
-	RaceDate    time.Time `json:"race_date"`
-	SelectionID int       `json:"selection_id"`
-}
-
-type Diff struct {
-	DaySince
-	DateDiffInDays int `json:"date_diff_in_days"`
-}
-
-func GetMeetingRunners(c *gin.Context) {
-	db := database.Database.DB
-	type Selection struct {
-		ID        int
-		Name      string
-		EventDate time.Time
-	}
-
+func (h *Handler) GetMeetingRunners(c *gin.Context) {
 	analysisDataResponse := models.AnalysisDataResponse{}
 
 	eventName := c.Query("event_name")
@@ -42,108 +24,39 @@ func GetMeetingRunners(c *gin.Context) {
 	eventDate := c.Query("event_date")
 	raceType := c.Query("race_type")
 
-	// Get distinct Event name from SelectionsForm table
-	rows, err := db.Query(`
-		SELECT 	id,
-				race_type,
-				optimal_num_runs,
-				optimal_num_years_in_competition,
-				optimal_num_wins,
-				optimal_rating,
-				optimal_position,
-				optimal_distance
-			FROM OptimalParameters
-			where race_type = ?
-	`, raceType)
-
+	asOf, err := common.AsOf(eventDate)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tolerance, err := strconv.ParseFloat(c.DefaultQuery("distance_tolerance", strconv.FormatFloat(features.DefaultDistanceTolerance, 'f', -1, 64)), 64)
+	if err != nil || tolerance < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "distance_tolerance must be a number of furlongs of at least 0"})
 		return
 	}
-	defer rows.Close()
-
-	var Params models.OptimalParameters
-	for rows.Next() {
 
-		err := rows.Scan(
-			&Params.ID,
-			&Params.RaceType,
-			&Params.OptimalNumRuns,
-			&Params.OptimalNumYearsInCompetition,
-			&Params.OptimalNumWins,
-			&Params.OptimalRating,
-			&Params.OptimalPosition,
-			&Params.OptimalDistance,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+	params, err := h.repos.Predictions.OptimalParameters(c, raceType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
+	analysisDataResponse.Parameters = params
 
 	// Get today's runners for the given event_name and event_date
-	rows, err = db.Query(`
-		SELECT selection_id,
-			selection_name,
-			event_name,
-			event_date,
-			event_time,
-			race_distance,
-			race_category,
-			track_condition,
-			number_of_runners,
-			race_track,
-			race_class
-		FROM EventRunners WHERE  
-					event_name = ? and event_time = ? and DATE(event_date) = ?`,
-		eventName, eventTime, eventDate)
+	runners, err := h.repos.Runners.ByRace(c, eventDate, eventName, eventTime)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
 
-	var analysisData []models.AnalysisData
 	var selections []common.Selection
-	for rows.Next() {
-		var selection common.Selection
-		// Use sql.NullString for nullable fields
-		var selectionName, eventName, eventDate, eventTime, raceDistance, raceCategory, trackCondition, numberOfRunners, raceTrack, raceClass sql.NullString
-
-		err := rows.Scan(
-			&selection.ID,
-			&selectionName,
-			&eventName,
-			&eventDate,
-			&eventTime,
-			&raceDistance,
-			&raceCategory,
-			&trackCondition,
-			&numberOfRunners,
-			&raceTrack,
-			&raceClass,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		if selection.ID == 0 {
+	for _, runner := range runners {
+		if runner.ID == 0 {
 			continue
 		}
-		// Convert sql.NullString to regular strings
-		selection.Name = nullableToString(selectionName)
-		selection.EventName = nullableToString(eventName)
-		selection.EventDate = nullableToString(eventDate)
-		selection.EventTime = nullableToString(eventTime)
-		selection.RaceDistance = nullableToString(raceDistance)
-		selection.RaceCategory = nullableToString(raceCategory)
-		selection.TrackCondition = nullableToString(trackCondition)
-		selection.NumberOfRunners = nullableToString(numberOfRunners)
-		selection.RaceTrack = nullableToString(raceTrack)
-		selection.RaceClass = nullableToString(raceClass)
-		selections = append(selections, selection)
-
+		selections = append(selections, runner)
 	}
+
 	raceConditon := models.RaceConditon{}
 	if len(selections) > 0 {
 		raceConditon = models.RaceConditon{
@@ -153,124 +66,37 @@ func GetMeetingRunners(c *gin.Context) {
 			NumberOfRunners: selections[0].NumberOfRunners,
 			RaceTrack:       selections[0].RaceTrack,
 			RaceClass:       selections[0].RaceClass,
+			Going:           going.Normalise(selections[0].TrackCondition),
 		}
 	}
 	analysisDataResponse.RaceConditon = raceConditon
 
+	var analysisData []models.AnalysisData
 	for _, selection := range selections {
-
-		// Execute the query
-		rows, err = db.Query(`
-						SELECT
-							COALESCE(selection_id, 0),
-							selection_name,	
-							substr(position, 1, 1) as positon, 
-							Age,
-							Trainer,
-							Sex,
-							Sire,
-							Dam,
-							Owner,						
-							COUNT(*) AS num_runs,
-							MAX(race_date) AS last_run_date,
-							MAX(race_date) - MIN(race_date) AS duration,
-							 COUNT(CASE WHEN position = '1' THEN 1 END) AS win_count,
-							AVG(position) AS avg_position,
-							AVG(rating) AS avg_rating,
-							AVG(distance) AS avg_distance_furlongs,
-							AVG(sp_odds) AS sp_odds,
-							GROUP_CONCAT(position, ', ') AS all_positions,
-							GROUP_CONCAT(distance, ', ') AS all_distances,
-							GROUP_CONCAT(racecourse, ', ') AS all_racecources,
-							GROUP_CONCAT(DATE(race_date), ', ') AS all_race_dates 
-						FROM
-							SelectionsForm	WHERE selection_id = ?  order by race_date desc`, selection.ID)
+		data, err := h.repos.Form.Summary(c, selection.ID, asOf)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		defer rows.Close()
-
-		// Loop through the rows and append the results to the slice
-		var data models.AnalysisData
-		noData := false
-
-		for rows.Next() {
-			noData = false
-			err := rows.Scan(
-				&data.SelectionID,
-				&data.SelectionName,
-				&data.Position,
-				&data.Age,
-				&data.Trainer,
-				&data.Sex,
-				&data.Sire,
-				&data.Dam,
-				&data.Owner,
-				&data.NumRuns,
-				&data.LastRunDate,
-				&data.Duration,
-				&data.WinCount,
-				&data.AvgPosition,
-				&data.AvgRating,
-				&data.AvgDistanceFurlongs,
-				&data.AvgOdds,
-				&data.AllPositions,
-				&data.AllDistances,
-				&data.AllCources,
-				&data.AllRaceDates,
-			)
-			if err != nil {
-				noData = true
-				continue
-			}
-		}
-		if !noData {
-
-			winLose, err := getRaceResult(rows, err, db, eventDate, c, selection.ID)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-
-			data.WinLose = winLose
-
-			analysisData = append(analysisData, data)
-
-		}
-
-	}
-
-	for i, data := range analysisData {
-
-		recoveryDays, err := getRecoveryDays(data.SelectionID, eventDate)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+		if data.SelectionID == 0 {
+			continue
 		}
-		analysisData[i].RecoveryDays = recoveryDays
-
-		// Get Analysis trend
+		data.GoingForm = going.Form(data.Features, selection.TrackCondition)
+		data.CurrentDistance = racing.ParseDistance(selection.RaceDistance)
+		data.CurrentCourse = features.RaceCourse(selection)
+		data.CourseDistance = features.CourseDistance(data.Features, data.CurrentCourse, data.CurrentDistance, tolerance)
 
-		dates := strings.Split(data.AllRaceDates, ",")
-		distances := strings.Split(data.AllDistances, ",")
-		positions := strings.Split(data.AllPositions, ",")
-		events := strings.Split(data.AllCources, ",")
-		selectionForm, err := parseData(dates, distances, positions, events)
+		data.WinLose, err = h.repos.Form.ResultOn(c, selection.ID, eventDate)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		analysis := analyzeTrends(selectionForm)
-		analysisData[i].TrendAnalysis = analysis
-
+		analysisData = append(analysisData, data)
 	}
 
-	// Check for errors from iterating over rows.
-	if err = rows.Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	for i, data := range analysisData {
+		analysisData[i].TrendAnalysis = analyzeTrends(raceData(data.Features))
 	}
 
 	// Sorting logic
@@ -305,95 +131,6 @@ func GetMeetingRunners(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"analysisDataResponse": analysisDataResponse})
 }
 
-func getRaceResult(rows *sql.Rows, err error, db *sql.DB, eventDate string, c *gin.Context, selectionID int) (models.WinLose, error) {
-	rows, err = db.Query(`
-		SELECT 	selection_id,
-				selection_name,
-				race_date,
-				SUBSTR(position, 1, INSTR(position, '/') - 1) as postion
-		FROM SelectionsForm
-		WHERE DATE(race_date) = ? and selection_id = ?`, eventDate, selectionID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return models.WinLose{}, err
-	}
-	defer rows.Close()
-	var data models.WinLose
-	for rows.Next() {
-		err := rows.Scan(
-			&data.SelectionID,
-			&data.SelectionName,
-			&data.EventDate,
-			&data.Position,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return models.WinLose{}, err
-		}
-
-	}
-	return data, nil
-}
-
-func getRecoveryDays(selectionID int, eventDate string) (float64, error) {
-	db := database.Database.DB
-
-	// Execute the query with WITH daysSince as subquery
-	rows, err := db.Query(`
-		select 	race_date, 
-				selection_id from   
-		SelectionsForm where selection_id = ? 
-		order by race_date DESC limit 2;
-	`, selectionID)
-
-	if err != nil {
-		return 0, err
-	}
-	defer rows.Close()
-
-	var daysSince []DaySince
-
-	// Iterate over the rows and scan the result into the DaySince struct
-	for rows.Next() {
-		var race DaySince
-		err := rows.Scan(
-			&race.RaceDate,
-			&race.SelectionID,
-		)
-		if err != nil {
-			return 0, err
-		}
-		daysSince = append(daysSince, race)
-	}
-
-	// Check for errors after iterating through the rows
-	if err = rows.Err(); err != nil {
-		return 0, err
-	}
-
-	// Calculate the difference between the two dates, if there are at least 2 races
-	if len(daysSince) == 2 {
-		// Normalize dates by removing the time component
-		var lastRunDate time.Time
-		if eventDate == time.Now().Format("2006-01-02") {
-			lastRunDate = time.Date(daysSince[0].RaceDate.Year(), daysSince[0].RaceDate.Month(), daysSince[0].RaceDate.Day(), 0, 0, 0, 0, time.UTC)
-		} else {
-			lastRunDate = time.Date(daysSince[1].RaceDate.Year(), daysSince[1].RaceDate.Month(), daysSince[1].RaceDate.Day(), 0, 0, 0, 0, time.UTC)
-		}
-
-		date, err := time.Parse("2006-01-02", eventDate)
-		if err != nil {
-			return 0.0, err
-		}
-		dateDiff := date.Sub(lastRunDate).Hours() / 24
-
-		return math.Abs(dateDiff), nil
-	}
-
-	// If there is only one race or none, we cannot calculate a meaningful difference
-	return 0, nil
-}
-
 // analyzeTrends analyzes the race data and returns an AnalyzeTrends struct with the results
 func analyzeTrends(raceData []models.RaceData) models.AnalyzeTrends {
 	var bestDistances []float64
@@ -421,30 +158,24 @@ func analyzeTrends(raceData []models.RaceData) models.AnalyzeTrends {
 	}
 }
 
-func parseData(dates, distances, positions, events []string) ([]models.RaceData, error) {
-	var raceData []models.RaceData
-
-	for i := range dates {
-		date, err := time.Parse("2006-01-02", strings.TrimSpace(dates[i]))
+// raceData lists a horse's runs from its features, most recent first.
+// Non-finishers have position 0.
+func raceData(f models.RunnerFeatures) []models.RaceData {
+	var races []models.RaceData
+	for i, position := range f.Positions {
+		date, err := time.Parse(racing.EventDateLayout, f.RaceDates[i])
 		if err != nil {
-			return nil, err
+			continue
 		}
-
-		var distance float64
-		fmt.Sscanf(distances[i], "%f", &distance)
-
-		var position int
-		fmt.Sscanf(positions[i], "%d", &position)
-
-		raceData = append(raceData, models.RaceData{
+		pos, _, _ := features.ParsePosition(position)
+		races = append(races, models.RaceData{
 			Date:     date,
-			Distance: distance,
-			Position: position,
-			Event:    events[i],
+			Distance: f.Distances[i],
+			Position: pos,
+			Event:    f.Courses[i],
 		})
 	}
-
-	return raceData, nil
+	return races
 }
 
 // Calculate average of a slice of floats
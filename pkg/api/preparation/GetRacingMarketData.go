@@ -1,253 +1,151 @@
 package preparation
 
 import (
-	"database/sql"
+	"context"
+	"fmt"
 	"net/http"
-	"regexp"
-	"strconv"
-	"strings"
-	"time"
+	"sync"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
-	"github.com/gocolly/colly"
-	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/ingest"
+	"github.com/mmanjoura/race-picks-backend/pkg/jobs"
 	"github.com/mmanjoura/race-picks-backend/pkg/models"
 )
 
-func GetRacingMarketData(c *gin.Context) {
-	db := database.Database.DB
-	
-
+func (h *Handler) GetRacingMarketData(c *gin.Context) {
 	type EventDate struct {
 		RaceDate string `json:"race_date"`
 	}
 
 	var eventDate EventDate
 
-
-
 	// Bind JSON input to optimalParams
 	if err := c.ShouldBindJSON(&eventDate); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// todayRunners, err := getTodayRunners()
-	todayRunners, err := updateSelectionsData(db, c, eventDate.RaceDate)
+	raceDate := eventDate.RaceDate
+	jobID, err := jobs.Submit(c, "GetRacingMarketData", func(ctx context.Context, progress *jobs.Progress) (interface{}, error) {
+		if err := h.IngestRacingMarketData(ctx, raceDate, progress); err != nil {
+			return nil, err
+		}
+		return gin.H{"message": "Horse information saved successfully"}, nil
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
 		return
 	}
-	for _, todayRunner := range todayRunners {
-
-		// Save horse information to DB
-		result, err := db.ExecContext(c, `
-		INSERT INTO EventRunners (
-			selection_link,
-			selection_id,
-			event_link,
-			selection_name,	
-			event_time,
-			event_name,
-			price,		
-			event_date,
-			race_distance,
-			race_category,
-			track_condition,
-			number_of_runners,
-			race_track,
-			race_class,
-			created_at
-		)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			todayRunner.SelectionLink, // Include the selection link
-			todayRunner.SelectionID,
-			todayRunner.EventLink,
-			todayRunner.SelectionName,
-			todayRunner.EventTime,
-			todayRunner.EventName,
-			todayRunner.Price,
-			time.Now(),
-			todayRunner.RaceConditon.RaceDistance,
-			todayRunner.RaceConditon.RaceCategory,
-			todayRunner.RaceConditon.TrackCondition,
-			todayRunner.RaceConditon.NumberOfRunners,
-			todayRunner.RaceConditon.RaceTrack,
-			todayRunner.RaceConditon.RaceClass,
-			time.Now())
-		_ = result // Ignore the result if not needed
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+
+	c.JSON(http.StatusAccepted, gin.H{"job_id": jobID})
+}
+
+// IngestRacingMarketData fills in the race conditions of the runners declared
+// for raceDate and scrapes the form of each of them. When no runner has been
+// declared for raceDate yet, the day's racecards are read from the source
+// first. A runner that fails is reported to progress and skipped; the error
+// returned counts the failures.
+func (h *Handler) IngestRacingMarketData(ctx context.Context, raceDate string, progress *jobs.Progress) error {
+	todayRunners, err := h.pendingRunners(ctx, raceDate)
+	if err != nil {
+		return err
 	}
+	progress.SetTotal(len(todayRunners))
 
-	for _, todayRunner := range todayRunners {
+	pool := h.newScrapePool()
+	conditions := &raceConditions{races: make(map[string]*raceConditionsFetch)}
 
-		err = SaveSelectionsForm(db, c, todayRunner.SelectionID, todayRunner.SelectionLink, todayRunner.SelectionName)
+	var failed int32
+	err = pool.Run(ctx, len(todayRunners), func(ctx context.Context, i int) error {
+		return h.ingestRunner(ctx, pool, conditions, todayRunners[i])
+	}, func(i int, err error) {
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			atomic.AddInt32(&failed, 1)
+			progress.Fail(todayRunners[i].SelectionID, todayRunners[i].SelectionName, err)
 			return
 		}
+		progress.Done()
+	})
+	if err != nil {
+		return err
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Horse information saved successfully"})
-
+	if failed > 0 {
+		return fmt.Errorf("%d of %d runners failed", failed, len(todayRunners))
+	}
+	return nil
 }
 
-func getTodayRunners() ([]models.TodayRunners, error) {
-	// Initialize the collector
-	c := colly.NewCollector()
-
-	// Slice to store all horse information
-	horses := []models.TodayRunners{}
-
-	// On HTML element
-	c.OnHTML("table.AbcTable__TableContent-sc-9z9a8v-3 tbody tr", func(e *colly.HTMLElement) {
-		name := e.ChildText("td:nth-child(1) a")
-		selectionLink := e.ChildAttr("td:nth-child(1) a", "href") // Get the href attribute
-		event := e.ChildText("td:nth-child(3) a")
-		eventLink := e.ChildAttr("td:nth-child(3) a", "href") // Get the href attribute
-		price := e.ChildText("th:nth-child(5) span")
-
-		parts := strings.SplitN(event, " ", 2)
-		eventTime := parts[0]
-		eventName := parts[1]
-
-		// Compile the regular expression to match digits at the end of the string
-		re := regexp.MustCompile(`/horse/(\d+)$`)
-
-		// Find the substring that matches the pattern and extract the horse_Id
-		match := re.FindStringSubmatch(selectionLink)
-		selectionId := 0
-		if len(match) > 1 {
-			selectionId, _ = strconv.Atoi(match[1])
-
-		}
-		horse := models.TodayRunners{
-			SelectionName: name,
-			SelectionLink: selectionLink, // Add the selection link to the struct
-			EventLink:     eventLink,     // Add the event link to the struct
-			EventTime:     eventTime,
-			EventName:     eventName,
-			Price:         price,
-			SelectionID:   selectionId,
+// ingestRunner scrapes the race conditions of one runner, stores them in
+// EventRunners and saves the runner's form. A declared runner's own row is
+// updated rather than a second one added.
+func (h *Handler) ingestRunner(ctx context.Context, pool *ingest.Pool, conditions *raceConditions, todayRunner models.TodayRunners) error {
+	// Runners read from the racecards come with their conditions
+	if todayRunner.RaceConditon.RaceDistance == "" {
+		raceConditon, err := conditions.get(todayRunner.EventLink, func() (models.RaceConditon, error) {
+			var raceConditon models.RaceConditon
+			err := pool.Fetch(ctx, todayRunner.EventLink, func() error {
+				var err error
+				raceConditon, err = h.source.RaceConditions(todayRunner.EventLink)
+				return err
+			})
+			return raceConditon, err
+		})
+		if err != nil {
+			return err
 		}
+		todayRunner.RaceConditon = raceConditon
+	}
 
-		reaceConditons := getEventConditons(eventLink)
-		horse.RaceConditon = reaceConditons
-
-		horses = append(horses, horse)
-	})
-
-	// Start scraping the URL
-	c.Visit("https://www.sportinglife.com/racing/abc-guide/abc-guide")
+	// Save horse information to DB
+	if err := h.repos.Runners.Save(ctx, todayRunner); err != nil {
+		return err
+	}
 
-	return horses, nil
+	return h.SaveSelectionsForm(ctx, pool, todayRunner.SelectionID, todayRunner.SelectionLink, todayRunner.SelectionName)
 }
 
-func getEventConditons(eventLink string) models.RaceConditon {
-	// Initialize the collector
-	c := colly.NewCollector()
-	raceConditons := models.RaceConditon{}
-
-	// Define variables to hold extracted values
-	var raceCategory, raceDistance, trackCondition, numberOfRunners, raceClass, raceTrack string
-
-	// Set the HTML selector and processing logic
-	c.OnHTML("li.RacingRacecardSummary__StyledAdditionalInfo-sc-1intsbr-2", func(e *colly.HTMLElement) {
-		// Extract the text from the HTML element
-		content := e.Text
-
-		// Split the content by '|'
-		parts := strings.Split(content, "|")
-
-		// Trim whitespace from each part
-		for i := range parts {
-			parts[i] = strings.TrimSpace(parts[i])
-		}
-
-		if len(parts) == 6 {
-
-			raceCategory = parts[0]
-			raceClass = parts[1]
-			raceDistance = parts[2]
-			trackCondition = parts[3]
-			numberOfRunners = parts[4]
-			raceTrack = parts[5]
-
-		}
-		if len(parts) == 5 {
-			raceCategory = parts[0]
-			raceDistance = parts[1]
-			trackCondition = parts[2]
-			numberOfRunners = parts[3]
-			raceTrack = parts[4]
-
-		}
-
-		raceConditons = models.RaceConditon{
-
-			RaceCategory:    raceCategory,
-			RaceClass:       raceClass,
-			RaceDistance:    raceDistance,
-			TrackCondition:  trackCondition,
-			NumberOfRunners: numberOfRunners,
-			RaceTrack:       raceTrack,
-		}
-
-	})
-
-	// Visit the URL
-	c.Visit("https://www.sportinglife.com" + eventLink)
+// pendingRunners returns the runners of raceDate still to be ingested: the
+// declared ones without race conditions or, if none has been declared, the
+// day's racecards.
+func (h *Handler) pendingRunners(ctx context.Context, raceDate string) ([]models.TodayRunners, error) {
+	declared, err := h.repos.Runners.ByDate(ctx, raceDate)
+	if err != nil {
+		return nil, err
+	}
+	if len(declared) > 0 {
+		return h.repos.Runners.Pending(ctx, raceDate)
+	}
 
-	return raceConditons
+	return h.source.Racecards(raceDate)
 }
 
-func updateSelectionsData(db *sql.DB, c *gin.Context, raceDate string) ([]models.TodayRunners, error) {
-
-	horses := []models.TodayRunners{}
-
-	// get the selection link from the database
-
-	// Query for today's runners
-	rows, err := db.Query(`
-			SELECT selection_name, selection_link, event_link, event_time, event_name, price, selection_id
-			FROM EventRunners where event_link not null and race_distance is null and DATE(event_date) = ?;`, raceDate)
-
-	for rows.Next() {
-		var name, selectionLink, eventLink, eventTime, eventName, price sql.NullString
-		var selectionId int
-		err := rows.Scan(&name, &selectionLink, &eventLink, &eventTime, &eventName, &price, &selectionId)
-
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return horses, err
-		}
-		defer rows.Close()
-
-		horse := models.TodayRunners{
-			SelectionName: nullableToString(name),
-			SelectionLink: nullableToString(selectionLink), // Add the selection link to the struct
-			EventLink:     nullableToString(eventLink),     // Add the event link to the struct
-			EventTime:     nullableToString(eventTime),
-			EventName:     nullableToString(eventName),
-			Price:         nullableToString(price),
-			SelectionID:   selectionId,
-		}
-
-		reaceConditons := getEventConditons(nullableToString(eventLink))
-
-		horse.RaceConditon = reaceConditons
+// raceConditions fetches the conditions of each race once per ingest, however
+// many of its runners are scraped. Runners of a race arriving while its
+// conditions are being fetched wait for that fetch.
+type raceConditions struct {
+	mu    sync.Mutex
+	races map[string]*raceConditionsFetch
+}
 
-		horses = append(horses, horse)
-	}
+type raceConditionsFetch struct {
+	once       sync.Once
+	conditions models.RaceConditon
+	err        error
+}
 
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return horses, err
+func (c *raceConditions) get(eventLink string, fetch func() (models.RaceConditon, error)) (models.RaceConditon, error) {
+	c.mu.Lock()
+	race, ok := c.races[eventLink]
+	if !ok {
+		race = &raceConditionsFetch{}
+		c.races[eventLink] = race
 	}
-	defer rows.Close()
+	c.mu.Unlock()
 
-	return horses, nil
+	race.once.Do(func() {
+		race.conditions, race.err = fetch()
+	})
+	return race.conditions, race.err
 }
@@ -0,0 +1,100 @@
+package preparation
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/ingest"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/racedata"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+)
+
+// newTestHandler returns a handler on a migrated in-memory database that
+// reads race data from the fixtures in testdata.
+func newTestHandler(t *testing.T) (*Handler, repository.Repositories, *sql.DB) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if _, err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	repos := repository.New(db, database.NewWriter(db))
+	source := racedata.NewFixture("testdata/fixtures")
+	return NewHandler(repos, source, t.TempDir(), ingest.Options{Workers: 2, Delay: time.Millisecond}), repos, db
+}
+
+func TestIngestRacingMarketDataFromRacecards(t *testing.T) {
+	ctx := context.Background()
+	h, repos, _ := newTestHandler(t)
+
+	if err := h.IngestRacingMarketData(ctx, "2024-06-01", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	runners, err := repos.Runners.ByDate(ctx, "2024-06-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runners) != 2 {
+		t.Fatalf("declared %d runners, want 2", len(runners))
+	}
+	for _, runner := range runners {
+		if runner.RaceDistance != "1m" || runner.TrackCondition != "Good" {
+			t.Errorf("%s: conditions %q, %q; want 1m, Good", runner.Name, runner.RaceDistance, runner.TrackCondition)
+		}
+	}
+
+	data, err := repos.Form.Summary(ctx, 1, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.NumRuns != 2 || data.WinCount != 1 || data.Trainer != "J Smith" {
+		t.Fatalf("Alpha: %d runs, %d wins, trainer %q; want 2, 1, J Smith", data.NumRuns, data.WinCount, data.Trainer)
+	}
+}
+
+// countingSource counts the race conditions fetched through it.
+type countingSource struct {
+	racedata.RaceDataSource
+	conditions int32
+}
+
+func (s *countingSource) RaceConditions(eventLink string) (models.RaceConditon, error) {
+	atomic.AddInt32(&s.conditions, 1)
+	return s.RaceDataSource.RaceConditions(eventLink)
+}
+
+func TestIngestRacingMarketDataFetchesEachRaceOnce(t *testing.T) {
+	ctx := context.Background()
+	h, _, db := newTestHandler(t)
+	source := &countingSource{RaceDataSource: h.source}
+	h.source = source
+
+	// Two runners of one race declared without their conditions
+	_, err := db.Exec(`
+		INSERT INTO EventRunners (selection_id, selection_name, selection_link, event_link, event_name, event_time, event_date)
+		VALUES
+			(1, 'Alpha', '/racing/profiles/horse/1', '/racing/racecards/2024-06-01/ascot/racecard/100', 'Ascot', '14:00', '2024-06-01 00:00:00'),
+			(2, 'Bravo', '/racing/profiles/horse/2', '/racing/racecards/2024-06-01/ascot/racecard/100', 'Ascot', '14:00', '2024-06-01 00:00:00')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.IngestRacingMarketData(ctx, "2024-06-01", nil); err != nil {
+		t.Fatal(err)
+	}
+	if source.conditions != 1 {
+		t.Fatalf("fetched the race's conditions %d times, want 1", source.conditions)
+	}
+}
@@ -1,47 +1,60 @@
 package preparation
 
 import (
+	"context"
+	"fmt"
+	"log"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
-
-	"github.com/mmanjoura/race-picks-backend/pkg/database"
-	"github.com/mmanjoura/race-picks-backend/pkg/models"
 )
 
-func GetRacingMarketWinners(c *gin.Context) {
-	db := database.Database.DB
+// GetRacingMarketWinners ingests the results of the races run on the date
+// query parameter, yesterday by default.
+func (h *Handler) GetRacingMarketWinners(c *gin.Context) {
+	raceDate := c.DefaultQuery("date", time.Now().AddDate(0, 0, -1).Format("2006-01-02"))
+	if _, err := time.Parse("2006-01-02", raceDate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date must be YYYY-MM-DD"})
+		return
+	}
 
-	currentTime := time.Now()
-	// Subtract one day to get the day before
-	dayBefore := currentTime.AddDate(0, 0, -1)
-	// Format the date as YYYY-MM-DD
-	formattedDate := dayBefore.Format("2006-01-02")
-	rows, err := db.Query(`select selection_id, selection_link, selection_name from EventRunners WHERE  DATE(event_date) = ?`, formattedDate)
-	if err != nil {
+	if err := h.IngestRacingMarketWinners(c, raceDate); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"message": "postion updated successfully"})
+}
 
-	selections := []models.Selection{}
-	for rows.Next() {
-		var selection models.Selection
-		err := rows.Scan(&selection.ID, &selection.Link, &selection.Name)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		selections = append(selections, selection)
+// IngestRacingMarketWinners scrapes the latest form of the runners of
+// raceDate (YYYY-MM-DD) so their finishing positions land in SelectionsForm.
+// A runner that fails is logged and skipped; the error returned counts the
+// failures.
+func (h *Handler) IngestRacingMarketWinners(ctx context.Context, raceDate string) error {
+	selections, err := h.repos.Runners.Selections(ctx, raceDate)
+	if err != nil {
+		return err
 	}
-	defer rows.Close()
 
-	for _, selection := range selections {
-		err = SaveSelectionsForm(db, c, selection.ID, selection.Link, selection.Name)
+	pool := h.newScrapePool()
+
+	var failed int32
+	err = pool.Run(ctx, len(selections), func(ctx context.Context, i int) error {
+		selection := selections[i]
+		return h.SaveSelectionsForm(ctx, pool, selection.ID, selection.Link, selection.Name)
+	}, func(i int, err error) {
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			atomic.AddInt32(&failed, 1)
+			log.Printf("GetRacingMarketWinners: %s (%d): %v", selections[i].Name, selections[i].ID, err)
 		}
+	})
+	if err != nil {
+		return err
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "postion updated successfully"})
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d runners failed", failed, len(selections))
+	}
+	return nil
 }
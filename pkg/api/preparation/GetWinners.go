@@ -1,146 +1,73 @@
 package preparation
 
 import (
-	"database/sql"
 	"errors"
 	"net/http"
 	"strconv"
-	"strings"
 
-	"github.com/mmanjoura/race-picks-backend/pkg/database"
-	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/predict"
+	"github.com/mmanjoura/race-picks-backend/pkg/strategy"
+	"github.com/mmanjoura/race-picks-backend/pkg/value"
 
 	"github.com/gin-gonic/gin"
 )
 
-func MeetingWinners(c *gin.Context) {
-	db := database.Database.DB
-
-	var racePrdictions []models.SelectionResult
+// MeetingWinners returns the day's bets: in each race, the stored pick of
+// the model with the best expected value, if any has an edge over its
+// price or BSP of more than min_edge percentage points after commission.
+// A strategy query parameter first narrows the picks to those the named
+// strategy bets on.
+func (h *Handler) MeetingWinners(c *gin.Context) {
 
 	//  const response = await axios.get(`${baseURL}/preparation/GetWinners?event_date=` + selectedDate, {
 
 	// Query for today's runners
 	todayDate := c.Query("event_date")
+	model := c.DefaultQuery("model", predict.DefaultModel)
 
-	rows, err := db.Query(`
-		SELECT selection_id,
-			clean_bet_score,
-			average_position,
-			average_rating,
-			event_name,
-			event_date,
-			event_time,
-			selection_name,
-			odds
-		From RaceStatistics where DATE(event_date) = ?;`, todayDate)
-
+	minEdge, err := strconv.ParseFloat(c.DefaultQuery("min_edge", "0"), 64)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_edge: " + err.Error()})
 		return
 	}
-
-	defer rows.Close()
-
-	var eventName, totalScore, avgPosition, avgRating, eventDate, eventTime, selectionName, odds sql.NullString
-
-	for rows.Next() {
-		racePrdiction := models.SelectionResult{}
-		err := rows.Scan(
-			&racePrdiction.SelectionID,
-			&totalScore,
-			&avgPosition,
-			&avgRating,
-			&eventName,
-			&eventDate,
-			&eventTime,
-			&selectionName,
-			&odds,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		totalScoreFloat, err := strconv.ParseFloat(nullableToString(totalScore), 64)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		racePrdiction.TotalScore = totalScoreFloat
-		avgPositionFloat, err := strconv.ParseFloat(nullableToString(avgPosition), 64)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		racePrdiction.AvgPosition = avgPositionFloat
-		avgRatingFloat, err := strconv.ParseFloat(nullableToString(avgRating), 64)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		racePrdiction.AvgRating = avgRatingFloat
-		racePrdiction.EventName = nullableToString(eventName)
-		racePrdiction.EventDate = nullableToString(eventDate)
-		racePrdiction.EventTime = nullableToString(eventTime)
-		racePrdiction.SelectionName = nullableToString(selectionName)
-		racePrdiction.Odds = nullableToString(odds)
-
-		racePrdictions = append(racePrdictions, racePrdiction)
+	commission, err := strconv.ParseFloat(c.DefaultQuery("commission", strconv.FormatFloat(value.DefaultCommission, 'f', -1, 64)), 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "commission: " + err.Error()})
+		return
 	}
 
-	var todayBets []models.SelectionResult
-	var selectionTime string
-	for i := 0; i < len(racePrdictions); i++ {
-
-		odds, err := calculateOdds(racePrdictions[i].Odds)
-		if err != nil {
-			if err.Error() == "Invalid input" {
-				continue
-			}
-		}
-
-		// we only want to bet on selections with odds between 10 and 20
-		if odds < 20 && odds > 10 {
-			if racePrdictions[i].EventTime == selectionTime {
-				continue
-			}
-			todayBets = append(todayBets, racePrdictions[i])
-			selectionTime = racePrdictions[i].EventTime
-		}
+	strat, err := strategy.Resolve(c, h.repos.Strategies, c.Query("strategy"))
+	var unknown *strategy.UnknownStrategyError
+	if errors.As(err, &unknown) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-
-
-	// Return the meeting data
-	c.JSON(http.StatusOK, gin.H{"predictions": todayBets})
-}
-
-func calculateOdds(input string) (float64, error) {
-
-	// Split the input string by "/"
-	parts := strings.Split(input, "/")
-	if len(parts) != 2 {
-		return 0, errors.New("Invalid input")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	// Convert the string parts to float64 numbers
-	numerator, err := strconv.ParseFloat(parts[0], 64)
+	racePrdictions, err := h.repos.Predictions.ForDate(c, todayDate, model, "")
 	if err != nil {
-		return 0, err
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	denominator, err := strconv.ParseFloat(parts[1], 64)
+	runners, err := h.repos.Runners.ByDate(c, todayDate)
 	if err != nil {
-		return 0, err
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
+	racePrdictions = strategy.Select(strat.Rules, racePrdictions, runners)
 
-	// Perform the division
-	if denominator == 0 {
-		return 0, errors.New("Division by zero")
+	bsp, err := value.LoadBSP(c, h.repos.MarketData, todayDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	result := numerator / denominator
+	todayBets := value.Best(value.Assess(racePrdictions, bsp, value.Options{MinEdge: minEdge, Commission: commission}))
 
-	
-	return result, nil
+	// Return the meeting data
+	c.JSON(http.StatusOK, gin.H{"predictions": todayBets})
 }
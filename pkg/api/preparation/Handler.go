@@ -0,0 +1,21 @@
+package preparation
+
+import (
+	"github.com/mmanjoura/race-picks-backend/pkg/ingest"
+	"github.com/mmanjoura/race-picks-backend/pkg/racedata"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+)
+
+// Handler serves the preparation routes and runs the ingest they start.
+type Handler struct {
+	repos   repository.Repositories
+	source  racedata.RaceDataSource
+	dataDir string
+	scrape  ingest.Options
+}
+
+// NewHandler returns a handler storing downloaded market data in dataDir.
+// Ingest reads race data from source with the scrape options.
+func NewHandler(repos repository.Repositories, source racedata.RaceDataSource, dataDir string, scrape ingest.Options) *Handler {
+	return &Handler{repos: repos, source: source, dataDir: dataDir, scrape: scrape}
+}
@@ -0,0 +1,84 @@
+package preparation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/race-picks-backend/pkg/jobs"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+)
+
+// RebuildFeatures recomputes the feature store from every stored run in
+// the background. Ingest keeps it up to date and BackfillFeatures refreshes
+// stale rows at startup; this rebuilds it after the way features are
+// computed changes.
+func (h *Handler) RebuildFeatures(c *gin.Context) {
+	jobID, err := jobs.Submit(c, "RebuildFeatures", func(ctx context.Context, progress *jobs.Progress) (interface{}, error) {
+		rebuilt, err := RebuildFeatures(ctx, h.repos, progress)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{"selections": rebuilt}, nil
+	})
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job_id": jobID})
+}
+
+// RebuildFeatures recomputes the features of every horse with stored runs
+// and returns how many it rebuilt. A horse that fails is reported to
+// progress and skipped; the error returned counts the failures.
+func RebuildFeatures(ctx context.Context, repos repository.Repositories, progress *jobs.Progress) (int, error) {
+	ids, err := repos.Features.SelectionIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return refreshFeatures(ctx, repos, ids, progress)
+}
+
+// BackfillFeatures submits a job refreshing the horses whose features are
+// stale, such as form saved before the store or its going columns existed,
+// and returns its ID. It returns 0 when there is nothing to refresh.
+func BackfillFeatures(ctx context.Context, repos repository.Repositories) (int64, error) {
+	ids, err := repos.Features.Stale(ctx)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	return jobs.Submit(ctx, "BackfillFeatures", func(ctx context.Context, progress *jobs.Progress) (interface{}, error) {
+		rebuilt, err := refreshFeatures(ctx, repos, ids, progress)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{"selections": rebuilt}, nil
+	})
+}
+
+// refreshFeatures rebuilds the features of the horses in ids.
+func refreshFeatures(ctx context.Context, repos repository.Repositories, ids []int, progress *jobs.Progress) (int, error) {
+	progress.SetTotal(len(ids))
+
+	var rebuilt int
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return rebuilt, err
+		}
+		if err := repos.Features.Refresh(ctx, id, time.Time{}); err != nil {
+			progress.Fail(id, "", err)
+			continue
+		}
+		rebuilt++
+		progress.Done()
+	}
+
+	if failed := len(ids) - rebuilt; failed > 0 {
+		return rebuilt, fmt.Errorf("%d of %d selections failed", failed, len(ids))
+	}
+	return rebuilt, nil
+}
@@ -9,9 +9,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
-	"time"
 
-	"github.com/mmanjoura/race-picks-backend/pkg/database"
 	"github.com/mmanjoura/race-picks-backend/pkg/models"
 
 	"github.com/gin-gonic/gin"
@@ -25,11 +23,10 @@ import (
 // @Produce  json
 // @Success 200 {object} models.MarketData
 // @Router /analytics/save-market-data [get]
-func SaveMarketData(c *gin.Context) {
+func (h *Handler) SaveMarketData(c *gin.Context) {
 
-	sourcePath := "./data/"
+	sourcePath := h.dataDir + "/"
 	dir, _ := os.Open(sourcePath)
-	db := database.Database.DB
 
 	//Get list of files in dir
 	files, _ := dir.Readdir(-1)
@@ -44,53 +41,7 @@ func SaveMarketData(c *gin.Context) {
 			return
 		}
 
-		for _, newAnalytic := range analytics {
-
-			_, err = db.ExecContext(c, `
-				INSERT INTO MarketData (
-					event_id,
-					menu_hint,
-					event_name,
-					event_dt,
-					selection_id,
-					selection_name,
-					win_lose,
-					bsp,
-					ppwap,
-					morning_wap,
-					ppmax,
-					ppmin,
-					ipmax,
-					ipmin,
-					morning_traded_vol,
-					pp_traded_vol,
-					ip_traded_vol,
-					created_at,
-					updated_at
-				)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-				newAnalytic.EventID,
-				newAnalytic.MenuHint,
-				newAnalytic.EventName,
-				newAnalytic.EventDT,
-				newAnalytic.SelectionID,
-				newAnalytic.SelectionName,
-				newAnalytic.WinLose,
-				newAnalytic.BSP,
-				newAnalytic.PPWAP,
-				newAnalytic.MorningWAP,
-				newAnalytic.PPMax,
-				newAnalytic.PPMin,
-				newAnalytic.IPMax,
-				newAnalytic.IPMin,
-				newAnalytic.MorningTradedVol,
-				newAnalytic.PPTradedVol,
-				newAnalytic.IPTradedVol,
-				time.Now(),
-				time.Now())
-
-		}
-		if err != nil {
+		if err := h.repos.MarketData.Insert(c, analytics); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error storing data": err.Error()})
 			return
 		}
@@ -1,114 +1,78 @@
 package preparation
 
 import (
-	"database/sql"
+	"context"
+	"fmt"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
-	"github.com/gocolly/colly"
-	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/jobs"
 	"github.com/mmanjoura/race-picks-backend/pkg/models"
 )
 
-// Mutex for controlling database access
-// var dbMutex sync.Mutex
-
-func UpdateSelectionsInfo(c *gin.Context) {
-	db := database.Database.DB
-
-	// Get all Selections from eventRunners table
-	rows, err := db.Query(`select selection_id, selection_link from EventRunners`)
+// UpdateSelectionsInfo refreshes the profiles of the runners declared on the
+// date query parameter, or of every runner without one.
+func (h *Handler) UpdateSelectionsInfo(c *gin.Context) {
+	raceDate := c.Query("date")
+	jobID, err := jobs.Submit(c, "UpdateSelectionsInfo", func(ctx context.Context, progress *jobs.Progress) (interface{}, error) {
+		if err := h.UpdateSelectionsProfiles(ctx, raceDate, progress); err != nil {
+			return nil, err
+		}
+		return gin.H{"message": "Horse information saved successfully"}, nil
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
 
-	selections := []models.Selection{}
-	for rows.Next() {
-		var selection models.Selection
-		if err := rows.Scan(&selection.ID, &selection.Link); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		selections = append(selections, selection)
+	c.JSON(http.StatusAccepted, gin.H{"job_id": jobID})
+}
+
+// UpdateSelectionsProfiles copies the age, trainer, sex, sire, dam and owner
+// of the runners declared for raceDate (YYYY-MM-DD, "" for every runner in
+// EventRunners) onto their SelectionsForm rows and stored features. A runner
+// that fails is reported to progress and skipped; the error returned counts
+// the failures.
+func (h *Handler) UpdateSelectionsProfiles(ctx context.Context, raceDate string, progress *jobs.Progress) error {
+	selections, err := h.repos.Runners.Selections(ctx, raceDate)
+	if err != nil {
+		return err
 	}
+	progress.SetTotal(len(selections))
+
+	pool := h.newScrapePool()
 
-	for _, selection := range selections {
+	var failed int32
+	err = pool.Run(ctx, len(selections), func(ctx context.Context, i int) error {
+		selection := selections[i]
 
 		// Fetch horse information
-		horseInformations, err := getForm(selection.Link)
+		var horseInformations models.SelectionsForm
+		err := pool.Fetch(ctx, selection.Link, func() error {
+			var err error
+			horseInformations, err = h.source.HorseProfile(selection.Link)
+			return err
+		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return err
 		}
 
-		err = save(
-			db,
-			selection.ID,
-			horseInformations.Age,
-			horseInformations.Trainer,
-			horseInformations.Sex,
-			horseInformations.Sire,
-			horseInformations.Dam,
-			horseInformations.Owner,
-		)
+		return h.repos.Form.UpdateProfile(ctx, selection.ID, horseInformations)
+	}, func(i int, err error) {
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			atomic.AddInt32(&failed, 1)
+			progress.Fail(selections[i].ID, selections[i].Name, err)
 			return
 		}
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Horse information saved successfully"})
-}
-
-func save(db *sql.DB, selectionID int, age, trainer, sex, sire, dam, owner string) error {
-
-	// Update the SelectionsForm table
-	_, err := db.Exec(`
-		UPDATE SelectionsForm
-		SET Age = ?,
-			Trainer = ?,
-			Sex = ?,
-			Sire = ?,
-			Dam = ?,
-			Owner = ?
-		WHERE selection_id = ?`,
-		age, trainer, sex, sire, dam, owner, selectionID,
-	)
+		progress.Done()
+	})
 	if err != nil {
 		return err
 	}
 
+	if failed > 0 {
+		return fmt.Errorf("%d of %d runners failed", failed, len(selections))
+	}
 	return nil
 }
-
-func getForm(selectionLink string) (models.SelectionsForm, error) {
-	c := colly.NewCollector()
-
-	selectionForm := models.SelectionsForm{}
-
-	c.OnHTML("table.Header__DataTable-xeaizz-1", func(e *colly.HTMLElement) {
-		age := e.ChildText("tr:nth-child(1) td.Header__DataValue-xeaizz-4")
-		trainer := e.ChildText("tr:nth-child(2) td.Header__DataValue-xeaizz-4 a")
-		sex := e.ChildText("tr:nth-child(3) td.Header__DataValue-xeaizz-4")
-		sire := e.ChildText("tr:nth-child(4) td.Header__DataValue-xeaizz-4")
-		dam := e.ChildText("tr:nth-child(5) td.Header__DataValue-xeaizz-4")
-		owner := e.ChildText("tr:nth-child(6) td.Header__DataValue-xeaizz-4")
-
-		// Populate the SelectionsForm object with the scraped data
-		selectionForm = models.SelectionsForm{
-			Age:     age,
-			Trainer: trainer,
-			Sex:     sex,
-			Sire:    sire,
-			Dam:     dam,
-			Owner:   owner,
-		}
-	})
-
-	// Start scraping the URL
-	c.Visit("https://www.sportinglife.com" + selectionLink)
-
-	return selectionForm, nil
-}
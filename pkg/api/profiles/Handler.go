@@ -0,0 +1,12 @@
+package profiles
+
+import "github.com/mmanjoura/race-picks-backend/pkg/repository"
+
+// Handler serves the admin routes for the heuristic scorer's profiles.
+type Handler struct {
+	repos repository.Repositories
+}
+
+func NewHandler(repos repository.Repositories) *Handler {
+	return &Handler{repos: repos}
+}
@@ -0,0 +1,142 @@
+package profiles
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/scoring"
+)
+
+// CloneRequest is the body of the clone route. The copy is version 1 of
+// Name, or the next version of the source's name if Name is empty.
+type CloneRequest struct {
+	Name string `json:"name"`
+}
+
+// EditRequest is the body of the edit route. Activate makes the new version
+// the one used by default.
+type EditRequest struct {
+	Weights  models.ScoringWeights `json:"weights" binding:"required"`
+	Activate bool                  `json:"activate"`
+}
+
+// List returns every scoring profile.
+func (h *Handler) List(c *gin.Context) {
+	profiles, err := h.repos.Scoring.List(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profiles": profiles, "default": scoring.Default()})
+}
+
+// Get returns the profile :id.
+func (h *Handler) Get(c *gin.Context) {
+	profile, ok := h.profile(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profile": profile})
+}
+
+// Clone copies the weights of profile :id into a new profile.
+func (h *Handler) Clone(c *gin.Context) {
+	var req CloneRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	source, ok := h.profile(c)
+	if !ok {
+		return
+	}
+	if req.Name == "" {
+		req.Name = source.Name
+	}
+
+	profile, err := h.repos.Scoring.Save(c, req.Name, source.Weights, source.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"profile": profile})
+}
+
+// Edit stores new weights for profile :id as the next version of its name.
+// Profile :id itself is kept, so picks scored with it can be reproduced.
+func (h *Handler) Edit(c *gin.Context) {
+	var req EditRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := scoring.Validate(req.Weights); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	source, ok := h.profile(c)
+	if !ok {
+		return
+	}
+
+	profile, err := h.repos.Scoring.Save(c, source.Name, req.Weights, source.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Activate {
+		if _, err := h.repos.Scoring.Activate(c, profile.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		profile.Active = true
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"profile": profile})
+}
+
+// Activate makes profile :id the one the heuristic scores with when no
+// version is asked for.
+func (h *Handler) Activate(c *gin.Context) {
+	profile, ok := h.profile(c)
+	if !ok {
+		return
+	}
+
+	if _, err := h.repos.Scoring.Activate(c, profile.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	profile.Active = true
+
+	c.JSON(http.StatusOK, gin.H{"profile": profile})
+}
+
+// profile loads profile :id, writing the error response if it cannot.
+func (h *Handler) profile(c *gin.Context) (models.ScoringProfile, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid profile id " + strconv.Quote(c.Param("id"))})
+		return models.ScoringProfile{}, false
+	}
+
+	profile, ok, err := h.repos.Scoring.Get(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return models.ScoringProfile{}, false
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no scoring profile " + c.Param("id")})
+		return models.ScoringProfile{}, false
+	}
+	return profile, true
+}
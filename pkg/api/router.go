@@ -4,11 +4,17 @@ import (
 	"time"
 
 	"github.com/mmanjoura/race-picks-backend/pkg/api/analysis"
+	"github.com/mmanjoura/race-picks-backend/pkg/api/ledger"
 	"github.com/mmanjoura/race-picks-backend/pkg/api/preparation"
+	"github.com/mmanjoura/race-picks-backend/pkg/api/profiles"
+	"github.com/mmanjoura/race-picks-backend/pkg/api/strategies"
 	"github.com/mmanjoura/race-picks-backend/pkg/api/users"
 
 	"github.com/mmanjoura/race-picks-backend/pkg/auth"
+	"github.com/mmanjoura/race-picks-backend/pkg/jobs"
 	"github.com/mmanjoura/race-picks-backend/pkg/middleware"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+	"github.com/mmanjoura/race-picks-backend/pkg/scheduler"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
@@ -19,14 +25,20 @@ import (
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
-// InitRouter initializes the routes for the API
-func InitRouter() *gin.Engine {
+// InitRouter initializes the routes for the API. preparationHandler is
+// shared with the scheduler, which runs the same ingest.
+func InitRouter(repos repository.Repositories, preparationHandler *preparation.Handler) *gin.Engine {
 	r := gin.Default()
 	r.Use(gin.Logger())
 	r.Use(middleware.Cors())
 	r.Use(middleware.RateLimiter(rate.Every(1*time.Minute), 600)) // 60 requests per minute
 	docs.SwaggerInfo.BasePath = "/api/v1"
 
+	analysisHandler := analysis.NewHandler(repos)
+	ledgerHandler := ledger.NewHandler(repos)
+	strategiesHandler := strategies.NewHandler(repos)
+	profilesHandler := profiles.NewHandler(repos)
+
 	v1 := r.Group("/api/v1")
 	{
 		v1.GET("/docs/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
@@ -37,21 +49,64 @@ func InitRouter() *gin.Engine {
 		v1.GET("/auth/account", users.Account)
 
 		// preparation routes
-		v1.POST("/preparation/GetRacingMarketData", preparation.GetRacingMarketData)
-		v1.POST("/preparation/GetRacingMarketWinners", preparation.GetRacingMarketWinners)
+		v1.POST("/preparation/GetRacingMarketData", preparationHandler.GetRacingMarketData)
+		v1.POST("/preparation/GetRacingMarketWinners", preparationHandler.GetRacingMarketWinners)
 
-		v1.POST("/preparation/UpdateSelectionsInfo", preparation.UpdateSelectionsInfo)
-		v1.POST("/preparation/SaveMarketData", preparation.SaveMarketData)
+		v1.POST("/preparation/UpdateSelectionsInfo", preparationHandler.UpdateSelectionsInfo)
+		v1.POST("/preparation/SaveMarketData", preparationHandler.SaveMarketData)
+		v1.POST("/preparation/RebuildFeatures", preparationHandler.RebuildFeatures)
 
-		v1.GET("/preparation/GetMarketData", preparation.GetMarketData)
-		v1.GET("/preparation/GetTodayMeeting", preparation.GetTodayMeeting)
-		v1.GET("/preparation/GetMeetingRunners", preparation.GetMeetingRunners)
-		v1.GET("/preparation/GetEventNames", preparation.GetEventNames)
-		v1.GET("/preparation/GetWinners", preparation.MeetingWinners)
+		v1.GET("/preparation/GetMarketData", preparationHandler.GetMarketData)
+		v1.GET("/preparation/GetTodayMeeting", preparationHandler.GetTodayMeeting)
+		v1.GET("/preparation/GetMeetingRunners", preparationHandler.GetMeetingRunners)
+		v1.GET("/preparation/GetEventNames", preparationHandler.GetEventNames)
+		v1.GET("/preparation/GetWinners", preparationHandler.MeetingWinners)
 
 		// v1.POST("/analysis/RaceAnalysis", analysis.GetRaceAnalysis)
-		v1.POST("/analysis/MeetingPrediction", analysis.GetMeetingPrediction)
-		v1.POST("/analysis/TodayPredictions", analysis.GetTodayPredictions)
+		v1.POST("/analysis/MeetingPrediction", analysisHandler.GetMeetingPrediction)
+		v1.POST("/analysis/TodayPredictions", analysisHandler.GetTodayPredictions)
+		v1.POST("/analysis/MonteCarloSimulation", analysisHandler.MonteCarloSimulation)
+		v1.POST("/analysis/NeuralNetworkTrain", analysisHandler.TrainNeuralNetwork)
+		v1.POST("/analysis/NeuralNetworkPrediction", analysisHandler.NeuralNetworkPrediction)
+		v1.POST("/analysis/ConditionalLogitTrain", analysisHandler.TrainConditionalLogit)
+		v1.POST("/analysis/Backtest", analysisHandler.Backtest)
+		v1.POST("/analysis/Calibrate", analysisHandler.Calibrate)
+		v1.POST("/analysis/Reliability", analysisHandler.Reliability)
+		v1.POST("/analysis/ValueBets", analysisHandler.ValueBets)
+		v1.POST("/analysis/Stake", analysisHandler.Stake)
+		v1.POST("/analysis/OptimiseWeights", analysisHandler.OptimiseWeights)
+		v1.GET("/analysis/PredictionRuns", analysisHandler.PredictionRuns)
+		v1.GET("/analysis/PredictionRuns/:id", analysisHandler.PredictionRun)
+		v1.GET("/analysis/PredictionRuns/:id/Diff/:other", analysisHandler.DiffPredictionRuns)
+		v1.POST("/analysis/PredictionRuns/:id/Publish", analysisHandler.PublishPredictionRun)
+
+		// ledger routes
+		v1.POST("/ledger/Settle", ledgerHandler.Settle)
+		v1.GET("/ledger/Entries", ledgerHandler.Entries)
+		v1.GET("/ledger/Daily", ledgerHandler.Daily)
+		v1.GET("/ledger/Weekly", ledgerHandler.Weekly)
+		v1.GET("/ledger/ByStrategy", ledgerHandler.ByStrategy)
+
+		// strategy routes
+		v1.GET("/strategies", strategiesHandler.List)
+		v1.GET("/strategies/:name", strategiesHandler.Get)
+		v1.POST("/strategies", strategiesHandler.Create)
+		v1.PUT("/strategies/:name", strategiesHandler.Update)
+		v1.DELETE("/strategies/:name", strategiesHandler.Delete)
+
+		// scoring profile routes
+		v1.GET("/scoring/profiles", profilesHandler.List)
+		v1.GET("/scoring/profiles/:id", profilesHandler.Get)
+		v1.POST("/scoring/profiles/:id/clone", profilesHandler.Clone)
+		v1.PUT("/scoring/profiles/:id", profilesHandler.Edit)
+		v1.POST("/scoring/profiles/:id/activate", profilesHandler.Activate)
+
+		// job routes
+		v1.GET("/jobs/:id", jobs.GetJob)
+
+		// scheduler routes
+		v1.GET("/scheduler/runs", scheduler.ListRuns)
+		v1.GET("/scheduler/trigger/:stage", scheduler.TriggerStage)
 	}
 
 	return r
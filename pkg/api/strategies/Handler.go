@@ -0,0 +1,12 @@
+package strategies
+
+import "github.com/mmanjoura/race-picks-backend/pkg/repository"
+
+// Handler serves the routes that manage the bet-selection strategies.
+type Handler struct {
+	repos repository.Repositories
+}
+
+func NewHandler(repos repository.Repositories) *Handler {
+	return &Handler{repos: repos}
+}
@@ -0,0 +1,125 @@
+package strategies
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/strategy"
+)
+
+// StrategyRequest is the body of the create and update routes. Name is
+// only read on create; an update keeps the name in the path.
+type StrategyRequest struct {
+	Name        string               `json:"name"`
+	Description string               `json:"description"`
+	Rules       models.StrategyRules `json:"rules"`
+}
+
+// List returns every stored strategy.
+func (h *Handler) List(c *gin.Context) {
+	strategies, err := h.repos.Strategies.List(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"strategies": strategies})
+}
+
+// Get returns the strategy called :name.
+func (h *Handler) Get(c *gin.Context) {
+	s, ok, err := h.repos.Strategies.Get(c, c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no strategy " + c.Param("name")})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"strategy": s})
+}
+
+// Create stores a new strategy.
+func (h *Handler) Create(c *gin.Context) {
+	var req StrategyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	if req.Name == strategy.Default.Name {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "strategy " + req.Name + " is built in"})
+		return
+	}
+	if err := strategy.Validate(req.Rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, exists, err := h.repos.Strategies.Get(c, req.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "strategy " + req.Name + " already exists"})
+		return
+	}
+
+	s, err := h.repos.Strategies.Create(c, models.Strategy{Name: req.Name, Description: req.Description, Rules: req.Rules})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"strategy": s})
+}
+
+// Update replaces the description and rules of the strategy called :name.
+func (h *Handler) Update(c *gin.Context) {
+	var req StrategyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := strategy.Validate(req.Rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := c.Param("name")
+	ok, err := h.repos.Strategies.Update(c, name, models.Strategy{Description: req.Description, Rules: req.Rules})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no strategy " + name})
+		return
+	}
+
+	h.Get(c)
+}
+
+// Delete removes the strategy called :name. Runs already made with it keep
+// its rules in their parameters.
+func (h *Handler) Delete(c *gin.Context) {
+	name := c.Param("name")
+	ok, err := h.repos.Strategies.Delete(c, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no strategy " + name})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": name})
+}
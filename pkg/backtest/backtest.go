@@ -0,0 +1,308 @@
+// Package backtest replays past race days through a scoring model and
+// measures how its picks would have done at SP and at Betfair SP.
+package backtest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/features"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+	"github.com/mmanjoura/race-picks-backend/pkg/staking"
+	"github.com/mmanjoura/race-picks-backend/pkg/value"
+)
+
+// Scorer scores the runners declared on date using only form dated before
+// asOf, the same way the live predictions do.
+type Scorer func(ctx context.Context, date string, runners []models.Runner, asOf time.Time) ([]models.SelectionResult, error)
+
+// Options selects the days to replay and how bets are settled.
+type Options struct {
+	From, To time.Time
+	// Commission is the exchange's cut of net winnings at BSP, e.g. 0.05.
+	Commission float64
+	// Details returns every bet in the report.
+	Details bool
+	// Staking sizes each bet from the SP bankroll, which starts at
+	// Bankroll (100 if 0). Stakes are sized at the runner's price before
+	// the off. The zero plan stakes one unit a bet.
+	Staking  staking.Plan
+	Bankroll float64
+}
+
+// DefaultBankroll is the bank a backtest starts with when none is given.
+const DefaultBankroll = 100
+
+// Bet is a win bet on the top pick of a race.
+type Bet struct {
+	EventDate     string  `json:"event_date"`
+	EventName     string  `json:"event_name"`
+	EventTime     string  `json:"event_time"`
+	SelectionID   int     `json:"selection_id"`
+	SelectionName string  `json:"selection_name"`
+	TotalScore    float64 `json:"total_score"`
+	Stake         float64 `json:"stake"`
+	Position      string  `json:"position"`
+	Won           bool    `json:"won"`
+	Placed        bool    `json:"placed"`
+	SP            float64 `json:"sp"`
+	BSP           float64 `json:"bsp"`
+	ProfitSP      float64 `json:"profit_sp"`
+	ProfitBSP     float64 `json:"profit_bsp"`
+}
+
+// Report sums up a backtest. Returns are per unit staked; races without a
+// result are counted as unsettled and left out of the figures, as are
+// picks the staking plan bets nothing on. Settled bets without an SP are
+// counted in NoSP and left out of the SP figures; they still count at BSP
+// when there is one.
+type Report struct {
+	From           string  `json:"from"`
+	To             string  `json:"to"`
+	Races          int     `json:"races"`
+	Bets           int     `json:"bets"`
+	Unsettled      int     `json:"unsettled"`
+	NoStake        int     `json:"no_stake"`
+	NoSP           int     `json:"no_sp"`
+	Staked         float64 `json:"staked"`
+	StakedBSP      float64 `json:"staked_bsp"`
+	StartBankroll  float64 `json:"start_bankroll"`
+	EndBankroll    float64 `json:"end_bankroll"`
+	Winners        int     `json:"winners"`
+	Placed         int     `json:"placed"`
+	StrikeRate     float64 `json:"strike_rate"`
+	PlaceRate      float64 `json:"place_rate"`
+	ProfitSP       float64 `json:"profit_sp"`
+	ROISP          float64 `json:"roi_sp"`
+	MaxDrawdownSP  float64 `json:"max_drawdown_sp"`
+	BSPBets        int     `json:"bsp_bets"`
+	ProfitBSP      float64 `json:"profit_bsp"`
+	ROIBSP         float64 `json:"roi_bsp"`
+	MaxDrawdownBSP float64 `json:"max_drawdown_bsp"`
+	Details        []Bet   `json:"details,omitempty"`
+}
+
+// Engine runs backtests against the stored runners, form and market data.
+type Engine struct {
+	repos repository.Repositories
+	score Scorer
+}
+
+func NewEngine(repos repository.Repositories, score Scorer) *Engine {
+	return &Engine{repos: repos, score: score}
+}
+
+// Run replays every day from opts.From to opts.To inclusive.
+func (e *Engine) Run(ctx context.Context, opts Options) (Report, error) {
+	if opts.To.Before(opts.From) {
+		return Report{}, fmt.Errorf("backtest: to is before from")
+	}
+
+	if err := opts.Staking.Validate(); err != nil {
+		return Report{}, err
+	}
+	if opts.Bankroll <= 0 {
+		opts.Bankroll = DefaultBankroll
+	}
+
+	report := Report{From: opts.From.Format("2006-01-02"), To: opts.To.Format("2006-01-02")}
+	report.StartBankroll = opts.Bankroll
+	bankroll := opts.Bankroll
+	var sp, bsp drawdown
+
+	for day := opts.From; !day.After(opts.To); day = day.AddDate(0, 0, 1) {
+		if err := ctx.Err(); err != nil {
+			return Report{}, err
+		}
+
+		bets, races, err := e.runDay(ctx, day, opts, &bankroll)
+		if err != nil {
+			return Report{}, fmt.Errorf("backtest %s: %w", day.Format("2006-01-02"), err)
+		}
+		report.Races += races
+
+		for _, bet := range bets {
+			if bet.Position == "" {
+				report.Unsettled++
+				continue
+			}
+			if bet.Stake == 0 {
+				report.NoStake++
+				continue
+			}
+			if bet.SP == 0 {
+				report.NoSP++
+			} else {
+				report.Bets++
+				report.Staked += bet.Stake
+				if bet.Won {
+					report.Winners++
+				}
+				if bet.Placed {
+					report.Placed++
+				}
+				report.ProfitSP += bet.ProfitSP
+				sp.add(bet.ProfitSP)
+			}
+			if bet.BSP > 0 {
+				report.BSPBets++
+				report.StakedBSP += bet.Stake
+				report.ProfitBSP += bet.ProfitBSP
+				bsp.add(bet.ProfitBSP)
+			}
+			if opts.Details {
+				report.Details = append(report.Details, bet)
+			}
+		}
+	}
+
+	if report.Bets > 0 {
+		report.StrikeRate = float64(report.Winners) / float64(report.Bets)
+		report.PlaceRate = float64(report.Placed) / float64(report.Bets)
+	}
+	if report.Staked > 0 {
+		report.ROISP = report.ProfitSP / report.Staked
+	}
+	if report.StakedBSP > 0 {
+		report.ROIBSP = report.ProfitBSP / report.StakedBSP
+	}
+	report.EndBankroll = bankroll
+	report.MaxDrawdownSP = sp.max
+	report.MaxDrawdownBSP = bsp.max
+
+	return report, nil
+}
+
+// runDay scores one day's runners with form from before the day and settles
+// a bet on the top pick of each race, staked from and settled into the SP
+// bankroll.
+func (e *Engine) runDay(ctx context.Context, day time.Time, opts Options, bankroll *float64) ([]Bet, int, error) {
+	date := day.Format("2006-01-02")
+
+	runners, err := e.repos.Runners.ByDate(ctx, date)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(runners) == 0 {
+		return nil, 0, nil
+	}
+
+	fieldSizes := map[string]int{}
+	for _, runner := range runners {
+		fieldSizes[raceKey(runner.EventName, runner.EventTime)]++
+	}
+
+	results, err := e.score(ctx, date, runners, day)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	prices, err := value.LoadBSP(ctx, e.repos.MarketData, date)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var bets []Bet
+	for _, pick := range topPicks(results) {
+		bet := Bet{
+			EventDate:     date,
+			EventName:     pick.EventName,
+			EventTime:     pick.EventTime,
+			SelectionID:   pick.SelectionID,
+			SelectionName: pick.SelectionName,
+			TotalScore:    pick.TotalScore,
+		}
+
+		run, ok, err := e.repos.Form.RunOn(ctx, pick.SelectionID, date)
+		if err != nil {
+			return nil, 0, err
+		}
+		if ok {
+			bet.Stake = opts.Staking.Stake(*bankroll, staking.Bet{
+				Probability: pick.WinProbability,
+				Odds:        value.DecimalOdds(pick.Odds),
+			})
+			settle(&bet, run, fieldSizes[raceKey(pick.EventName, pick.EventTime)])
+			bet.BSP = prices.Get(pick.EventTime, pick.SelectionName)
+			if bet.BSP > 0 {
+				bet.ProfitBSP = -bet.Stake
+				if bet.Won {
+					bet.ProfitBSP = bet.Stake * (bet.BSP - 1) * (1 - opts.Commission)
+				}
+			}
+			*bankroll += bet.ProfitSP
+		}
+		bets = append(bets, bet)
+	}
+
+	return bets, len(fieldSizes), nil
+}
+
+// settle fills in the result of bet, at its stake, from the horse's form
+// row on the day. Non-finishers count as losers; a missing SP settles the
+// bet at no profit or loss at SP, and Run leaves it out of the SP figures.
+func settle(bet *Bet, run models.SelectionsForm, declared int) {
+	bet.Position = run.Position
+	bet.SP = value.DecimalOdds(run.SPOdds)
+
+	pos, field, finished := features.ParsePosition(run.Position)
+	if field == 0 {
+		field = declared
+	}
+	bet.Won = finished && pos == 1
+	bet.Placed = finished && pos <= PlacePositions(field)
+
+	switch {
+	case bet.SP == 0:
+	case bet.Won:
+		bet.ProfitSP = bet.Stake * (bet.SP - 1)
+	default:
+		bet.ProfitSP = -bet.Stake
+	}
+}
+
+// topPicks returns the highest scoring selection of each race, in race
+// time order.
+func topPicks(results []models.SelectionResult) []models.SelectionResult {
+	best := map[string]models.SelectionResult{}
+	for _, result := range results {
+		key := raceKey(result.EventName, result.EventTime)
+		if current, ok := best[key]; !ok || result.TotalScore > current.TotalScore {
+			best[key] = result
+		}
+	}
+
+	picks := make([]models.SelectionResult, 0, len(best))
+	for _, pick := range best {
+		picks = append(picks, pick)
+	}
+	sort.Slice(picks, func(i, j int) bool {
+		if picks[i].EventTime != picks[j].EventTime {
+			return picks[i].EventTime < picks[j].EventTime
+		}
+		return picks[i].EventName < picks[j].EventName
+	})
+	return picks
+}
+
+func raceKey(eventName, eventTime string) string {
+	return eventName + "|" + eventTime
+}
+
+// drawdown tracks the largest fall of cumulative profit from its peak.
+type drawdown struct {
+	total, peak, max float64
+}
+
+func (d *drawdown) add(profit float64) {
+	d.total += profit
+	if d.total > d.peak {
+		d.peak = d.total
+	}
+	if d.peak-d.total > d.max {
+		d.max = d.peak - d.total
+	}
+}
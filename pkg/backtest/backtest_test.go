@@ -0,0 +1,84 @@
+package backtest
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+)
+
+func TestRunLeavesBetsWithoutSPOutOfTheSPFigures(t *testing.T) {
+	db, err := sql.Open("sqlite3", "file:TestRunLeavesBetsWithoutSP?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if _, err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO EventRunners (selection_id, selection_name, event_name, event_time, event_date)
+		VALUES
+			(1, 'Alpha', 'Ascot', '14:00', '2024-06-01 00:00:00'),
+			(2, 'Bravo', 'Ascot', '14:00', '2024-06-01 00:00:00'),
+			(3, 'Charlie', 'Ascot', '15:00', '2024-06-01 00:00:00'),
+			(4, 'Delta', 'Ascot', '15:00', '2024-06-01 00:00:00');
+		INSERT INTO SelectionsForm (selection_id, selection_name, race_date, position, sp_odds)
+		VALUES
+			(1, 'Alpha', '2024-06-01 00:00:00', '1/2', '3/1'),
+			(3, 'Charlie', '2024-06-01 00:00:00', '2/2', '');
+		INSERT INTO MarketData (event_id, event_name, event_dt, selection_id, selection_name, bsp)
+		VALUES (1, 'Ascot 1m', '01-06-2024 15:00', 3, 'Charlie', 5.0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Alpha and Charlie top their races
+	score := func(ctx context.Context, date string, runners []models.Runner, asOf time.Time) ([]models.SelectionResult, error) {
+		var results []models.SelectionResult
+		for _, runner := range runners {
+			results = append(results, models.SelectionResult{
+				SelectionID:   runner.ID,
+				SelectionName: runner.Name,
+				EventName:     runner.EventName,
+				EventTime:     runner.EventTime,
+				Odds:          "3/1",
+				TotalScore:    float64(runner.ID % 2),
+			})
+		}
+		return results, nil
+	}
+
+	day := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	report, err := NewEngine(repository.New(db, database.NewWriter(db)), score).Run(context.Background(), Options{From: day, To: day})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		got, want float64
+	}{
+		{"races", float64(report.Races), 2},
+		{"bets", float64(report.Bets), 1},
+		{"no SP", float64(report.NoSP), 1},
+		{"staked", report.Staked, 1},
+		{"profit SP", report.ProfitSP, 3},
+		{"ROI SP", report.ROISP, 3},
+		{"strike rate", report.StrikeRate, 1},
+		{"BSP bets", float64(report.BSPBets), 1},
+		{"staked BSP", report.StakedBSP, 1},
+		{"ROI BSP", report.ROIBSP, -1},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s = %v, want %v", test.name, test.got, test.want)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package backtest
+
+// PlacePositions returns how many places are paid each way in a race of
+// fieldSize runners, using the usual UK terms.
+func PlacePositions(fieldSize int) int {
+	switch {
+	case fieldSize < 5:
+		return 1
+	case fieldSize < 8:
+		return 2
+	default:
+		return 3
+	}
+}
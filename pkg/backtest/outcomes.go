@@ -0,0 +1,96 @@
+package backtest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/features"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// Outcome is a scored runner with its result.
+type Outcome struct {
+	models.SelectionResult
+	Position string `json:"position"`
+	Won      bool   `json:"won"`
+}
+
+// Races scores every race from from to to inclusive and settles each scored
+// runner. Only races in which every scored runner has a result and exactly
+// one of them won are returned, so the outcomes can be compared with
+// probabilities shared between the scored runners.
+func (e *Engine) Races(ctx context.Context, from, to time.Time) ([][]Outcome, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("backtest: to is before from")
+	}
+
+	var races [][]Outcome
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		settled, err := e.settleDay(ctx, day)
+		if err != nil {
+			return nil, fmt.Errorf("backtest %s: %w", day.Format("2006-01-02"), err)
+		}
+		races = append(races, settled...)
+	}
+	return races, nil
+}
+
+func (e *Engine) settleDay(ctx context.Context, day time.Time) ([][]Outcome, error) {
+	date := day.Format("2006-01-02")
+
+	runners, err := e.repos.Runners.ByDate(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+	if len(runners) == 0 {
+		return nil, nil
+	}
+
+	results, err := e.score(ctx, date, runners, day)
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{}
+	var races [][]Outcome
+	for _, result := range results {
+		key := raceKey(result.EventName, result.EventTime)
+		i, ok := index[key]
+		if !ok {
+			i = len(races)
+			index[key] = i
+			races = append(races, nil)
+		}
+		races[i] = append(races[i], Outcome{SelectionResult: result})
+	}
+
+	var settled [][]Outcome
+	for _, race := range races {
+		winners, complete := 0, true
+		for i := range race {
+			run, ok, err := e.repos.Form.RunOn(ctx, race[i].SelectionID, date)
+			if err != nil {
+				return nil, err
+			}
+			if !ok || run.Position == "" {
+				complete = false
+				break
+			}
+			pos, _, finished := features.ParsePosition(run.Position)
+			race[i].Position = run.Position
+			race[i].Won = finished && pos == 1
+			if race[i].Won {
+				winners++
+			}
+		}
+		if complete && winners == 1 {
+			settled = append(settled, race)
+		}
+	}
+	return settled, nil
+}
@@ -0,0 +1,252 @@
+// Package calibration turns model scores into win probabilities fitted to
+// how races actually finished, and measures how well probabilities match
+// outcomes.
+//
+// Scores are standardised within each race first, so the unbounded totals
+// of the heuristic can be compared across races. A temperature calibrator
+// then takes a softmax of the standardised scores; an isotonic one maps
+// them through a fitted non-decreasing win rate and shares the race out in
+// proportion.
+package calibration
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Methods of calibration.
+const (
+	Temperature = "temperature"
+	Isotonic    = "isotonic"
+)
+
+// Race is one settled race: the score of each runner and which won.
+type Race struct {
+	Scores []float64
+	Winner int
+}
+
+// Calibrator maps the scores of a race to probabilities that sum to 1. It
+// encodes to JSON as is.
+type Calibrator struct {
+	Method string `json:"method"`
+	// Temperature divides the standardised scores before the softmax.
+	Temperature float64 `json:"temperature,omitempty"`
+	// Thresholds and Rates are the isotonic steps: a standardised score
+	// up to Thresholds[i] wins at Rates[i].
+	Thresholds []float64 `json:"thresholds,omitempty"`
+	Rates      []float64 `json:"rates,omitempty"`
+}
+
+// Default is what a model's scores are turned into before it has been
+// calibrated: a softmax of the standardised scores, as the Monte Carlo
+// simulation does with its default temperature.
+var Default = &Calibrator{Method: Temperature, Temperature: 1}
+
+// Fit fits a calibrator of the given method to races.
+func Fit(method string, races []Race) (*Calibrator, error) {
+	if len(races) == 0 {
+		return nil, errors.New("calibration: no settled races")
+	}
+	for _, race := range races {
+		if race.Winner < 0 || race.Winner >= len(race.Scores) {
+			return nil, errors.New("calibration: race winner is not one of its runners")
+		}
+	}
+
+	switch method {
+	case Temperature, "":
+		return fitTemperature(races), nil
+	case Isotonic:
+		return fitIsotonic(races), nil
+	default:
+		return nil, fmt.Errorf("calibration: unknown method %q", method)
+	}
+}
+
+// Probabilities returns the win probability of each runner of a race from
+// their scores.
+func (c *Calibrator) Probabilities(scores []float64) []float64 {
+	z := Standardize(scores)
+	if c.Method == Isotonic {
+		return c.isotonic(z)
+	}
+	return softmax(z, 1/c.Temperature)
+}
+
+// Standardize centres scores on their mean and divides by their standard
+// deviation. Equal scores all become 0.
+func Standardize(scores []float64) []float64 {
+	var mean float64
+	for _, s := range scores {
+		mean += s
+	}
+	mean /= float64(len(scores))
+
+	var variance float64
+	for _, s := range scores {
+		variance += (s - mean) * (s - mean)
+	}
+	spread := math.Sqrt(variance / float64(len(scores)))
+
+	z := make([]float64, len(scores))
+	for i, s := range scores {
+		if spread > 0 {
+			z[i] = (s - mean) / spread
+		}
+	}
+	return z
+}
+
+// LogLoss is the mean negative log probability c gives the winners.
+func (c *Calibrator) LogLoss(races []Race) float64 {
+	var loss float64
+	for _, race := range races {
+		loss -= logProbability(c.Probabilities(race.Scores)[race.Winner])
+	}
+	return loss / float64(len(races))
+}
+
+// fitTemperature finds the temperature with the lowest log loss. The loss
+// is convex in 1/temperature, so a golden-section search finds it.
+func fitTemperature(races []Race) *Calibrator {
+	standardised := make([]Race, len(races))
+	for i, race := range races {
+		standardised[i] = Race{Scores: Standardize(race.Scores), Winner: race.Winner}
+	}
+	loss := func(scale float64) float64 {
+		var total float64
+		for _, race := range standardised {
+			total -= logProbability(softmax(race.Scores, scale)[race.Winner])
+		}
+		return total
+	}
+
+	const minScale, maxScale = 0.01, 20.0
+	phi := (math.Sqrt(5) - 1) / 2
+	lo, hi := minScale, maxScale
+	a, b := hi-phi*(hi-lo), lo+phi*(hi-lo)
+	la, lb := loss(a), loss(b)
+	for hi-lo > 1e-4 {
+		if la < lb {
+			hi, b, lb = b, a, la
+			a = hi - phi*(hi-lo)
+			la = loss(a)
+		} else {
+			lo, a, la = a, b, lb
+			b = lo + phi*(hi-lo)
+			lb = loss(b)
+		}
+	}
+	return &Calibrator{Method: Temperature, Temperature: 2 / (lo + hi)}
+}
+
+// fitIsotonic fits the win rate of every runner as a non-decreasing step
+// function of its standardised score by pooling adjacent violators.
+func fitIsotonic(races []Race) *Calibrator {
+	type point struct {
+		z   float64
+		won float64
+	}
+	var points []point
+	for _, race := range races {
+		for i, z := range Standardize(race.Scores) {
+			won := 0.0
+			if i == race.Winner {
+				won = 1
+			}
+			points = append(points, point{z, won})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].z < points[j].z })
+
+	type block struct {
+		upper, sum, n float64
+	}
+	var blocks []block
+	for _, p := range points {
+		blocks = append(blocks, block{upper: p.z, sum: p.won, n: 1})
+		for len(blocks) > 1 {
+			last, prev := blocks[len(blocks)-1], blocks[len(blocks)-2]
+			if prev.sum/prev.n < last.sum/last.n && prev.upper < last.upper {
+				break
+			}
+			blocks = blocks[:len(blocks)-2]
+			blocks = append(blocks, block{upper: last.upper, sum: prev.sum + last.sum, n: prev.n + last.n})
+		}
+	}
+
+	c := &Calibrator{Method: Isotonic}
+	for _, b := range blocks {
+		c.Thresholds = append(c.Thresholds, b.upper)
+		c.Rates = append(c.Rates, b.sum/b.n)
+	}
+	return c
+}
+
+func (c *Calibrator) isotonic(z []float64) []float64 {
+	p := make([]float64, len(z))
+	if len(c.Rates) == 0 {
+		return uniform(len(z))
+	}
+
+	var total float64
+	for i, v := range z {
+		step := sort.SearchFloat64s(c.Thresholds, v)
+		if step == len(c.Rates) {
+			step--
+		}
+		p[i] = c.Rates[step]
+		total += p[i]
+	}
+	if total == 0 {
+		return uniform(len(z))
+	}
+	for i := range p {
+		p[i] /= total
+	}
+	return p
+}
+
+// softmax returns exp(scale*z) normalised, shifted by the largest value so
+// exp cannot overflow.
+func softmax(z []float64, scale float64) []float64 {
+	best := math.Inf(-1)
+	for _, v := range z {
+		best = math.Max(best, scale*v)
+	}
+
+	var total float64
+	p := make([]float64, len(z))
+	for i, v := range z {
+		p[i] = math.Exp(scale*v - best)
+		total += p[i]
+	}
+	for i := range p {
+		p[i] /= total
+	}
+	return p
+}
+
+func uniform(n int) []float64 {
+	p := make([]float64, n)
+	for i := range p {
+		p[i] = 1 / float64(n)
+	}
+	return p
+}
+
+func logProbability(p float64) float64 {
+	return math.Log(math.Max(p, 1e-12))
+}
+
+// FairOdds is the decimal price at which a bet at probability p breaks
+// even. It is 0 when p is 0.
+func FairOdds(p float64) float64 {
+	if p <= 0 {
+		return 0
+	}
+	return 1 / p
+}
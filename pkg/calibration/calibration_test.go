@@ -0,0 +1,235 @@
+package calibration
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestStandardize(t *testing.T) {
+	tests := []struct {
+		scores []float64
+		want   []float64
+	}{
+		{[]float64{1, 3}, []float64{-1, 1}},
+		{[]float64{2, 4, 6}, []float64{-math.Sqrt(1.5), 0, math.Sqrt(1.5)}},
+		{[]float64{5, 5, 5}, []float64{0, 0, 0}},
+		{[]float64{-10, 10}, []float64{-1, 1}},
+	}
+	for _, tt := range tests {
+		got := Standardize(tt.scores)
+		for i := range got {
+			if math.Abs(got[i]-tt.want[i]) > 1e-12 {
+				t.Errorf("Standardize(%v) = %v, want %v", tt.scores, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestFairOdds(t *testing.T) {
+	tests := []struct {
+		p, want float64
+	}{
+		{0.5, 2},
+		{0.25, 4},
+		{1, 1},
+		{0, 0},
+		{-0.1, 0},
+	}
+	for _, tt := range tests {
+		if got := FairOdds(tt.p); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("FairOdds(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestProbabilities(t *testing.T) {
+	tests := []struct {
+		name       string
+		calibrator Calibrator
+		scores     []float64
+		want       []float64
+	}{
+		{
+			name:       "temperature 1",
+			calibrator: Calibrator{Method: Temperature, Temperature: 1},
+			scores:     []float64{10, 30},
+			want:       []float64{1 / (1 + math.Exp(2)), 1 / (1 + math.Exp(-2))},
+		},
+		{
+			name:       "a higher temperature flattens",
+			calibrator: Calibrator{Method: Temperature, Temperature: 2},
+			scores:     []float64{10, 30},
+			want:       []float64{1 / (1 + math.Exp(1)), 1 / (1 + math.Exp(-1))},
+		},
+		{
+			name:       "equal scores share the race",
+			calibrator: Calibrator{Method: Temperature, Temperature: 1},
+			scores:     []float64{7, 7, 7, 7},
+			want:       []float64{0.25, 0.25, 0.25, 0.25},
+		},
+		{
+			name:       "isotonic shares out the step rates",
+			calibrator: Calibrator{Method: Isotonic, Thresholds: []float64{-1, 1}, Rates: []float64{0.1, 0.3}},
+			scores:     []float64{0, 1},
+			want:       []float64{0.25, 0.75},
+		},
+		{
+			name:       "isotonic beyond the last step takes its rate",
+			calibrator: Calibrator{Method: Isotonic, Thresholds: []float64{-1, 0}, Rates: []float64{0.2, 0.6}},
+			scores:     []float64{0, 1},
+			want:       []float64{0.25, 0.75},
+		},
+		{
+			name:       "isotonic with no wins is uniform",
+			calibrator: Calibrator{Method: Isotonic, Thresholds: []float64{1}, Rates: []float64{0}},
+			scores:     []float64{0, 1},
+			want:       []float64{0.5, 0.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.calibrator.Probabilities(tt.scores)
+			for i := range got {
+				if math.Abs(got[i]-tt.want[i]) > 1e-12 {
+					t.Errorf("Probabilities(%v) = %v, want %v", tt.scores, got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestFitRejectsBadRaces(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		races  []Race
+	}{
+		{"no races", Temperature, nil},
+		{"winner out of range", Temperature, []Race{{Scores: []float64{1, 2}, Winner: 2}}},
+		{"unknown method", "platt", []Race{{Scores: []float64{1, 2}, Winner: 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Fit(tt.method, tt.races); err == nil {
+				t.Error("Fit succeeded")
+			}
+		})
+	}
+}
+
+// twoRunnerRaces returns n races of two runners in which the higher score
+// wins the first won of them.
+func twoRunnerRaces(won, n int) []Race {
+	races := make([]Race, n)
+	for i := range races {
+		races[i] = Race{Scores: []float64{1, 2}, Winner: 0}
+		if i < won {
+			races[i].Winner = 1
+		}
+	}
+	return races
+}
+
+func TestFitTemperature(t *testing.T) {
+	tests := []struct {
+		won, n int
+	}{
+		{3, 4},
+		{9, 10},
+		{6, 10},
+	}
+	for _, tt := range tests {
+		races := twoRunnerRaces(tt.won, tt.n)
+		c, err := Fit(Temperature, races)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The scores standardise to -1 and 1, so the favourite wins at
+		// 1/(1+exp(-2/T)); the best T matches its strike rate
+		rate := float64(tt.won) / float64(tt.n)
+		want := 2 / math.Log(rate/(1-rate))
+		if math.Abs(c.Temperature-want) > 1e-3 {
+			t.Errorf("favourite winning %d of %d: temperature = %v, want %v", tt.won, tt.n, c.Temperature, want)
+		}
+		if p := c.Probabilities([]float64{1, 2})[1]; math.Abs(p-rate) > 1e-4 {
+			t.Errorf("favourite winning %d of %d is given %v", tt.won, tt.n, p)
+		}
+		if c.LogLoss(races) > Default.LogLoss(races) {
+			t.Errorf("fitted log loss %v is worse than the default's %v", c.LogLoss(races), Default.LogLoss(races))
+		}
+	}
+}
+
+func TestFitIsotonic(t *testing.T) {
+	tests := []struct {
+		name       string
+		races      []Race
+		thresholds []float64
+		rates      []float64
+	}{
+		{
+			name:       "favourites win more",
+			races:      twoRunnerRaces(3, 4),
+			thresholds: []float64{-1, 1},
+			rates:      []float64{0.25, 0.75},
+		},
+		{
+			name:       "favourites winning less are pooled",
+			races:      twoRunnerRaces(1, 4),
+			thresholds: []float64{1},
+			rates:      []float64{0.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Fit(Isotonic, tt.races)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(c.Thresholds, tt.thresholds) || !reflect.DeepEqual(c.Rates, tt.rates) {
+				t.Errorf("steps = %v at %v, want %v at %v", c.Rates, c.Thresholds, tt.rates, tt.thresholds)
+			}
+		})
+	}
+}
+
+func TestReliability(t *testing.T) {
+	races := [][]Forecast{
+		{{Probability: 0.7, Won: true}, {Probability: 0.3}},
+		{{Probability: 0.7}, {Probability: 0.3, Won: true}},
+		// No winner: scored for Brier but not log loss
+		{{Probability: 0.5}, {Probability: 0.5}},
+	}
+	report := Reliability(races, 2)
+
+	if report.Races != 2 || report.Runners != 6 {
+		t.Errorf("counted %d races and %d runners, want 2 and 6", report.Races, report.Runners)
+	}
+	if want := -(math.Log(0.7) + math.Log(0.3)) / 2; math.Abs(report.LogLoss-want) > 1e-12 {
+		t.Errorf("LogLoss = %v, want %v", report.LogLoss, want)
+	}
+	if want := (0.09 + 0.09 + 0.49 + 0.49 + 0.25 + 0.25) / 6; math.Abs(report.Brier-want) > 1e-12 {
+		t.Errorf("Brier = %v, want %v", report.Brier, want)
+	}
+
+	want := []Bin{
+		{Lower: 0, Upper: 0.5, Runners: 2, Predicted: 0.3, Observed: 0.5},
+		{Lower: 0.5, Upper: 1, Runners: 4, Predicted: 0.6, Observed: 0.25},
+	}
+	for i, bin := range report.Bins {
+		if bin.Runners != want[i].Runners || math.Abs(bin.Predicted-want[i].Predicted) > 1e-12 || math.Abs(bin.Observed-want[i].Observed) > 1e-12 {
+			t.Errorf("bin %d = %+v, want %+v", i, bin, want[i])
+		}
+	}
+	if wantError := (2*0.2 + 4*0.35) / 6; math.Abs(report.ExpectedError-wantError) > 1e-12 {
+		t.Errorf("ExpectedError = %v, want %v", report.ExpectedError, wantError)
+	}
+
+	if bins := len(Reliability(nil, 0).Bins); bins != 10 {
+		t.Errorf("Reliability with no bin count has %d bins, want 10", bins)
+	}
+}
@@ -0,0 +1,93 @@
+package calibration
+
+import "math"
+
+// Forecast is the probability given to one runner and whether it won.
+type Forecast struct {
+	Probability float64
+	Won         bool
+}
+
+// Bin is one bar of a reliability diagram: the runners given a probability
+// in [Lower, Upper), how likely they were said to be to win on average and
+// how often they did.
+type Bin struct {
+	Lower     float64 `json:"lower"`
+	Upper     float64 `json:"upper"`
+	Runners   int     `json:"runners"`
+	Predicted float64 `json:"predicted"`
+	Observed  float64 `json:"observed"`
+}
+
+// Report says how well a model's probabilities matched the results. A
+// well calibrated model has Predicted close to Observed in every bin.
+type Report struct {
+	Races   int     `json:"races"`
+	Runners int     `json:"runners"`
+	LogLoss float64 `json:"log_loss"`
+	Brier   float64 `json:"brier"`
+	// ExpectedError is the runner-weighted mean gap between Predicted and
+	// Observed across the bins.
+	ExpectedError float64 `json:"expected_calibration_error"`
+	Bins          []Bin   `json:"bins"`
+}
+
+// Reliability bins the forecasts of each race into bins of equal width.
+// LogLoss counts races with exactly one winner.
+func Reliability(races [][]Forecast, bins int) Report {
+	if bins <= 0 {
+		bins = 10
+	}
+	report := Report{Bins: make([]Bin, bins)}
+	for i := range report.Bins {
+		report.Bins[i].Lower = float64(i) / float64(bins)
+		report.Bins[i].Upper = float64(i+1) / float64(bins)
+	}
+
+	for _, race := range races {
+		winners := 0
+		var winner float64
+		for _, forecast := range race {
+			report.Runners++
+			won := 0.0
+			if forecast.Won {
+				won = 1
+				winners++
+				winner = forecast.Probability
+			}
+			report.Brier += (forecast.Probability - won) * (forecast.Probability - won)
+
+			i := int(forecast.Probability * float64(bins))
+			if i >= bins {
+				i = bins - 1
+			}
+			if i < 0 {
+				i = 0
+			}
+			report.Bins[i].Runners++
+			report.Bins[i].Predicted += forecast.Probability
+			report.Bins[i].Observed += won
+		}
+		if winners == 1 {
+			report.Races++
+			report.LogLoss -= logProbability(winner)
+		}
+	}
+
+	if report.Runners > 0 {
+		report.Brier /= float64(report.Runners)
+	}
+	if report.Races > 0 {
+		report.LogLoss /= float64(report.Races)
+	}
+	for i := range report.Bins {
+		bin := &report.Bins[i]
+		if bin.Runners == 0 {
+			continue
+		}
+		bin.Predicted /= float64(bin.Runners)
+		bin.Observed /= float64(bin.Runners)
+		report.ExpectedError += math.Abs(bin.Predicted-bin.Observed) * float64(bin.Runners) / float64(report.Runners)
+	}
+	return report
+}
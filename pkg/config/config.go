@@ -0,0 +1,177 @@
+// Package config loads the settings a server instance needs before it can
+// open its database. Each layer overrides the one before it: built-in
+// defaults, a JSON file, RACEPICKS_* environment variables, then flags.
+//
+// Settings that live in the Configurations table (schedules, race data
+// sources, ...) stay there; JWT secret and listen address set here take
+// precedence over the JWT-API-KEY and PORT rows.
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Config holds the settings of one server instance.
+type Config struct {
+	// DatabasePath is the SQLite file to open.
+	DatabasePath string `json:"database_path"`
+	// JournalMode is SQLite's journal_mode pragma, e.g. WAL or DELETE.
+	JournalMode string `json:"journal_mode"`
+	// BusyTimeoutMs is how long a connection waits on a locked database.
+	BusyTimeoutMs int `json:"busy_timeout_ms"`
+	// ForeignKeys turns on foreign key enforcement. It is off by default, as
+	// it was before it could be set, since existing databases may hold rows
+	// that would now be rejected.
+	ForeignKeys bool `json:"foreign_keys"`
+	// ListenAddr is the address the HTTP server listens on, e.g. :8080.
+	ListenAddr string `json:"listen_addr"`
+	// JWTSecret signs and checks the API tokens.
+	JWTSecret string `json:"jwt_secret"`
+	// DataDir holds downloaded market data files.
+	DataDir string `json:"data_dir"`
+}
+
+// Defaults keeps a fresh checkout working as it did before settings could
+// be configured.
+var Defaults = Config{
+	DatabasePath:  "./winners-ai.db",
+	JournalMode:   "WAL",
+	BusyTimeoutMs: 5000,
+	ForeignKeys:   false,
+	DataDir:       "./data",
+}
+
+// EnvPrefix is prepended to the upper-cased JSON name of each setting to
+// form its environment variable, e.g. RACEPICKS_DATABASE_PATH.
+const EnvPrefix = "RACEPICKS_"
+
+// Load builds the configuration from args (without the program name). The
+// config file is named by -config or RACEPICKS_CONFIG; without either no
+// file is read.
+func Load(args []string) (Config, error) {
+	cfg := Defaults
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	file := fs.String("config", os.Getenv(EnvPrefix+"CONFIG"), "path to a JSON config file")
+	dbPath := fs.String("db", "", "SQLite database file")
+	journalMode := fs.String("journal-mode", "", "SQLite journal mode")
+	busyTimeout := fs.Int("busy-timeout", 0, "SQLite busy timeout in milliseconds")
+	foreignKeys := fs.Bool("foreign-keys", false, "enforce foreign keys")
+	listen := fs.String("listen", "", "HTTP listen address")
+	jwtSecret := fs.String("jwt-secret", "", "secret used to sign API tokens")
+	dataDir := fs.String("data-dir", "", "directory for downloaded market data")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if *file != "" {
+		if err := cfg.readFile(*file); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if err := cfg.readEnv(); err != nil {
+		return Config{}, err
+	}
+
+	// Only flags given on the command line override the layers below
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "db":
+			cfg.DatabasePath = *dbPath
+		case "journal-mode":
+			cfg.JournalMode = *journalMode
+		case "busy-timeout":
+			cfg.BusyTimeoutMs = *busyTimeout
+		case "foreign-keys":
+			cfg.ForeignKeys = *foreignKeys
+		case "listen":
+			cfg.ListenAddr = *listen
+		case "jwt-secret":
+			cfg.JWTSecret = *jwtSecret
+		case "data-dir":
+			cfg.DataDir = *dataDir
+		}
+	})
+
+	return cfg, cfg.validate()
+}
+
+func (cfg *Config) readFile(path string) error {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if err := json.Unmarshal(body, cfg); err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+func (cfg *Config) readEnv() error {
+	strs := map[string]*string{
+		"DATABASE_PATH": &cfg.DatabasePath,
+		"JOURNAL_MODE":  &cfg.JournalMode,
+		"LISTEN_ADDR":   &cfg.ListenAddr,
+		"JWT_SECRET":    &cfg.JWTSecret,
+		"DATA_DIR":      &cfg.DataDir,
+	}
+	for name, field := range strs {
+		if value, ok := os.LookupEnv(EnvPrefix + name); ok {
+			*field = value
+		}
+	}
+
+	if value, ok := os.LookupEnv(EnvPrefix + "BUSY_TIMEOUT_MS"); ok {
+		ms, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("config: %sBUSY_TIMEOUT_MS: %w", EnvPrefix, err)
+		}
+		cfg.BusyTimeoutMs = ms
+	}
+	if value, ok := os.LookupEnv(EnvPrefix + "FOREIGN_KEYS"); ok {
+		on, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("config: %sFOREIGN_KEYS: %w", EnvPrefix, err)
+		}
+		cfg.ForeignKeys = on
+	}
+	return nil
+}
+
+func (cfg Config) validate() error {
+	if cfg.DatabasePath == "" {
+		return fmt.Errorf("config: database path is empty")
+	}
+	if cfg.BusyTimeoutMs < 0 {
+		return fmt.Errorf("config: busy timeout must not be negative")
+	}
+	switch strings.ToUpper(cfg.JournalMode) {
+	case "", "DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF":
+	default:
+		return fmt.Errorf("config: unknown journal mode %q", cfg.JournalMode)
+	}
+	return nil
+}
+
+// DSN returns the go-sqlite3 data source name for the database with the
+// configured pragmas applied to every connection.
+func (cfg Config) DSN() string {
+	params := url.Values{}
+	if cfg.JournalMode != "" {
+		params.Set("_journal_mode", strings.ToUpper(cfg.JournalMode))
+	}
+	params.Set("_busy_timeout", strconv.Itoa(cfg.BusyTimeoutMs))
+	if cfg.ForeignKeys {
+		params.Set("_foreign_keys", "on")
+	} else {
+		params.Set("_foreign_keys", "off")
+	}
+	return "file:" + cfg.DatabasePath + "?" + params.Encode()
+}
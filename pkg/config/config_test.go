@@ -0,0 +1,40 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoadDefaultsLeaveForeignKeysOff(t *testing.T) {
+	// Setenv restores the variables when the test ends
+	for _, name := range []string{"FOREIGN_KEYS", "CONFIG"} {
+		t.Setenv(EnvPrefix+name, "")
+		os.Unsetenv(EnvPrefix + name)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		env  string
+		want string
+	}{
+		{"default", nil, "", "_foreign_keys=off"},
+		{"flag", []string{"-foreign-keys"}, "", "_foreign_keys=on"},
+		{"environment", nil, "true", "_foreign_keys=on"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.env != "" {
+				t.Setenv(EnvPrefix+"FOREIGN_KEYS", test.env)
+			}
+			cfg, err := Load(test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dsn := cfg.DSN(); !strings.Contains(dsn, test.want) {
+				t.Fatalf("DSN() = %q, want %s", dsn, test.want)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"database/sql"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/mmanjoura/race-picks-backend/pkg/config"
 	"github.com/mmanjoura/race-picks-backend/pkg/models"
 )
 
@@ -19,22 +20,43 @@ type DbInstance struct {
 
 var Database DbInstance
 
-func ConnectDatabase() {
+// Open opens the database described by cfg. The pragmas in cfg apply to
+// every connection in the pool.
+func Open(cfg config.Config) (*sql.DB, error) {
+	return sql.Open("sqlite3", cfg.DSN())
+}
+
+func ConnectDatabase(cfg config.Config) {
 
 	var err error
 
-	db, err := sql.Open("sqlite3", "./winners-ai.db")
+	db, err := Open(cfg)
 
 	if err != nil {
 		log.Fatal("Failed to connect to the database! \n", err)
 		os.Exit(2)
 	}
 
+	// Bring the schema up to date before anything reads from it
+	applied, err := Migrate(db)
+	checkErr(err)
+	for _, migration := range applied {
+		log.Printf("database: applied migration %04d_%s", migration.Version, migration.Name)
+	}
+
 	configuraions, err := GetConfigs(db)
 	fmt.Println(err)
 
 	checkErr(err)
 
+	// Settings given to the process win over the Configurations table
+	if cfg.JWTSecret != "" {
+		configuraions["JWT-API-KEY"] = cfg.JWTSecret
+	}
+	if cfg.ListenAddr != "" {
+		configuraions["PORT"] = cfg.ListenAddr
+	}
+
 	//DB = database
 	Database = DbInstance{
 		DB:     db,
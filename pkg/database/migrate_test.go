@@ -0,0 +1,53 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestMarketDataIDMigrationKeepsRows(t *testing.T) {
+	db, err := sql.Open("sqlite3", "file:TestMarketDataIDMigrationKeepsRows?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	// Bring the database to the version before MarketData got its own id
+	if _, err := db.Exec(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMP NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, migration := range migrations {
+		if migration.Version >= 15 {
+			break
+		}
+		if err := apply(db, migration); err != nil {
+			t.Fatalf("%04d_%s: %v", migration.Version, migration.Name, err)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO MarketData (event_id, selection_id, selection_name, bsp) VALUES (42, 7, 'Alpha', 4.2)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var id, eventID, selectionID int
+	var bsp float64
+	if err := db.QueryRow(`SELECT id, event_id, selection_id, bsp FROM MarketData`).Scan(&id, &eventID, &selectionID, &bsp); err != nil {
+		t.Fatal(err)
+	}
+	if id != 42 || eventID != 42 || selectionID != 7 || bsp != 4.2 {
+		t.Fatalf("row = id %d, event %d, selection %d, bsp %v; want 42, 42, 7, 4.2", id, eventID, selectionID, bsp)
+	}
+
+	// A second runner of the same race no longer clashes on event_id
+	if _, err := db.Exec(`INSERT INTO MarketData (event_id, selection_id) VALUES (42, 8)`); err != nil {
+		t.Fatal(err)
+	}
+}
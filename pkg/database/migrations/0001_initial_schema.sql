@@ -0,0 +1,130 @@
+-- Tables the application expected to exist before migrations were tracked.
+-- IF NOT EXISTS lets this run against databases created by hand.
+
+CREATE TABLE IF NOT EXISTS Configurations (
+    ID    INTEGER PRIMARY KEY AUTOINCREMENT,
+    key   TEXT    UNIQUE
+                  NOT NULL,
+    value TEXT    NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS Users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    full_name TEXT NOT NULL,
+    email TEXT UNIQUE NOT NULL,
+    password TEXT NOT NULL,
+    phone_number TEXT,
+    user_type TEXT,
+    profile TEXT,
+    avatar_url TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One row per runner declared for a race, filled in with the race conditions
+CREATE TABLE IF NOT EXISTS EventRunners (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    selection_id INTEGER,
+    selection_name TEXT,
+    selection_link TEXT,
+    event_link TEXT,
+    event_name TEXT,
+    event_date TIMESTAMP,
+    event_time TEXT,
+    price TEXT,
+    race_distance TEXT,
+    race_category TEXT,
+    track_condition TEXT,
+    number_of_runners TEXT,
+    race_track TEXT,
+    race_class TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_runners_event_date ON EventRunners (event_date);
+CREATE INDEX IF NOT EXISTS idx_event_runners_selection_id ON EventRunners (selection_id);
+
+-- One row per past run of a horse, scraped from its form page
+CREATE TABLE IF NOT EXISTS SelectionsForm (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    selection_id INTEGER,
+    selection_name TEXT,
+    race_class TEXT,
+    race_date TIMESTAMP,
+    position TEXT,
+    rating TEXT,
+    race_type TEXT,
+    racecourse TEXT,
+    distance TEXT,
+    going TEXT,
+    sp_odds TEXT,
+    Age TEXT,
+    Trainer TEXT,
+    Sex TEXT,
+    Sire TEXT,
+    Dam TEXT,
+    Owner TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_selections_form_selection_id ON SelectionsForm (selection_id, race_date);
+
+-- Top picks of each race written by TodayPredictions
+CREATE TABLE IF NOT EXISTS RaceStatistics (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_date TIMESTAMP,
+    event_name TEXT,
+    event_time TEXT,
+    selection_id INTEGER,
+    selection_name TEXT,
+    odds TEXT,
+    clean_bet_score REAL,
+    average_position REAL,
+    average_rating REAL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_race_statistics_event_date ON RaceStatistics (event_date);
+
+CREATE TABLE IF NOT EXISTS MarketData (
+    event_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    menu_hint TEXT,
+    event_name TEXT,
+    event_dt TEXT,
+    selection_id INTEGER,
+    selection_name TEXT,
+    win_lose TEXT,
+    bsp REAL,
+    ppwap REAL,
+    morning_wap REAL,
+    ppmax REAL,
+    ppmin REAL,
+    ipmax REAL,
+    ipmin REAL,
+    morning_traded_vol REAL,
+    pp_traded_vol REAL,
+    ip_traded_vol REAL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS OptimalParameters (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    race_type TEXT NOT NULL,
+    optimal_num_runs INTEGER DEFAULT 0,
+    optimal_num_years_in_competition INTEGER DEFAULT 0,
+    optimal_num_wins INTEGER DEFAULT 0,
+    optimal_rating REAL DEFAULT 0,
+    optimal_position REAL DEFAULT 0,
+    optimal_distance REAL DEFAULT 0
+);
+
+-- Points awarded per category/item when scoring a runner
+CREATE TABLE IF NOT EXISTS score_constants (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    category TEXT NOT NULL,
+    item TEXT NOT NULL,
+    score REAL NOT NULL DEFAULT 0,
+    UNIQUE (category, item)
+);
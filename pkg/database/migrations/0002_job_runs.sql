@@ -0,0 +1,14 @@
+-- One row per execution of a pipeline stage
+CREATE TABLE IF NOT EXISTS JobRuns (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    stage TEXT NOT NULL,
+    triggered_by TEXT NOT NULL,
+    run_date TEXT NOT NULL,
+    status TEXT NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP,
+    duration_ms INTEGER DEFAULT 0,
+    error TEXT DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_stage ON JobRuns (stage, run_date);
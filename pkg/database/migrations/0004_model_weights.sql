@@ -0,0 +1,10 @@
+-- Trained weights of the in-process predictors, one row per training run
+CREATE TABLE IF NOT EXISTS ModelWeights (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    model TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    weights TEXT NOT NULL,
+    stats TEXT,
+    trained_at TIMESTAMP NOT NULL,
+    UNIQUE(model, version)
+);
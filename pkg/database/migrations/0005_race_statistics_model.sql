@@ -0,0 +1,5 @@
+-- Record which prediction model and version produced each stored pick.
+-- Picks stored before models could be chosen came from the heuristic.
+ALTER TABLE RaceStatistics ADD COLUMN model TEXT NOT NULL DEFAULT 'heuristic';
+ALTER TABLE RaceStatistics ADD COLUMN model_version TEXT NOT NULL DEFAULT '1';
+CREATE INDEX IF NOT EXISTS idx_race_statistics_date_model ON RaceStatistics (event_date, model);
@@ -0,0 +1,15 @@
+-- Calibrations fitted to each model version's scores, and the probability
+-- and fair price stored with every pick.
+CREATE TABLE IF NOT EXISTS Calibrations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    model TEXT NOT NULL,
+    model_version TEXT NOT NULL,
+    method TEXT NOT NULL,
+    params TEXT NOT NULL,
+    stats TEXT,
+    fitted_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_calibrations_model ON Calibrations (model, model_version);
+
+ALTER TABLE RaceStatistics ADD COLUMN win_probability REAL;
+ALTER TABLE RaceStatistics ADD COLUMN fair_decimal_odds REAL;
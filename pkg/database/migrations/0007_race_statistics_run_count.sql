@@ -0,0 +1,3 @@
+-- Keep the number of runs each stored pick was scored on, which the value
+-- engine's confidence depends on.
+ALTER TABLE RaceStatistics ADD COLUMN run_count INTEGER NOT NULL DEFAULT 0;
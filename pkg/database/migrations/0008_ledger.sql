@@ -0,0 +1,24 @@
+-- One row per settled pick: its result, the price it was settled at, the
+-- stake and what it returned, and the strategy's balance after it.
+CREATE TABLE IF NOT EXISTS Ledger (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    strategy TEXT NOT NULL,
+    model TEXT NOT NULL,
+    model_version TEXT NOT NULL,
+    event_date TEXT NOT NULL,
+    event_name TEXT NOT NULL,
+    event_time TEXT NOT NULL,
+    selection_id INTEGER NOT NULL,
+    selection_name TEXT,
+    position TEXT,
+    won INTEGER NOT NULL,
+    price_source TEXT NOT NULL,
+    odds REAL NOT NULL,
+    stake REAL NOT NULL,
+    return REAL NOT NULL,
+    profit REAL NOT NULL,
+    balance REAL NOT NULL,
+    settled_at TIMESTAMP NOT NULL,
+    UNIQUE (strategy, event_date, event_name, event_time, selection_id)
+);
+CREATE INDEX IF NOT EXISTS idx_ledger_strategy_date ON Ledger (strategy, event_date);
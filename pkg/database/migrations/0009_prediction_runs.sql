@@ -0,0 +1,16 @@
+-- Every TodayPredictions run is kept with the picks it made, instead of
+-- replacing the day's picks. Picks stored before runs existed have no run.
+CREATE TABLE IF NOT EXISTS PredictionRuns (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_date TEXT NOT NULL,
+    model TEXT NOT NULL,
+    model_version TEXT NOT NULL,
+    parameters TEXT NOT NULL,
+    input_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    published_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_prediction_runs_date_model ON PredictionRuns (event_date, model);
+
+ALTER TABLE RaceStatistics ADD COLUMN run_id INTEGER REFERENCES PredictionRuns (id);
+CREATE INDEX IF NOT EXISTS idx_race_statistics_run ON RaceStatistics (run_id);
@@ -0,0 +1,9 @@
+-- Named bet-selection strategies. rules is the JSON of models.StrategyRules.
+CREATE TABLE IF NOT EXISTS Strategies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    rules TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,19 @@
+-- Weights and thresholds of the heuristic scorer. A profile is never
+-- changed once stored: editing one adds the next version of its name, and
+-- the heuristic model's version is the ID of the profile it scored with.
+-- The active profile is the one used when no version is asked for.
+CREATE TABLE IF NOT EXISTS ScoringProfiles (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    weights TEXT NOT NULL,
+    active INTEGER NOT NULL DEFAULT 0,
+    based_on INTEGER REFERENCES ScoringProfiles (id),
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (name, version)
+);
+
+-- The constants ScoreSelection was written with
+INSERT INTO ScoringProfiles (name, version, weights, active, created_at)
+SELECT 'default', 1, '{"few_runs":20,"few_runs_bonus":2,"distance_split":12,"short_distance_thresholds":[0.5,1,1.5],"long_distance_thresholds":[1.5,2,3.5],"distance_scores":[30,15,10,8,5],"non_finish_codes":["F","PU","U","R"],"non_finish_penalty":5,"unreadable_position_penalty":1,"position_multiplier":10}', 1, CURRENT_TIMESTAMP
+WHERE NOT EXISTS (SELECT 1 FROM ScoringProfiles);
@@ -0,0 +1,7 @@
+-- Rows written by the weight optimiser also record the scoring weights it
+-- found, the objective it searched on and how they scored.
+ALTER TABLE OptimalParameters ADD COLUMN weights TEXT;
+ALTER TABLE OptimalParameters ADD COLUMN objective TEXT;
+ALTER TABLE OptimalParameters ADD COLUMN train_score REAL;
+ALTER TABLE OptimalParameters ADD COLUMN test_score REAL;
+ALTER TABLE OptimalParameters ADD COLUMN optimised_at TIMESTAMP;
@@ -0,0 +1,38 @@
+-- A horse's form going into races from as_of_date on, computed from
+-- SelectionsForm when its runs are saved. There is a row for the day after
+-- each day it ran; the row read for a race is the latest one on or before
+-- the race date. Lists are JSON, most recent run first. Form saved before
+-- the table existed is added by POST /preparation/RebuildFeatures.
+CREATE TABLE IF NOT EXISTS RunnerFeatures (
+    selection_id INTEGER NOT NULL,
+    as_of_date TEXT NOT NULL,
+    selection_name TEXT,
+    age TEXT,
+    trainer TEXT,
+    sex TEXT,
+    sire TEXT,
+    dam TEXT,
+    owner TEXT,
+    race_class TEXT,
+    num_runs INTEGER NOT NULL,
+    win_count INTEGER NOT NULL,
+    first_run_date TEXT NOT NULL,
+    last_run_date TEXT NOT NULL,
+    duration INTEGER NOT NULL,
+    avg_position REAL NOT NULL,
+    avg_rating REAL NOT NULL,
+    avg_distance REAL NOT NULL,
+    avg_odds REAL NOT NULL,
+    positions TEXT NOT NULL,
+    finishes TEXT NOT NULL,
+    distances TEXT NOT NULL,
+    courses TEXT NOT NULL,
+    race_dates TEXT NOT NULL,
+    course_wins TEXT NOT NULL,
+    distance_wins TEXT NOT NULL,
+    rating_trend REAL NOT NULL,
+    last_class INTEGER NOT NULL,
+    class_change INTEGER NOT NULL,
+    computed_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (selection_id, as_of_date)
+);
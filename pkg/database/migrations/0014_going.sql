@@ -0,0 +1,4 @@
+-- The going band of each run and the record on each band. Rows stored
+-- before this are refilled by POST /preparation/RebuildFeatures.
+ALTER TABLE RunnerFeatures ADD COLUMN goings TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE RunnerFeatures ADD COLUMN going_records TEXT NOT NULL DEFAULT '{}';
@@ -0,0 +1,39 @@
+-- MarketData used Betfair's event_id as its primary key, so only one
+-- runner per race could be stored. Rows get their own id and event_id
+-- becomes a plain column. SQLite cannot change a primary key in place, so
+-- the table is copied.
+CREATE TABLE MarketData_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id INTEGER,
+    menu_hint TEXT,
+    event_name TEXT,
+    event_dt TEXT,
+    selection_id INTEGER,
+    selection_name TEXT,
+    win_lose TEXT,
+    bsp REAL,
+    ppwap REAL,
+    morning_wap REAL,
+    ppmax REAL,
+    ppmin REAL,
+    ipmax REAL,
+    ipmin REAL,
+    morning_traded_vol REAL,
+    pp_traded_vol REAL,
+    ip_traded_vol REAL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO MarketData_new (
+    id, event_id, menu_hint, event_name, event_dt, selection_id, selection_name, win_lose,
+    bsp, ppwap, morning_wap, ppmax, ppmin, ipmax, ipmin,
+    morning_traded_vol, pp_traded_vol, ip_traded_vol, created_at, updated_at)
+SELECT
+    event_id, event_id, menu_hint, event_name, event_dt, selection_id, selection_name, win_lose,
+    bsp, ppwap, morning_wap, ppmax, ppmin, ipmax, ipmin,
+    morning_traded_vol, pp_traded_vol, ip_traded_vol, created_at, updated_at
+FROM MarketData;
+
+DROP TABLE MarketData;
+ALTER TABLE MarketData_new RENAME TO MarketData;
@@ -0,0 +1,16 @@
+-- The default profile of 0011 predates the going, course and distance
+-- weights, so it scored the going at 0. Add its next version with the
+-- weights of scoring.Default, active if the default was. A default already
+-- edited into a later version is left alone.
+INSERT INTO ScoringProfiles (name, version, weights, active, based_on, created_at)
+SELECT 'default', 2, '{"few_runs":20,"few_runs_bonus":2,"distance_split":12,"short_distance_thresholds":[0.5,1,1.5],"long_distance_thresholds":[1.5,2,3.5],"distance_scores":[30,15,10,8,5],"non_finish_codes":["F","PU","U","R"],"non_finish_penalty":5,"unreadable_position_penalty":1,"position_multiplier":10,"going_score":20,"going_min_runs":2,"distance_tolerance":1}', active, id, CURRENT_TIMESTAMP
+FROM ScoringProfiles
+WHERE name = 'default' AND version = 1
+    AND NOT EXISTS (SELECT 1 FROM ScoringProfiles WHERE name = 'default' AND version > 1);
+
+UPDATE ScoringProfiles SET active = 0
+WHERE name = 'default' AND version = 1
+    AND EXISTS (SELECT 1 FROM ScoringProfiles WHERE name = 'default' AND version = 2 AND active = 1);
+
+-- RunnerFeatures rows stored before 0014 have no going; the server
+-- refreshes them when it starts (FeatureRepo.Stale).
@@ -0,0 +1,12 @@
+-- Runs and their picks were kept per date and model, with the strategy
+-- only in the run's parameters, so runs of two strategies replaced each
+-- other. Store the strategy with both and key current runs by it too.
+-- Runs made before strategies were named used the default one.
+ALTER TABLE PredictionRuns ADD COLUMN strategy TEXT NOT NULL DEFAULT '';
+UPDATE PredictionRuns SET strategy = COALESCE(NULLIF(json_extract(parameters, '$.strategy'), ''), 'default');
+
+ALTER TABLE RaceStatistics ADD COLUMN strategy TEXT NOT NULL DEFAULT '';
+UPDATE RaceStatistics SET strategy = COALESCE((SELECT pr.strategy FROM PredictionRuns pr WHERE pr.id = RaceStatistics.run_id), 'default');
+
+DROP INDEX IF EXISTS idx_prediction_runs_date_model;
+CREATE INDEX IF NOT EXISTS idx_prediction_runs_date_model_strategy ON PredictionRuns (event_date, model, strategy);
@@ -0,0 +1,13 @@
+-- The ledger was keyed by the pick's model rather than its strategy. Move
+-- each entry settled that way to the strategy of the pick it settled; an
+-- entry the strategy already has, or whose pick is gone, keeps its model.
+UPDATE OR IGNORE Ledger SET strategy = COALESCE((
+    SELECT rs.strategy FROM RaceStatistics rs
+    WHERE rs.model = Ledger.model
+        AND DATE(rs.event_date) = Ledger.event_date
+        AND rs.event_name = Ledger.event_name
+        AND rs.event_time = Ledger.event_time
+        AND rs.selection_id = Ledger.selection_id
+    ORDER BY rs.id DESC
+    LIMIT 1), strategy)
+WHERE strategy = model;
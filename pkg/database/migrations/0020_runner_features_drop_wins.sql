@@ -0,0 +1,6 @@
+-- Course and distance wins are counted from the runs' courses and
+-- distances when a race is scored (features.CourseDistance), with the
+-- race's distance tolerance, so the per-course and per-distance totals
+-- stored with each snapshot were never read.
+ALTER TABLE RunnerFeatures DROP COLUMN course_wins;
+ALTER TABLE RunnerFeatures DROP COLUMN distance_wins;
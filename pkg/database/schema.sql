@@ -1,3 +1,7 @@
+-- Historical reference only: this file is not run and is out of date.
+-- The schema is built by the embedded migrations in migrations/, which
+-- are the source of truth.
+
 -- Create table for User
 CREATE TABLE User (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
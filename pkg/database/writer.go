@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Writer serialises the process's writes, so concurrent ingests, jobs and
+// handlers queue for SQLite's single write lock instead of failing with
+// "database is locked". One Writer is shared by everything that writes to
+// a database.
+type Writer struct {
+	db   *sql.DB
+	slot chan struct{}
+}
+
+// NewWriter returns the writer for db.
+func NewWriter(db *sql.DB) *Writer {
+	return &Writer{db: db, slot: make(chan struct{}, 1)}
+}
+
+// Acquire waits until no other write is running and returns the function
+// that ends this one. It must not be called again before release, which
+// would wait forever.
+func (w *Writer) Acquire(ctx context.Context) (release func(), err error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case w.slot <- struct{}{}:
+		return func() { <-w.slot }, nil
+	}
+}
+
+// Do runs fn on the writer's database once no other write is running.
+func (w *Writer) Do(ctx context.Context, fn func(ctx context.Context, db *sql.DB) error) error {
+	release, err := w.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return fn(ctx, w.db)
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWriterRunsOneWriteAtATime(t *testing.T) {
+	w := NewWriter(nil)
+
+	var running, most int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := w.Do(context.Background(), func(ctx context.Context, db *sql.DB) error {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&most)
+					if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if most != 1 {
+		t.Fatalf("%d writes ran at once, want 1", most)
+	}
+}
+
+func TestWriterAcquireGivesUpWithContext(t *testing.T) {
+	w := NewWriter(nil)
+	release, err := w.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := w.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Acquire while held = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
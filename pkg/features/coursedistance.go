@@ -0,0 +1,79 @@
+package features
+
+import (
+	"math"
+	"strings"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// DefaultDistanceTolerance is how many furlongs either side of a race's
+// distance a run counts as over the distance, unless told otherwise.
+const DefaultDistanceTolerance = 1.0
+
+// surfaces are race_track values that name the surface rather than the
+// course.
+var surfaces = map[string]bool{
+	"turf": true, "all weather": true, "aw": true, "polytrack": true,
+	"tapeta": true, "fibresand": true, "dirt": true,
+}
+
+// RaceCourse returns the course a runner races at: its race_track, or the
+// meeting's name when race_track is empty or holds the surface, as it does
+// on most racecards.
+func RaceCourse(runner models.Runner) string {
+	track := strings.TrimSpace(runner.RaceTrack)
+	if track == "" || surfaces[strings.ToLower(track)] {
+		return runner.EventName
+	}
+	return track
+}
+
+// CourseDistance is a horse's record at course and within tolerance
+// furlongs of distance from its features, so it only counts the runs
+// before the date they were read at. Courses match ignoring case and any
+// bracketed suffix such as "(AW)".
+func CourseDistance(f models.RunnerFeatures, course string, distance, tolerance float64) models.CourseDistanceForm {
+	cd := models.CourseDistanceForm{Tolerance: tolerance}
+	course = courseKey(course)
+	for i, position := range f.Positions {
+		pos, _, finished := ParsePosition(position)
+		won := finished && pos == 1
+
+		atCourse := course != "" && i < len(f.Courses) && courseKey(f.Courses[i]) == course
+		atDistance := distance > 0 && i < len(f.Distances) && f.Distances[i] > 0 && math.Abs(f.Distances[i]-distance) <= tolerance
+		if atCourse {
+			cd.CourseRuns++
+			if won {
+				cd.CourseWins++
+			}
+		}
+		if atDistance {
+			cd.DistanceRuns++
+			if won {
+				cd.DistanceWins++
+			}
+		}
+		if atCourse && atDistance && won {
+			cd.CourseDistanceWinner = true
+		}
+	}
+
+	cd.CourseWinner = cd.CourseWins > 0
+	cd.DistanceWinner = cd.DistanceWins > 0
+	if cd.CourseRuns > 0 {
+		cd.CourseStrikeRate = float64(cd.CourseWins) / float64(cd.CourseRuns)
+	}
+	if cd.DistanceRuns > 0 {
+		cd.DistanceStrikeRate = float64(cd.DistanceWins) / float64(cd.DistanceRuns)
+	}
+	return cd
+}
+
+func courseKey(course string) string {
+	course = strings.ToLower(strings.TrimSpace(course))
+	if i := strings.Index(course, "("); i >= 0 {
+		course = strings.TrimSpace(course[:i])
+	}
+	return course
+}
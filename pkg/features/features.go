@@ -0,0 +1,235 @@
+// Package features turns a horse's past runs into the numeric inputs of the
+// learned predictors. Features are always computed from the runs before a
+// point in time, so training rows and live predictions see the same thing.
+package features
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/going"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/racing"
+)
+
+// Names lists the features in the order Compute returns them. They are the
+// figures GetMeetingRunners shows for each runner.
+var Names = []string{
+	"recovery_days",
+	"avg_position",
+	"avg_rating",
+	"avg_distance_furlongs",
+	"win_count",
+	"going_relative",
+}
+
+// Check returns an error if a model trained on names needs a feature
+// Compute no longer returns. Models trained before a feature was added
+// pass, and are fed only the features they were trained on by Select.
+func Check(names []string) error {
+	for _, name := range names {
+		if featureIndex(name) < 0 {
+			return fmt.Errorf("unknown feature %q", name)
+		}
+	}
+	return nil
+}
+
+// Select returns the features of x, in Names order, named by names, in
+// their order. names must have passed Check.
+func Select(x []float64, names []string) []float64 {
+	selected := make([]float64, len(names))
+	for i, name := range names {
+		selected[i] = x[featureIndex(name)]
+	}
+	return selected
+}
+
+// featureIndex is the position of name in Names, or -1.
+func featureIndex(name string) int {
+	for i, n := range Names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Sample is one historical run with the features of the horse going into
+// it and whether it won. Race identifies the race the run was in.
+type Sample struct {
+	SelectionID int
+	RaceDate    time.Time
+	Race        string
+	X           []float64
+	Won         bool
+}
+
+// ParsePosition splits a form position such as "2/11" into the finishing
+// position and the field size. ok is false for non-finishers (PU, F, UR...).
+func ParsePosition(position string) (pos, field int, ok bool) {
+	parts := strings.SplitN(strings.TrimSpace(position), "/", 2)
+	pos, err := strconv.Atoi(parts[0])
+	if err != nil || pos < 1 {
+		return 0, 0, false
+	}
+	if len(parts) == 2 {
+		field, _ = strconv.Atoi(parts[1])
+	}
+	return pos, field, true
+}
+
+// Compute returns the features of a horse at asOf, in a race run on the
+// going described by trackCondition, from its runs. Runs on or after asOf
+// are ignored. ok is false if the horse had not run before.
+func Compute(runs []models.SelectionsForm, asOf time.Time, trackCondition string) (x []float64, ok bool) {
+	var last time.Time
+	var count, positions, ratings, distances int
+	var sumPosition, sumRating, sumDistance float64
+	var wins int
+	var goingRuns []going.Run
+
+	for _, run := range runs {
+		if !run.RaceDate.Before(day(asOf)) {
+			continue
+		}
+		count++
+		if run.RaceDate.After(last) {
+			last = run.RaceDate
+		}
+		goingRuns = append(goingRuns, goingRunOf(run))
+
+		if pos, _, finished := ParsePosition(run.Position); finished {
+			positions++
+			sumPosition += float64(pos)
+			if pos == 1 {
+				wins++
+			}
+		}
+		if rating, err := strconv.ParseFloat(strings.TrimSpace(run.Rating), 64); err == nil {
+			ratings++
+			sumRating += rating
+		}
+		if distance := racing.ParseDistance(run.Distance); distance > 0 {
+			distances++
+			sumDistance += distance
+		}
+	}
+	if count == 0 {
+		return nil, false
+	}
+
+	return []float64{
+		day(asOf).Sub(day(last)).Hours() / 24,
+		mean(sumPosition, positions),
+		mean(sumRating, ratings),
+		mean(sumDistance, distances),
+		float64(wins),
+		going.Records(goingRuns)[going.Normalise(trackCondition)].Relative,
+	}, true
+}
+
+// Samples builds a training sample from every run in history that the horse
+// went into with at least one previous run. Runs without a result are
+// skipped; non-finishers count as losers.
+func Samples(history []models.SelectionsForm) []Sample {
+	bySelection := map[int][]models.SelectionsForm{}
+	for _, run := range history {
+		bySelection[run.SelectionID] = append(bySelection[run.SelectionID], run)
+	}
+
+	var samples []Sample
+	for selectionID, runs := range bySelection {
+		sort.Slice(runs, func(i, j int) bool { return runs[i].RaceDate.Before(runs[j].RaceDate) })
+		for i, run := range runs {
+			if strings.TrimSpace(run.Position) == "" {
+				continue
+			}
+			x, ok := Compute(runs[:i], run.RaceDate, run.Going)
+			if !ok {
+				continue
+			}
+			pos, _, finished := ParsePosition(run.Position)
+			samples = append(samples, Sample{
+				SelectionID: selectionID,
+				RaceDate:    run.RaceDate,
+				Race:        raceKey(run),
+				X:           x,
+				Won:         finished && pos == 1,
+			})
+		}
+	}
+
+	// Oldest first, so a holdout taken from the end is the most recent runs
+	sort.SliceStable(samples, func(i, j int) bool {
+		if !samples[i].RaceDate.Equal(samples[j].RaceDate) {
+			return samples[i].RaceDate.Before(samples[j].RaceDate)
+		}
+		return samples[i].SelectionID < samples[j].SelectionID
+	})
+	return samples
+}
+
+// Races groups samples into the races they were run in, oldest first. Form
+// rows carry no race ID, so a race is the runs at one course on one day
+// over the same distance with the same field size. Only races with exactly
+// one winner and at least one other runner are kept: the form of every
+// runner is not always stored.
+func Races(samples []Sample) [][]Sample {
+	index := map[string]int{}
+	var races [][]Sample
+	for _, sample := range samples {
+		i, ok := index[sample.Race]
+		if !ok {
+			i = len(races)
+			index[sample.Race] = i
+			races = append(races, nil)
+		}
+		races[i] = append(races[i], sample)
+	}
+
+	kept := races[:0]
+	for _, race := range races {
+		winners := 0
+		for _, sample := range race {
+			if sample.Won {
+				winners++
+			}
+		}
+		if winners == 1 && len(race) > 1 {
+			kept = append(kept, race)
+		}
+	}
+
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i][0].RaceDate.Before(kept[j][0].RaceDate) })
+	return kept
+}
+
+// raceKey identifies the race a form row was run in. Non-finishers keep
+// the field size too, e.g. "PU/9".
+func raceKey(run models.SelectionsForm) string {
+	field := ""
+	if parts := strings.SplitN(run.Position, "/", 2); len(parts) == 2 {
+		field = strings.TrimSpace(parts[1])
+	}
+	return strings.Join([]string{
+		strings.ToLower(strings.TrimSpace(run.Racecourse)),
+		day(run.RaceDate).Format("2006-01-02"),
+		strings.TrimSpace(run.Distance),
+		field,
+	}, "|")
+}
+
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func mean(sum float64, n int) float64 {
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
@@ -0,0 +1,142 @@
+package features
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParsePosition(t *testing.T) {
+	tests := []struct {
+		position   string
+		pos, field int
+		ok         bool
+	}{
+		{"1/8", 1, 8, true},
+		{" 3/10 ", 3, 10, true},
+		{"2", 2, 0, true},
+		{"PU/9", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		pos, field, ok := ParsePosition(tt.position)
+		if pos != tt.pos || field != tt.field || ok != tt.ok {
+			t.Errorf("ParsePosition(%q) = %d, %d, %v; want %d, %d, %v", tt.position, pos, field, ok, tt.pos, tt.field, tt.ok)
+		}
+	}
+}
+
+var testRuns = []models.SelectionsForm{
+	{RaceDate: date("2024-05-01"), Position: "3/10", Distance: "1m", Going: "Good", Rating: "70"},
+	{RaceDate: date("2024-05-20"), Position: "1/8", Distance: "1m", Going: "Soft", Rating: "74"},
+	{RaceDate: date("2024-06-10"), Position: "PU/9", Distance: "1m 2f", Going: "Good", Rating: ""},
+}
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name  string
+		asOf  string
+		going string
+		want  []float64
+		ok    bool
+	}{
+		{name: "before the first run", asOf: "2024-05-01", ok: false},
+		{name: "one run", asOf: "2024-05-08", going: "Good", want: []float64{7, 3, 70, 8, 0}, ok: true},
+		{name: "a race's own day is left out", asOf: "2024-06-10", going: "Soft", want: []float64{21, 2, 72, 8, 1}, ok: true},
+		{name: "non-finishers count as runs only", asOf: "2024-06-20", going: "Good", want: []float64{10, 2, 72, 26.0 / 3, 1}, ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, ok := Compute(testRuns, date(tt.asOf), tt.going)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if len(x) != len(Names) {
+				t.Fatalf("got %d features, want %d", len(x), len(Names))
+			}
+			for i, want := range tt.want {
+				if math.Abs(x[i]-want) > 1e-9 {
+					t.Errorf("%s = %v, want %v", Names[i], x[i], want)
+				}
+			}
+		})
+	}
+}
+
+// The live predictors read FromSnapshot while training reads Compute, so
+// the two have to agree on every day and going.
+func TestFromSnapshotMatchesCompute(t *testing.T) {
+	snapshots := Snapshots(testRuns)
+	for _, asOf := range []string{"2024-05-02", "2024-05-08", "2024-05-21", "2024-06-10", "2024-06-11", "2024-07-01"} {
+		for _, going := range []string{"Good", "Soft", "Heavy", ""} {
+			want, wantOK := Compute(testRuns, date(asOf), going)
+
+			var snapshot models.RunnerFeatures
+			for _, s := range snapshots {
+				if s.AsOfDate <= asOf {
+					snapshot = s
+				}
+			}
+			got, ok := FromSnapshot(snapshot, date(asOf), going)
+			if ok != wantOK {
+				t.Fatalf("%s on %q: ok = %v, want %v", asOf, going, ok, wantOK)
+			}
+			for i := range want {
+				if math.Abs(got[i]-want[i]) > 1e-9 {
+					t.Errorf("%s on %q: %s = %v, Compute has %v", asOf, going, Names[i], got[i], want[i])
+				}
+			}
+		}
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	snapshots := Snapshots(testRuns)
+	if len(snapshots) != 3 {
+		t.Fatalf("got %d snapshots, want 3", len(snapshots))
+	}
+	last := snapshots[2]
+	if last.AsOfDate != "2024-06-11" || last.NumRuns != 3 || last.WinCount != 1 || last.LastRunDate != "2024-06-10" {
+		t.Errorf("last snapshot = %s, %d runs, %d wins, last run %s; want 2024-06-11, 3, 1, 2024-06-10",
+			last.AsOfDate, last.NumRuns, last.WinCount, last.LastRunDate)
+	}
+	if last.Positions[0] != "PU/9" {
+		t.Errorf("latest position = %q, want PU/9", last.Positions[0])
+	}
+}
+
+func TestSelect(t *testing.T) {
+	x := []float64{7, 3, 70, 8, 0, 0.25}
+
+	// A model trained before going_relative was added
+	old := Names[:5]
+	if err := Check(old); err != nil {
+		t.Fatalf("Check(%v) = %v", old, err)
+	}
+	if got := Select(x, old); !reflect.DeepEqual(got, x[:5]) {
+		t.Errorf("Select(%v) = %v, want %v", old, got, x[:5])
+	}
+
+	reordered := []string{"going_relative", "recovery_days"}
+	if got := Select(x, reordered); !reflect.DeepEqual(got, []float64{0.25, 7}) {
+		t.Errorf("Select(%v) = %v, want [0.25 7]", reordered, got)
+	}
+
+	if err := Check([]string{"recovery_days", "draw"}); err == nil {
+		t.Error("Check accepted a feature Compute does not return")
+	}
+}
@@ -0,0 +1,193 @@
+package features
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/going"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/racing"
+)
+
+// TrendRuns is how many of the latest rated runs RatingTrend is fitted to.
+const TrendRuns = 5
+
+// Snapshots returns the stored features of a horse after each day it ran:
+// the snapshot dated the day after a run holds every run up to and
+// including that day, and stands until the horse runs again. runs may come
+// in any order.
+func Snapshots(runs []models.SelectionsForm) []models.RunnerFeatures {
+	sorted := append([]models.SelectionsForm(nil), runs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].RaceDate.Before(sorted[j].RaceDate) })
+
+	var snapshots []models.RunnerFeatures
+	for i, run := range sorted {
+		if i+1 < len(sorted) && day(sorted[i+1].RaceDate).Equal(day(run.RaceDate)) {
+			continue
+		}
+		snapshots = append(snapshots, Snapshot(sorted[:i+1], day(run.RaceDate).AddDate(0, 0, 1)))
+	}
+	return snapshots
+}
+
+// Snapshot computes the features of a horse dated asOf from its runs,
+// oldest first, which must all be before asOf. The selection name is not
+// part of a run and is left to the caller.
+func Snapshot(runs []models.SelectionsForm, asOf time.Time) models.RunnerFeatures {
+	f := models.RunnerFeatures{
+		AsOfDate:     day(asOf).Format(racing.EventDateLayout),
+		NumRuns:      len(runs),
+		Positions:    []string{},
+		Finishes:     []float64{},
+		Distances:    []float64{},
+		Courses:      []string{},
+		RaceDates:    []string{},
+		Goings:       []string{},
+		GoingRecords: map[string]models.GoingRecord{},
+	}
+	if len(runs) == 0 {
+		return f
+	}
+
+	first, last := runs[0], runs[len(runs)-1]
+	f.SelectionID = last.SelectionID
+	f.Age = last.Age
+	f.Trainer = last.Trainer
+	f.Sex = last.Sex
+	f.Sire = last.Sire
+	f.Dam = last.Dam
+	f.Owner = last.Owner
+	f.RaceClass = last.RaceClass
+	f.FirstRunDate = day(first.RaceDate).Format(racing.EventDateLayout)
+	f.LastRunDate = day(last.RaceDate).Format(racing.EventDateLayout)
+	f.Duration = last.RaceDate.Year() - first.RaceDate.Year()
+
+	var positions, distances, prices int
+	var sumPosition, sumDistance, sumOdds float64
+	var ratings []float64
+	var goingRuns []going.Run
+	for i := len(runs) - 1; i >= 0; i-- {
+		run := runs[i]
+		position := strings.TrimSpace(run.Position)
+		distance := racing.ParseDistance(strings.TrimSpace(run.Distance))
+		course := strings.TrimSpace(run.Racecourse)
+
+		f.Positions = append(f.Positions, position)
+		f.Distances = append(f.Distances, distance)
+		f.Courses = append(f.Courses, course)
+		f.RaceDates = append(f.RaceDates, day(run.RaceDate).Format(racing.EventDateLayout))
+		f.Goings = append(f.Goings, going.Normalise(run.Going))
+
+		pos, _, finished := ParsePosition(position)
+		goingRun := goingRunOf(run)
+		if goingRun.HasFinish {
+			f.Finishes = append(f.Finishes, goingRun.Finish)
+		}
+		goingRuns = append(goingRuns, goingRun)
+		if finished {
+			positions++
+			sumPosition += float64(pos)
+		}
+		if finished && pos == 1 {
+			f.WinCount++
+		}
+
+		if distance > 0 {
+			distances++
+			sumDistance += distance
+		}
+		if rating, err := strconv.ParseFloat(strings.TrimSpace(run.Rating), 64); err == nil {
+			ratings = append(ratings, rating)
+		}
+		if odds := racing.ParseOdds(strings.TrimSpace(run.SPOdds)); odds > 0 {
+			prices++
+			sumOdds += odds - 1
+		}
+	}
+
+	f.AvgPosition = mean(sumPosition, positions)
+	f.AvgDistance = mean(sumDistance, distances)
+	f.AvgOdds = mean(sumOdds, prices)
+	var sumRating float64
+	for _, rating := range ratings {
+		sumRating += rating
+	}
+	f.AvgRating = mean(sumRating, len(ratings))
+	f.RatingTrend = trend(ratings)
+	f.GoingRecords = going.Records(goingRuns)
+
+	f.LastClass = ParseClass(last.RaceClass)
+	if len(runs) > 1 {
+		if previous := ParseClass(runs[len(runs)-2].RaceClass); previous > 0 && f.LastClass > 0 {
+			f.ClassChange = previous - f.LastClass
+		}
+	}
+	return f
+}
+
+// FromSnapshot returns the features Compute would return at asOf, in a race
+// run on the going described by trackCondition, from the stored snapshot f
+// read at asOf. ok is false if the horse had not run before.
+func FromSnapshot(f models.RunnerFeatures, asOf time.Time, trackCondition string) (x []float64, ok bool) {
+	last, err := time.Parse(racing.EventDateLayout, f.LastRunDate)
+	if f.NumRuns == 0 || err != nil {
+		return nil, false
+	}
+
+	return []float64{
+		day(asOf).Sub(last).Hours() / 24,
+		f.AvgPosition,
+		f.AvgRating,
+		f.AvgDistance,
+		float64(f.WinCount),
+		f.GoingRecords[going.Normalise(trackCondition)].Relative,
+	}, true
+}
+
+// goingRunOf is the going and result of run.
+func goingRunOf(run models.SelectionsForm) going.Run {
+	position := strings.TrimSpace(run.Position)
+	pos, field, finished := ParsePosition(position)
+	r := going.Run{Going: going.Normalise(run.Going), Won: finished && pos == 1, Placed: finished && pos <= 3}
+	switch {
+	case finished && field > 0:
+		r.Finish, r.HasFinish = float64(pos)/float64(field), true
+	case !finished && position != "":
+		r.Finish, r.HasFinish = 1, true
+	}
+	return r
+}
+
+var classNumber = regexp.MustCompile(`\d+`)
+
+// ParseClass returns the number of a race class such as "Class 4", or 0.
+func ParseClass(class string) int {
+	n, _ := strconv.Atoi(classNumber.FindString(class))
+	return n
+}
+
+// trend is the least-squares slope of the latest TrendRuns ratings, given
+// most recent first, per run. It is 0 with fewer than two ratings.
+func trend(ratings []float64) float64 {
+	if len(ratings) > TrendRuns {
+		ratings = ratings[:TrendRuns]
+	}
+	n := float64(len(ratings))
+	if n < 2 {
+		return 0
+	}
+
+	// x counts runs forward in time, so the latest rating has the largest x
+	var sumX, sumY, sumXY, sumXX float64
+	for i, rating := range ratings {
+		x := n - 1 - float64(i)
+		sumX += x
+		sumY += rating
+		sumXY += x * rating
+		sumXX += x * x
+	}
+	return (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+}
@@ -0,0 +1,193 @@
+// Package going puts the official going descriptions on one ordinal scale
+// per surface and measures how a horse's form changes with the going.
+package going
+
+import (
+	"strings"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// Surfaces.
+const (
+	Turf       = "turf"
+	AllWeather = "all_weather"
+)
+
+// MinRuns is how many runs on a band a horse needs before the band can be
+// its preferred going.
+const MinRuns = 2
+
+// Bands of each surface, firmest or fastest first. A going's Scale is its
+// index here plus one.
+var (
+	TurfBands       = []string{"Firm", "Good to Firm", "Good", "Good to Soft", "Soft", "Heavy"}
+	AllWeatherBands = []string{"Fast", "Standard to Fast", "Standard", "Standard to Slow", "Slow"}
+)
+
+// Going is a going description put on its surface's scale.
+type Going struct {
+	Surface string
+	Scale   int
+}
+
+// Name is the band's name, e.g. "Good to Soft".
+func (g Going) Name() string {
+	if g.Surface == AllWeather {
+		return AllWeatherBands[g.Scale-1]
+	}
+	return TurfBands[g.Scale-1]
+}
+
+// descriptions maps the descriptions in official going reports and the
+// abbreviations of form tables onto the bands. Irish and French
+// descriptions without a band of their own go to the nearest one.
+var descriptions = map[string]Going{
+	"hard":             {Turf, 1},
+	"firm":             {Turf, 1},
+	"f":                {Turf, 1},
+	"hd":               {Turf, 1},
+	"good to firm":     {Turf, 2},
+	"good-firm":        {Turf, 2},
+	"gf":               {Turf, 2},
+	"gd/fm":            {Turf, 2},
+	"good":             {Turf, 3},
+	"g":                {Turf, 3},
+	"gd":               {Turf, 3},
+	"good to yielding": {Turf, 4},
+	"good to soft":     {Turf, 4},
+	"good-soft":        {Turf, 4},
+	"yielding":         {Turf, 4},
+	"gs":               {Turf, 4},
+	"gy":               {Turf, 4},
+	"gd/sft":           {Turf, 4},
+	"y":                {Turf, 4},
+	"yielding to soft": {Turf, 5},
+	"soft":             {Turf, 5},
+	"very soft":        {Turf, 5},
+	"holding":          {Turf, 5},
+	"s":                {Turf, 5},
+	"sft":              {Turf, 5},
+	"ys":               {Turf, 5},
+	"vs":               {Turf, 5},
+	"soft to heavy":    {Turf, 6},
+	"heavy":            {Turf, 6},
+	"sh":               {Turf, 6},
+	"h":                {Turf, 6},
+	"hy":               {Turf, 6},
+	"hvy":              {Turf, 6},
+	"fast":             {AllWeather, 1},
+	"ft":               {AllWeather, 1},
+	"standard to fast": {AllWeather, 2},
+	"sf":               {AllWeather, 2},
+	"std/fst":          {AllWeather, 2},
+	"standard":         {AllWeather, 3},
+	"std":              {AllWeather, 3},
+	"st":               {AllWeather, 3},
+	"standard to slow": {AllWeather, 4},
+	"ss":               {AllWeather, 4},
+	"std/slw":          {AllWeather, 4},
+	"slow":             {AllWeather, 5},
+	"slw":              {AllWeather, 5},
+	"sl":               {AllWeather, 5},
+}
+
+// Parse puts a going description on its scale. Qualifiers in brackets,
+// such as "Good to Soft (Good in places)", and case are ignored. ok is
+// false for descriptions it does not know.
+func Parse(description string) (g Going, ok bool) {
+	d := strings.ToLower(strings.TrimSpace(description))
+	if g, ok = descriptions[d]; ok {
+		return g, true
+	}
+	if i := strings.Index(d, "("); i >= 0 {
+		d = strings.TrimSpace(d[:i])
+	}
+	d = strings.Join(strings.Fields(d), " ")
+	g, ok = descriptions[d]
+	return g, ok
+}
+
+// Normalise returns the band name of a description, or "" if it is not
+// known.
+func Normalise(description string) string {
+	if g, ok := Parse(description); ok {
+		return g.Name()
+	}
+	return ""
+}
+
+// Run is the going and result of one run. Finish is position over field
+// size, 1 for a non-finisher; HasFinish is false when the field size is
+// unknown.
+type Run struct {
+	Going     string
+	Finish    float64
+	HasFinish bool
+	Won       bool
+	Placed    bool
+}
+
+// Records returns a horse's record on each band it has run on, keyed by
+// band name. Runs on unknown going are left out.
+func Records(runs []Run) map[string]models.GoingRecord {
+	var finishes int
+	var sumFinish float64
+	sums := map[string]float64{}
+	counts := map[string]int{}
+	records := map[string]models.GoingRecord{}
+	for _, run := range runs {
+		if run.HasFinish {
+			finishes++
+			sumFinish += run.Finish
+		}
+		if run.Going == "" {
+			continue
+		}
+
+		record := records[run.Going]
+		record.Runs++
+		if run.Won {
+			record.Wins++
+		}
+		if run.Placed {
+			record.Places++
+		}
+		if run.HasFinish {
+			counts[run.Going]++
+			sums[run.Going] += run.Finish
+		}
+		records[run.Going] = record
+	}
+
+	for band, record := range records {
+		if counts[band] > 0 {
+			record.AvgFinish = sums[band] / float64(counts[band])
+			record.Relative = sumFinish/float64(finishes) - record.AvgFinish
+		}
+		records[band] = record
+	}
+	return records
+}
+
+// Form is a horse's form on the going of the race it runs in, described
+// by trackCondition.
+func Form(f models.RunnerFeatures, trackCondition string) models.GoingForm {
+	var form models.GoingForm
+	if g, ok := Parse(trackCondition); ok {
+		form.Going = g.Name()
+		form.Scale = g.Scale
+		form.Record = f.GoingRecords[form.Going]
+	}
+
+	best := 0.0
+	for band, record := range f.GoingRecords {
+		if record.Runs < MinRuns || record.AvgFinish == 0 {
+			continue
+		}
+		if form.Preferred == "" || record.Relative > best || (record.Relative == best && band < form.Preferred) {
+			form.Preferred, best = band, record.Relative
+		}
+	}
+	return form
+}
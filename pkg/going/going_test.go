@@ -0,0 +1,134 @@
+package going
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		description string
+		want        Going
+		ok          bool
+	}{
+		{"Good", Going{Turf, 3}, true},
+		{"good to soft", Going{Turf, 4}, true},
+		{"Good To Soft (Good in places)", Going{Turf, 4}, true},
+		{"  Soft  to   Heavy ", Going{Turf, 6}, true},
+		{"GF", Going{Turf, 2}, true},
+		{"Yielding", Going{Turf, 4}, true},
+		{"Standard", Going{AllWeather, 3}, true},
+		{"Std/Slw", Going{AllWeather, 4}, true},
+		{"Fast", Going{AllWeather, 1}, true},
+		{"", Going{}, false},
+		{"Muddy", Going{}, false},
+		{"(Good)", Going{}, false},
+	}
+	for _, tt := range tests {
+		g, ok := Parse(tt.description)
+		if g != tt.want || ok != tt.ok {
+			t.Errorf("Parse(%q) = %+v, %v; want %+v, %v", tt.description, g, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNormalise(t *testing.T) {
+	tests := []struct {
+		description, want string
+	}{
+		{"gd/sft", "Good to Soft"},
+		{"HVY", "Heavy"},
+		{"Hard", "Firm"},
+		{"std", "Standard"},
+		{"Standard to Slow", "Standard to Slow"},
+		{"unknown", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalise(tt.description); got != tt.want {
+			t.Errorf("Normalise(%q) = %q, want %q", tt.description, got, tt.want)
+		}
+	}
+}
+
+func TestRecords(t *testing.T) {
+	runs := []Run{
+		{Going: "Good", Finish: 0.5, HasFinish: true, Placed: true},
+		{Going: "Good", Finish: 0.3, HasFinish: true},
+		{Going: "Soft", Finish: 0.1, HasFinish: true, Won: true, Placed: true},
+		{Going: "Soft", Finish: 1, HasFinish: true},
+		// Field size unknown: counted as a run but not a finish
+		{Going: "Soft", Won: true, Placed: true},
+		// Unknown going: counts towards the overall finish only
+		{Going: "", Finish: 0.2, HasFinish: true},
+	}
+	// Overall finish is (0.5+0.3+0.1+1+0.2)/5 = 0.42
+	tests := []struct {
+		band string
+		want models.GoingRecord
+	}{
+		{"Good", models.GoingRecord{Runs: 2, Places: 1, AvgFinish: 0.4, Relative: 0.02}},
+		{"Soft", models.GoingRecord{Runs: 3, Wins: 2, Places: 2, AvgFinish: 0.55, Relative: -0.13}},
+	}
+
+	records := Records(runs)
+	if len(records) != len(tests) {
+		t.Fatalf("Records = %v, want %d bands", records, len(tests))
+	}
+	for _, tt := range tests {
+		got := records[tt.band]
+		if got.Runs != tt.want.Runs || got.Wins != tt.want.Wins || got.Places != tt.want.Places ||
+			math.Abs(got.AvgFinish-tt.want.AvgFinish) > 1e-12 || math.Abs(got.Relative-tt.want.Relative) > 1e-12 {
+			t.Errorf("record on %s = %+v, want %+v", tt.band, got, tt.want)
+		}
+	}
+
+	if records := Records(nil); len(records) != 0 {
+		t.Errorf("Records(nil) = %v, want none", records)
+	}
+}
+
+func TestForm(t *testing.T) {
+	f := models.RunnerFeatures{GoingRecords: map[string]models.GoingRecord{
+		"Good":         {Runs: 3, AvgFinish: 0.4, Relative: 0.05},
+		"Soft":         {Runs: 2, AvgFinish: 0.3, Relative: 0.15},
+		"Heavy":        {Runs: 1, AvgFinish: 0.1, Relative: 0.35},
+		"Good to Soft": {Runs: 2, AvgFinish: 0.3, Relative: 0.15},
+	}}
+
+	tests := []struct {
+		name           string
+		trackCondition string
+		want           models.GoingForm
+	}{
+		{
+			// Heavy has too few runs; Soft and Good to Soft tie and the
+			// first by name is preferred
+			name:           "known going",
+			trackCondition: "Good (Good to Firm in places)",
+			want:           models.GoingForm{Going: "Good", Scale: 3, Record: f.GoingRecords["Good"], Preferred: "Good to Soft"},
+		},
+		{
+			name:           "going it has not run on",
+			trackCondition: "Firm",
+			want:           models.GoingForm{Going: "Firm", Scale: 1, Preferred: "Good to Soft"},
+		},
+		{
+			name:           "unknown going",
+			trackCondition: "",
+			want:           models.GoingForm{Preferred: "Good to Soft"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Form(f, tt.trackCondition); got != tt.want {
+				t.Errorf("Form = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if got := Form(models.RunnerFeatures{}, "Soft"); got.Preferred != "" {
+		t.Errorf("Form of an unraced horse prefers %q", got.Preferred)
+	}
+}
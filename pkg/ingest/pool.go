@@ -0,0 +1,161 @@
+// Package ingest scrapes many runners concurrently without hammering the
+// source site. Their writes go through the process's database.Writer.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/racedata"
+	"golang.org/x/time/rate"
+)
+
+// Options tune a Pool.
+type Options struct {
+	// Workers is the number of runners processed at once.
+	Workers int
+	// Delay is the minimum gap between two requests to the same host.
+	Delay time.Duration
+	// Retries is how many times a failed request is retried.
+	Retries int
+	// Backoff is the wait before the first retry; it doubles on each retry.
+	Backoff time.Duration
+}
+
+// DefaultOptions keeps a full day's card to a few minutes while staying at
+// four requests a second against the source site.
+var DefaultOptions = Options{
+	Workers: 4,
+	Delay:   250 * time.Millisecond,
+	Retries: 3,
+	Backoff: time.Second,
+}
+
+// Pool runs work on a bounded number of goroutines and paces requests per
+// host.
+type Pool struct {
+	opts Options
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// NewPool returns a pool using opts, falling back to DefaultOptions for any
+// field left at zero.
+func NewPool(opts Options) *Pool {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultOptions.Workers
+	}
+	if opts.Delay <= 0 {
+		opts.Delay = DefaultOptions.Delay
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultOptions.Backoff
+	}
+	return &Pool{opts: opts, limiters: make(map[string]*rate.Limiter)}
+}
+
+// Run calls work for every index in [0, n) on at most Workers goroutines and
+// reports each outcome to done, which may be called concurrently. Once ctx is
+// cancelled no new work starts and Run returns ctx.Err().
+func (p *Pool) Run(ctx context.Context, n int, work func(ctx context.Context, i int) error, done func(i int, err error)) error {
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < p.opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				done(i, work(ctx, i))
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		case indexes <- i:
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	return err
+}
+
+// Fetch waits for the link's host to be free, then calls fetch, retrying
+// with exponential backoff. Layout changes reported by racedata are not
+// retried. Site-relative links all share one limiter.
+func (p *Pool) Fetch(ctx context.Context, link string, fetch func() error) error {
+	limiter := p.limiter(hostOf(link))
+	backoff := p.opts.Backoff
+
+	var err error
+	for attempt := 0; attempt <= p.opts.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		if werr := limiter.Wait(ctx); werr != nil {
+			return werr
+		}
+
+		if err = fetch(); err == nil || errors.Is(err, racedata.ErrSelectorNoMatch) {
+			return err
+		}
+	}
+	return err
+}
+
+func (p *Pool) limiter(host string) *rate.Limiter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	limiter, ok := p.limiters[host]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Every(p.opts.Delay), 1)
+		p.limiters[host] = limiter
+	}
+	return limiter
+}
+
+func hostOf(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// OptionsFromConfig returns DefaultOptions overridden by the SCRAPE_WORKERS,
+// SCRAPE_DELAY_MS and SCRAPE_RETRIES keys of the Configurations table.
+func OptionsFromConfig(config map[string]string) Options {
+	opts := DefaultOptions
+	if v, err := strconv.Atoi(config["SCRAPE_WORKERS"]); err == nil {
+		opts.Workers = v
+	}
+	if v, err := strconv.Atoi(config["SCRAPE_DELAY_MS"]); err == nil {
+		opts.Delay = time.Duration(v) * time.Millisecond
+	}
+	if v, err := strconv.Atoi(config["SCRAPE_RETRIES"]); err == nil {
+		opts.Retries = v
+	}
+	return opts
+}
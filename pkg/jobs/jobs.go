@@ -0,0 +1,203 @@
+// Package jobs runs long-running handlers in a background worker and keeps
+// their progress in the Jobs table, so clients can poll instead of holding
+// an HTTP request open.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// Job statuses stored in Jobs.
+const (
+	StatusQueued      = "queued"
+	StatusRunning     = "running"
+	StatusSucceeded   = "succeeded"
+	StatusFailed      = "failed"
+	StatusInterrupted = "interrupted"
+)
+
+// ErrQueueFull is returned by Submit when the worker is saturated.
+var ErrQueueFull = errors.New("job queue is full")
+
+// Work is the body of a job. Its result is stored as JSON.
+type Work func(ctx context.Context, progress *Progress) (interface{}, error)
+
+type task struct {
+	id   int64
+	work Work
+}
+
+// Manager owns the queue and the worker goroutine.
+type Manager struct {
+	db     *sql.DB
+	writer *database.Writer
+	queue  chan task
+}
+
+var current *Manager
+
+// Start marks jobs left unfinished by a previous process as interrupted and
+// starts the worker. Jobs run one at a time, in submission order, and save
+// their state through writer.
+func Start(ctx context.Context, db *sql.DB, writer *database.Writer) (*Manager, error) {
+	err := writer.Do(ctx, func(ctx context.Context, db *sql.DB) error {
+		_, err := db.ExecContext(ctx, `
+			UPDATE Jobs SET status = ?, finished_at = ?
+			WHERE status IN (?, ?)`,
+			StatusInterrupted, time.Now(), StatusQueued, StatusRunning)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{db: db, writer: writer, queue: make(chan task, 16)}
+	current = m
+
+	go m.work(ctx)
+
+	return m, nil
+}
+
+// Submit stores a queued job of the given kind and returns its ID.
+func Submit(ctx context.Context, kind string, work Work) (int64, error) {
+	if current == nil {
+		return 0, errors.New("job manager is not running")
+	}
+	return current.Submit(ctx, kind, work)
+}
+
+// Submit stores a queued job of the given kind and returns its ID.
+func (m *Manager) Submit(ctx context.Context, kind string, work Work) (int64, error) {
+	var id int64
+	err := m.writer.Do(ctx, func(ctx context.Context, db *sql.DB) error {
+		res, err := db.ExecContext(ctx, `
+			INSERT INTO Jobs (kind, status, created_at) VALUES (?, ?, ?)`,
+			kind, StatusQueued, time.Now())
+		if err != nil {
+			return err
+		}
+		id, err = res.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case m.queue <- task{id: id, work: work}:
+		return id, nil
+	default:
+		m.finish(id, nil, ErrQueueFull)
+		return 0, ErrQueueFull
+	}
+}
+
+func (m *Manager) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-m.queue:
+			m.run(ctx, t)
+		}
+	}
+}
+
+func (m *Manager) run(ctx context.Context, t task) {
+	err := m.writer.Do(ctx, func(ctx context.Context, db *sql.DB) error {
+		_, err := db.ExecContext(ctx, `UPDATE Jobs SET status = ?, started_at = ? WHERE id = ?`,
+			StatusRunning, time.Now(), t.id)
+		return err
+	})
+	if err != nil {
+		log.Printf("jobs: starting job %d: %v", t.id, err)
+	}
+
+	progress := &Progress{writer: m.writer, jobID: t.id}
+	result, runErr := t.work(ctx, progress)
+	progress.flush()
+	m.finish(t.id, result, runErr)
+}
+
+func (m *Manager) finish(id int64, result interface{}, runErr error) {
+	status, message := StatusSucceeded, ""
+	if runErr != nil {
+		status, message = StatusFailed, runErr.Error()
+	}
+
+	var encoded []byte
+	if result != nil {
+		var err error
+		if encoded, err = json.Marshal(result); err != nil {
+			log.Printf("jobs: encoding result of job %d: %v", id, err)
+		}
+	}
+
+	// The job's own context may be done; its outcome is still recorded
+	err := m.writer.Do(context.Background(), func(ctx context.Context, db *sql.DB) error {
+		_, err := db.ExecContext(ctx, `
+			UPDATE Jobs SET status = ?, result = ?, error = ?, finished_at = ?
+			WHERE id = ?`,
+			status, encoded, message, time.Now(), id)
+		return err
+	})
+	if err != nil {
+		log.Printf("jobs: finishing job %d: %v", id, err)
+	}
+}
+
+// Get loads a job by ID. It returns sql.ErrNoRows when there is none.
+func Get(ctx context.Context, db *sql.DB, id int64) (models.Job, error) {
+	var job models.Job
+	var failures, result []byte
+	var message sql.NullString
+	var startedAt, finishedAt sql.NullTime
+
+	err := db.QueryRowContext(ctx, `
+		SELECT id, kind, status, total, processed, failures, result, error, created_at, started_at, finished_at
+		FROM Jobs WHERE id = ?`, id).
+		Scan(
+			&job.ID,
+			&job.Kind,
+			&job.Status,
+			&job.Total,
+			&job.Processed,
+			&failures,
+			&result,
+			&message,
+			&job.CreatedAt,
+			&startedAt,
+			&finishedAt,
+		)
+	if err != nil {
+		return job, err
+	}
+
+	job.Failures = []models.JobFailure{}
+	if len(failures) > 0 {
+		if err := json.Unmarshal(failures, &job.Failures); err != nil {
+			return job, err
+		}
+	}
+	if len(result) > 0 {
+		job.Result = result
+	}
+	job.Error = message.String
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+
+	return job, nil
+}
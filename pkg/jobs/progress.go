@@ -0,0 +1,115 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// saveInterval is how often Done and Fail write the counters to Jobs. A job
+// processing thousands of runners would otherwise write once per runner.
+const saveInterval = time.Second
+
+// Progress is handed to a job's work to report how far it has got. A nil
+// *Progress is valid and records nothing, so the same code can run outside
+// a job.
+type Progress struct {
+	writer *database.Writer
+	jobID  int64
+
+	mu        sync.Mutex
+	total     int
+	processed int
+	failures  []models.JobFailure
+	savedAt   time.Time
+}
+
+// SetTotal sets the number of runners the job expects to process.
+func (p *Progress) SetTotal(total int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.total = total
+	p.save()
+}
+
+// Done counts one runner as processed.
+func (p *Progress) Done() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.processed++
+	p.saveEvery(saveInterval)
+}
+
+// Fail counts one runner as processed and records why it failed.
+func (p *Progress) Fail(selectionID int, selectionName string, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.processed++
+	p.failures = append(p.failures, models.JobFailure{
+		SelectionID:   selectionID,
+		SelectionName: selectionName,
+		Error:         err.Error(),
+	})
+	p.saveEvery(saveInterval)
+}
+
+// flush writes counters not saved yet because of the throttling.
+func (p *Progress) flush() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.save()
+}
+
+// saveEvery saves the counters if they were last saved more than interval
+// ago or the last runner is done. The caller holds p.mu.
+func (p *Progress) saveEvery(interval time.Duration) {
+	if p.processed < p.total && time.Since(p.savedAt) < interval {
+		return
+	}
+	p.save()
+}
+
+// save writes the counters to Jobs. The caller holds p.mu.
+func (p *Progress) save() {
+	p.savedAt = time.Now()
+
+	failures, err := json.Marshal(p.failures)
+	if err != nil {
+		log.Printf("jobs: encoding failures of job %d: %v", p.jobID, err)
+		return
+	}
+	if p.failures == nil {
+		failures = []byte("[]")
+	}
+
+	err = p.writer.Do(context.Background(), func(ctx context.Context, db *sql.DB) error {
+		_, err := db.ExecContext(ctx, `UPDATE Jobs SET total = ?, processed = ?, failures = ? WHERE id = ?`,
+			p.total, p.processed, failures, p.jobID)
+		return err
+	})
+	if err != nil {
+		log.Printf("jobs: saving progress of job %d: %v", p.jobID, err)
+	}
+}
@@ -0,0 +1,59 @@
+package jobs
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+)
+
+func TestProgressSavesEverySecondAndOnTheLastRunner(t *testing.T) {
+	db, err := sql.Open("sqlite3", "file:TestProgressSaves?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if _, err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	res, err := db.Exec(`INSERT INTO Jobs (kind, status, created_at) VALUES ('test', ?, ?)`, StatusRunning, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processed := func() int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow(`SELECT processed FROM Jobs WHERE id = ?`, id).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	p := &Progress{writer: database.NewWriter(db), jobID: id}
+	p.SetTotal(3)
+	p.Done()
+	if got := processed(); got != 0 {
+		t.Fatalf("processed = %d right after SetTotal, want the save throttled", got)
+	}
+
+	p.mu.Lock()
+	p.savedAt = time.Now().Add(-2 * saveInterval)
+	p.mu.Unlock()
+	p.Fail(1, "Alpha", errors.New("no form"))
+	if got := processed(); got != 2 {
+		t.Fatalf("processed = %d after the interval, want 2", got)
+	}
+
+	p.Done()
+	if got := processed(); got != 3 {
+		t.Fatalf("processed = %d after the last runner, want 3", got)
+	}
+}
@@ -0,0 +1,226 @@
+// Package logit fits a conditional logit, the race-level softmax: each
+// runner's strength is a weighted sum of its features and its chance of
+// winning is exp(strength) over the sum across the race. Weights are found
+// by gradient descent on the log-likelihood of the actual winners.
+package logit
+
+import (
+	"errors"
+	"math"
+)
+
+// Race is one historical race: a feature row per runner and the index of
+// the winner.
+type Race struct {
+	X      [][]float64
+	Winner int
+}
+
+// Model is a fitted conditional logit. It encodes to JSON as is, so it can
+// be stored and loaded back.
+type Model struct {
+	Features []string  `json:"features"`
+	Mean     []float64 `json:"mean"`
+	Std      []float64 `json:"std"`
+	Weights  []float64 `json:"weights"`
+}
+
+// Options controls fitting. Zero values take the defaults.
+type Options struct {
+	Iterations   int     `json:"iterations"`
+	LearningRate float64 `json:"learning_rate"`
+	// L2 penalises large weights.
+	L2 float64 `json:"l2"`
+	// Holdout is the share of races, taken from the end, kept out of
+	// fitting to measure the model on.
+	Holdout float64 `json:"holdout"`
+}
+
+// Stats reports how fitting went. Losses are the mean negative log
+// probability given to the winner; UniformLoss is that of picking at
+// random, for comparison.
+type Stats struct {
+	Races           int     `json:"races"`
+	TrainRaces      int     `json:"train_races"`
+	HoldoutRaces    int     `json:"holdout_races"`
+	TrainLoss       float64 `json:"train_loss"`
+	HoldoutLoss     float64 `json:"holdout_loss"`
+	UniformLoss     float64 `json:"uniform_loss"`
+	HoldoutAccuracy float64 `json:"holdout_accuracy"`
+}
+
+// WithDefaults fills in the fields left at zero.
+func (o Options) WithDefaults() Options {
+	if o.Iterations <= 0 {
+		o.Iterations = 300
+	}
+	if o.LearningRate <= 0 {
+		o.LearningRate = 0.5
+	}
+	if o.L2 < 0 {
+		o.L2 = 0
+	}
+	if o.Holdout <= 0 || o.Holdout >= 1 {
+		o.Holdout = 0.2
+	}
+	return o
+}
+
+// Train fits a model to races. features names the columns of each row.
+// iteration, if not nil, is called after each gradient step.
+func Train(features []string, races []Race, opts Options, iteration func(n int)) (*Model, Stats, error) {
+	opts = opts.WithDefaults()
+
+	for _, race := range races {
+		if race.Winner < 0 || race.Winner >= len(race.X) {
+			return nil, Stats{}, errors.New("logit: race winner is not one of its runners")
+		}
+		for _, row := range race.X {
+			if len(row) != len(features) {
+				return nil, Stats{}, errors.New("logit: runner has the wrong number of features")
+			}
+		}
+	}
+
+	split := len(races) - int(float64(len(races))*opts.Holdout)
+	if split < 1 {
+		return nil, Stats{}, errors.New("logit: no races to fit")
+	}
+	train, holdout := races[:split], races[split:]
+
+	m := &Model{Features: append([]string(nil), features...)}
+	m.fitScaling(train)
+	m.Weights = make([]float64, len(features))
+
+	// Full-batch gradient ascent on the mean log-likelihood
+	gradient := make([]float64, len(features))
+	for it := 0; it < opts.Iterations; it++ {
+		for k := range gradient {
+			gradient[k] = -opts.L2 * m.Weights[k]
+		}
+		for _, race := range train {
+			scaled := m.scaleAll(race.X)
+			p := m.softmax(scaled)
+			for k := range gradient {
+				expected := 0.0
+				for i, row := range scaled {
+					expected += p[i] * row[k]
+				}
+				gradient[k] += (scaled[race.Winner][k] - expected) / float64(len(train))
+			}
+		}
+		for k := range m.Weights {
+			m.Weights[k] += opts.LearningRate * gradient[k]
+		}
+		if iteration != nil {
+			iteration(it + 1)
+		}
+	}
+
+	stats := Stats{Races: len(races), TrainRaces: len(train), HoldoutRaces: len(holdout)}
+	stats.TrainLoss, _ = m.evaluate(train)
+	if len(holdout) > 0 {
+		stats.HoldoutLoss, stats.HoldoutAccuracy = m.evaluate(holdout)
+		for _, race := range holdout {
+			stats.UniformLoss += math.Log(float64(len(race.X)))
+		}
+		stats.UniformLoss /= float64(len(holdout))
+	}
+
+	return m, stats, nil
+}
+
+// Probabilities returns each runner's chance of winning a race between
+// the given runners. They sum to 1.
+func (m *Model) Probabilities(x [][]float64) []float64 {
+	return m.softmax(m.scaleAll(x))
+}
+
+func (m *Model) fitScaling(races []Race) {
+	inputs := len(m.Features)
+	m.Mean = make([]float64, inputs)
+	m.Std = make([]float64, inputs)
+
+	n := 0
+	for _, race := range races {
+		for _, row := range race.X {
+			n++
+			for k, v := range row {
+				m.Mean[k] += v
+			}
+		}
+	}
+	for k := range m.Mean {
+		m.Mean[k] /= float64(n)
+	}
+	for _, race := range races {
+		for _, row := range race.X {
+			for k, v := range row {
+				m.Std[k] += (v - m.Mean[k]) * (v - m.Mean[k])
+			}
+		}
+	}
+	for k := range m.Std {
+		m.Std[k] = math.Sqrt(m.Std[k] / float64(n))
+		if m.Std[k] == 0 {
+			m.Std[k] = 1
+		}
+	}
+}
+
+func (m *Model) scaleAll(x [][]float64) [][]float64 {
+	scaled := make([][]float64, len(x))
+	for i, row := range x {
+		scaled[i] = make([]float64, len(row))
+		for k, v := range row {
+			scaled[i][k] = (v - m.Mean[k]) / m.Std[k]
+		}
+	}
+	return scaled
+}
+
+// softmax turns scaled rows into probabilities, shifting by the largest
+// strength so exp cannot overflow.
+func (m *Model) softmax(scaled [][]float64) []float64 {
+	strengths := make([]float64, len(scaled))
+	best := math.Inf(-1)
+	for i, row := range scaled {
+		for k, v := range row {
+			strengths[i] += m.Weights[k] * v
+		}
+		best = math.Max(best, strengths[i])
+	}
+
+	var total float64
+	p := make([]float64, len(scaled))
+	for i, strength := range strengths {
+		p[i] = math.Exp(strength - best)
+		total += p[i]
+	}
+	for i := range p {
+		p[i] /= total
+	}
+	return p
+}
+
+// evaluate returns the mean negative log probability of the winners and
+// how often the favourite won.
+func (m *Model) evaluate(races []Race) (loss, accuracy float64) {
+	const eps = 1e-12
+	correct := 0
+	for _, race := range races {
+		p := m.Probabilities(race.X)
+		loss -= math.Log(math.Max(p[race.Winner], eps))
+
+		favourite := 0
+		for i := range p {
+			if p[i] > p[favourite] {
+				favourite = i
+			}
+		}
+		if favourite == race.Winner {
+			correct++
+		}
+	}
+	return loss / float64(len(races)), float64(correct) / float64(len(races))
+}
@@ -0,0 +1,146 @@
+package logit
+
+import (
+	"math"
+	"testing"
+)
+
+func TestProbabilities(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []float64
+		x       [][]float64
+		want    []float64
+	}{
+		{
+			name:    "no weights is uniform",
+			weights: []float64{0},
+			x:       [][]float64{{1}, {2}, {3}, {4}},
+			want:    []float64{0.25, 0.25, 0.25, 0.25},
+		},
+		{
+			name:    "two runners are a logistic of the difference",
+			weights: []float64{1},
+			x:       [][]float64{{1}, {0}},
+			want:    []float64{1 / (1 + math.Exp(-1)), 1 / (1 + math.Exp(1))},
+		},
+		{
+			name:    "strengths add up over features",
+			weights: []float64{math.Log(2), math.Log(3)},
+			x:       [][]float64{{1, 0}, {0, 1}, {0, 0}},
+			want:    []float64{2.0 / 6, 3.0 / 6, 1.0 / 6},
+		},
+		{
+			name:    "large strengths do not overflow",
+			weights: []float64{1},
+			x:       [][]float64{{1000}, {999}},
+			want:    []float64{1 / (1 + math.Exp(-1)), 1 / (1 + math.Exp(1))},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Model{
+				Mean:    make([]float64, len(tt.weights)),
+				Std:     ones(len(tt.weights)),
+				Weights: tt.weights,
+			}
+			got := m.Probabilities(tt.x)
+			var total float64
+			for i := range got {
+				total += got[i]
+				if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+					t.Errorf("p[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+			if math.Abs(total-1) > 1e-9 {
+				t.Errorf("probabilities sum to %v", total)
+			}
+		})
+	}
+}
+
+func TestProbabilitiesScaleInputs(t *testing.T) {
+	m := &Model{Mean: []float64{10}, Std: []float64{2}, Weights: []float64{1}}
+	got := m.Probabilities([][]float64{{12}, {10}})
+	if want := 1 / (1 + math.Exp(-1)); math.Abs(got[0]-want) > 1e-9 {
+		t.Errorf("p = %v, want %v: inputs are standardised before weighting", got[0], want)
+	}
+}
+
+func TestTrainRejectsBadRaces(t *testing.T) {
+	tests := []struct {
+		name  string
+		races []Race
+	}{
+		{"no races", nil},
+		{"winner out of range", []Race{{X: [][]float64{{1}, {2}}, Winner: 2}}},
+		{"negative winner", []Race{{X: [][]float64{{1}, {2}}, Winner: -1}}},
+		{"wrong number of features", []Race{{X: [][]float64{{1}, {2, 3}}, Winner: 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Train([]string{"a"}, tt.races, Options{}, nil); err == nil {
+				t.Error("Train succeeded")
+			}
+		})
+	}
+}
+
+// The runner with the larger first feature always wins, and the second
+// feature is noise, so the fit should weight the first and beat picking
+// at random.
+func TestTrainLearnsWinner(t *testing.T) {
+	var races []Race
+	for i := 0; i < 100; i++ {
+		noise := float64(i%7) - 3
+		x := [][]float64{{float64(i % 5), noise}, {float64(i%5) + 1, -noise}, {float64(i%5) - 1, noise / 2}}
+		races = append(races, Race{X: x, Winner: 1})
+	}
+
+	iterations := 0
+	m, stats, err := Train([]string{"strength", "noise"}, races, Options{Iterations: 200}, func(n int) { iterations = n })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iterations != 200 {
+		t.Errorf("iteration called up to %d, want 200", iterations)
+	}
+	if stats.TrainRaces != 80 || stats.HoldoutRaces != 20 {
+		t.Errorf("split %d/%d, want 80/20", stats.TrainRaces, stats.HoldoutRaces)
+	}
+	if m.Weights[0] <= 0 {
+		t.Errorf("weight of the winning feature = %v, want positive", m.Weights[0])
+	}
+	if math.Abs(m.Weights[1]) >= m.Weights[0] {
+		t.Errorf("noise weight %v is not smaller than %v", m.Weights[1], m.Weights[0])
+	}
+	if stats.HoldoutLoss >= stats.UniformLoss {
+		t.Errorf("holdout loss %v is no better than uniform %v", stats.HoldoutLoss, stats.UniformLoss)
+	}
+	if stats.HoldoutAccuracy != 1 {
+		t.Errorf("holdout accuracy = %v, want 1", stats.HoldoutAccuracy)
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	tests := []struct {
+		in, want Options
+	}{
+		{Options{}, Options{Iterations: 300, LearningRate: 0.5, Holdout: 0.2}},
+		{Options{L2: -1, Holdout: 1}, Options{Iterations: 300, LearningRate: 0.5, Holdout: 0.2}},
+		{Options{Iterations: 10, LearningRate: 0.1, L2: 0.01, Holdout: 0.5}, Options{Iterations: 10, LearningRate: 0.1, L2: 0.01, Holdout: 0.5}},
+	}
+	for _, tt := range tests {
+		if got := tt.in.WithDefaults(); got != tt.want {
+			t.Errorf("%+v.WithDefaults() = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func ones(n int) []float64 {
+	x := make([]float64, n)
+	for i := range x {
+		x[i] = 1
+	}
+	return x
+}
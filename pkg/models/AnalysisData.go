@@ -46,8 +46,14 @@ type AnalysisData struct {
 	WinLose             WinLose           `json:"win_lose"`
 	TotalScore          float64           `json:"total_score"`
 	CurrentDistance     float64           `json:"current_distance"`
+	CurrentCourse       string            `json:"current_course"`
+	Features            RunnerFeatures    `json:"features"`
+	GoingForm           GoingForm         `json:"going_form"`
 	CreateAt            time.Time         `json:"created_at"`
 	UpdatedAt           time.Time         `json:"updated_at"`
+
+	// CourseDistance is the record at CurrentCourse and CurrentDistance
+	CourseDistance CourseDistanceForm `json:"course_distance"`
 }
 
 // RaceData holds individual race information
@@ -78,6 +84,12 @@ type RaceParameters struct {
 	Positions    string `json:"positions"`
 	Years        string `json:"years"`
 	Ages         string `json:"ages"`
+	// Model and ModelVersion pick the predictor; empty uses the default
+	Model        string `json:"model"`
+	ModelVersion string `json:"model_version"`
+	// Strategy names the stored strategy that chooses the picks; its
+	// exclusions replace Positions, Years and Ages
+	Strategy string `json:"strategy"`
 }
 
 type CurrentHorseData struct {
@@ -114,6 +126,13 @@ type OptimalParameters struct {
 	EventName                    string  `json:"event_name"`
 	EventDate                    string  `json:"event_date"`
 	EventTime                    string  `json:"event_time"`
+	// Set on the rows the optimiser writes: the best scoring weights for
+	// the race type and their objective on the search and held-out races
+	Weights     *ScoringWeights `json:"weights,omitempty"`
+	Objective   string          `json:"objective,omitempty"`
+	TrainScore  float64         `json:"train_score,omitempty"`
+	TestScore   float64         `json:"test_score,omitempty"`
+	OptimisedAt *time.Time      `json:"optimised_at,omitempty"`
 }
 
 type SelectionForm struct {
@@ -158,4 +177,11 @@ type SelectionResult struct {
 	TotalScore    float64 `json:"total_score"`
 	Age           string  `json:"age"`
 	RunCount      int     `json:"run_count"`
+	// WinProbability is the calibrated chance of winning the race and
+	// FairDecimalOdds the price it makes a fair bet at
+	WinProbability  float64 `json:"win_probability"`
+	FairDecimalOdds float64 `json:"fair_decimal_odds"`
+	Model           string  `json:"model,omitempty"`
+	ModelVersion    string  `json:"model_version,omitempty"`
+	Strategy        string  `json:"strategy,omitempty"`
 }
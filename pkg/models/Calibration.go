@@ -0,0 +1,18 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Calibration is a calibrator fitted to one version of a model, stored in
+// Calibrations. Params and Stats are the calibrator's own JSON encoding.
+type Calibration struct {
+	ID           int             `json:"id"`
+	Model        string          `json:"model"`
+	ModelVersion string          `json:"model_version"`
+	Method       string          `json:"method"`
+	Params       json.RawMessage `json:"params"`
+	Stats        json.RawMessage `json:"stats,omitempty"`
+	FittedAt     time.Time       `json:"fitted_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+// GoingRecord is a horse's form on one going band. AvgFinish averages
+// position over field size, and Relative is how much lower that is than
+// its average over every run, so a positive Relative means it runs better
+// on the band.
+type GoingRecord struct {
+	Runs      int     `json:"runs"`
+	Wins      int     `json:"wins"`
+	Places    int     `json:"places"`
+	AvgFinish float64 `json:"avg_finish"`
+	Relative  float64 `json:"relative"`
+}
+
+// GoingForm is a horse's form on the going of the race it runs in. Going
+// is the band of the race's going and Scale its place on the surface's
+// scale, firmest first; both are empty if the going is unknown. Preferred
+// is the band it has run best on.
+type GoingForm struct {
+	Going     string      `json:"going"`
+	Scale     int         `json:"scale"`
+	Record    GoingRecord `json:"record"`
+	Preferred string      `json:"preferred"`
+}
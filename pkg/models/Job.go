@@ -0,0 +1,28 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Job is a long-running task submitted through the API and tracked in Jobs.
+type Job struct {
+	ID         int64           `json:"id"`
+	Kind       string          `json:"kind"`
+	Status     string          `json:"status"`
+	Total      int             `json:"total"`
+	Processed  int             `json:"processed"`
+	Failures   []JobFailure    `json:"failures"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at"`
+}
+
+// JobFailure is a runner a job could not process.
+type JobFailure struct {
+	SelectionID   int    `json:"selection_id"`
+	SelectionName string `json:"selection_name"`
+	Error         string `json:"error"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// JobRun records one execution of a pipeline stage.
+type JobRun struct {
+	ID          int64      `json:"id"`
+	Stage       string     `json:"stage"`
+	TriggeredBy string     `json:"triggered_by"`
+	RunDate     string     `json:"run_date"`
+	Status      string     `json:"status"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	DurationMs  int64      `json:"duration_ms"`
+	Error       string     `json:"error"`
+}
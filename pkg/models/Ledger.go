@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Pick is a prediction stored in RaceStatistics with its row ID.
+type Pick struct {
+	ID int `json:"id"`
+	SelectionResult
+}
+
+// LedgerEntry is a settled pick in the Ledger. Return is what the bet paid
+// back, stake included, after commission; Balance is the strategy's
+// balance after it.
+type LedgerEntry struct {
+	ID            int       `json:"id"`
+	Strategy      string    `json:"strategy"`
+	Model         string    `json:"model"`
+	ModelVersion  string    `json:"model_version"`
+	EventDate     string    `json:"event_date"`
+	EventName     string    `json:"event_name"`
+	EventTime     string    `json:"event_time"`
+	SelectionID   int       `json:"selection_id"`
+	SelectionName string    `json:"selection_name"`
+	Position      string    `json:"position"`
+	Won           bool      `json:"won"`
+	PriceSource   string    `json:"price_source"`
+	Odds          float64   `json:"odds"`
+	Stake         float64   `json:"stake"`
+	Return        float64   `json:"return"`
+	Profit        float64   `json:"profit"`
+	Balance       float64   `json:"balance"`
+	SettledAt     time.Time `json:"settled_at"`
+}
+
+// ProfitSummary totals the ledger over one period of one strategy. Period
+// is the day (YYYY-MM-DD) or week (YYYY-Www) and empty when the summary
+// is by strategy only.
+type ProfitSummary struct {
+	Period   string  `json:"period,omitempty"`
+	Strategy string  `json:"strategy"`
+	Bets     int     `json:"bets"`
+	Winners  int     `json:"winners"`
+	Staked   float64 `json:"staked"`
+	Returned float64 `json:"returned"`
+	Profit   float64 `json:"profit"`
+	ROI      float64 `json:"roi"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ModelWeights is one trained version of a predictor, stored in
+// ModelWeights. Weights and Stats are the model's own JSON encoding.
+type ModelWeights struct {
+	ID        int             `json:"id"`
+	Model     string          `json:"model"`
+	Version   int             `json:"version"`
+	Weights   json.RawMessage `json:"-"`
+	Stats     json.RawMessage `json:"stats,omitempty"`
+	TrainedAt time.Time       `json:"trained_at"`
+}
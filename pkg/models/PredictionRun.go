@@ -0,0 +1,23 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PredictionRun is one run of TodayPredictions, stored in PredictionRuns,
+// with the model that scored it and the strategy that chose its picks.
+// InputHash identifies the runners and parameters it was run on, so two
+// runs with the same hash saw the same declarations.
+type PredictionRun struct {
+	ID           int             `json:"id"`
+	EventDate    string          `json:"event_date"`
+	Model        string          `json:"model"`
+	ModelVersion string          `json:"model_version"`
+	Strategy     string          `json:"strategy"`
+	Parameters   json.RawMessage `json:"parameters"`
+	InputHash    string          `json:"input_hash"`
+	CreatedAt    time.Time       `json:"created_at"`
+	PublishedAt  *time.Time      `json:"published_at,omitempty"`
+	Picks        int             `json:"picks"`
+}
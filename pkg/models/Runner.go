@@ -0,0 +1,23 @@
+package models
+
+// Runner is a horse declared for a race, as stored in EventRunners.
+type Runner struct {
+	ID              int    `json:"id"`
+	Name            string `json:"name"`
+	EventName       string `json:"event_name"`
+	EventDate       string `json:"event_date"`
+	EventTime       string `json:"event_time"`
+	Odds            string `json:"odds"`
+	RaceCategory    string `json:"race_category"`
+	RaceDistance    string `json:"race_distance"`
+	TrackCondition  string `json:"track_condition"`
+	NumberOfRunners string `json:"number_of_runners"`
+	RaceTrack       string `json:"race_track"`
+	RaceClass       string `json:"race_class"`
+}
+
+// Meeting lists the races run at one course on a given day.
+type Meeting struct {
+	EventName string `json:"event_name"`
+	EventTime string `json:"event_time"`
+}
@@ -0,0 +1,70 @@
+package models
+
+// RunnerFeatures is a horse's form going into the races it runs on or after
+// AsOfDate, until its next run: every run dated before AsOfDate counts.
+// Lists hold one entry per run, most recent first.
+type RunnerFeatures struct {
+	SelectionID   int    `json:"selection_id"`
+	AsOfDate      string `json:"as_of_date"`
+	SelectionName string `json:"selection_name"`
+	// Profile and class of the latest run
+	Age       string `json:"age"`
+	Trainer   string `json:"trainer"`
+	Sex       string `json:"sex"`
+	Sire      string `json:"sire"`
+	Dam       string `json:"dam"`
+	Owner     string `json:"owner"`
+	RaceClass string `json:"race_class"`
+
+	NumRuns      int    `json:"num_runs"`
+	WinCount     int    `json:"win_count"`
+	FirstRunDate string `json:"first_run_date"`
+	LastRunDate  string `json:"last_run_date"`
+	// DaysSinceLastRun is counted to the date the features are read at
+	DaysSinceLastRun int `json:"days_since_last_run"`
+	// Years between the first and last runs
+	Duration int `json:"duration"`
+	// Averages over the runs with a finishing position, rating, distance
+	// in furlongs and fractional starting price
+	AvgPosition float64 `json:"avg_position"`
+	AvgRating   float64 `json:"avg_rating"`
+	AvgDistance float64 `json:"avg_distance"`
+	AvgOdds     float64 `json:"avg_odds"`
+
+	Positions []string `json:"positions"`
+	// Finishes are positions divided by field size, from 1/field for a
+	// win to 1 for last; non-finishers count 1 and runs without a field
+	// size are left out
+	Finishes  []float64 `json:"finishes"`
+	Distances []float64 `json:"distances"`
+	Courses   []string  `json:"courses"`
+	RaceDates []string  `json:"race_dates"`
+	// Goings are the going bands run on, "" where the going is unknown
+	Goings []string `json:"goings"`
+
+	// GoingRecords holds the record on each going band run on
+	GoingRecords map[string]GoingRecord `json:"going_records"`
+	// RatingTrend is the change in rating per run over the latest rated runs
+	RatingTrend float64 `json:"rating_trend"`
+	// LastClass is the class number of the latest run, 0 if unknown.
+	// ClassChange is how many classes it went up from the run before, so
+	// Class 4 to Class 3 is 1; 0 if either class is unknown
+	LastClass   int `json:"last_class"`
+	ClassChange int `json:"class_change"`
+}
+
+// CourseDistanceForm is a horse's record at the course and distance of the
+// race it runs in. Runs within Tolerance furlongs of the race's distance
+// count as over the distance.
+type CourseDistanceForm struct {
+	CourseWinner         bool    `json:"course_winner"`
+	DistanceWinner       bool    `json:"distance_winner"`
+	CourseDistanceWinner bool    `json:"course_distance_winner"`
+	CourseRuns           int     `json:"course_runs"`
+	CourseWins           int     `json:"course_wins"`
+	CourseStrikeRate     float64 `json:"course_strike_rate"`
+	DistanceRuns         int     `json:"distance_runs"`
+	DistanceWins         int     `json:"distance_wins"`
+	DistanceStrikeRate   float64 `json:"distance_strike_rate"`
+	Tolerance            float64 `json:"tolerance"`
+}
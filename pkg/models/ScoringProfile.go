@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// ScoringProfile is one version of the heuristic scorer's weights, stored
+// in ScoringProfiles. BasedOn is the profile it was cloned or edited from.
+type ScoringProfile struct {
+	ID        int            `json:"id"`
+	Name      string         `json:"name"`
+	Version   int            `json:"version"`
+	Weights   ScoringWeights `json:"weights"`
+	Active    bool           `json:"active"`
+	BasedOn   *int           `json:"based_on,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// ScoringWeights are the points and thresholds ScoreSelection scores a
+// runner's form with. Distances are in furlongs.
+type ScoringWeights struct {
+	// FewRunsBonus is given to runners with fewer than FewRuns runs
+	FewRuns      int     `json:"few_runs"`
+	FewRunsBonus float64 `json:"few_runs_bonus"`
+	// DistanceScores[i] is given when the average distance run is within
+	// the i-th threshold of today's distance; races up to DistanceSplit use
+	// the short thresholds, longer ones the long thresholds
+	DistanceSplit           float64   `json:"distance_split"`
+	ShortDistanceThresholds []float64 `json:"short_distance_thresholds"`
+	LongDistanceThresholds  []float64 `json:"long_distance_thresholds"`
+	DistanceScores          []float64 `json:"distance_scores"`
+	// NonFinishPenalty is taken for each recent run whose position holds
+	// one of NonFinishCodes, UnreadablePositionPenalty for each one that
+	// cannot be read, and each finish scores PositionMultiplier times the
+	// field size over the position
+	NonFinishCodes            []string `json:"non_finish_codes"`
+	NonFinishPenalty          float64  `json:"non_finish_penalty"`
+	UnreadablePositionPenalty float64  `json:"unreadable_position_penalty"`
+	PositionMultiplier        float64  `json:"position_multiplier"`
+	// GoingScore is given per unit of a runner's relative finish on the
+	// day's going, once it has run GoingMinRuns times on it
+	GoingScore   float64 `json:"going_score"`
+	GoingMinRuns int     `json:"going_min_runs"`
+	// The winner scores are given to course, distance and course and
+	// distance winners, and the strike rate scores per unit of strike
+	// rate at the course and distance. Runs within DistanceTolerance of
+	// today's distance count as over it
+	CourseWinnerScore         float64 `json:"course_winner_score"`
+	DistanceWinnerScore       float64 `json:"distance_winner_score"`
+	CourseDistanceWinnerScore float64 `json:"course_distance_winner_score"`
+	CourseStrikeRateScore     float64 `json:"course_strike_rate_score"`
+	DistanceStrikeRateScore   float64 `json:"distance_strike_rate_score"`
+	DistanceTolerance         float64 `json:"distance_tolerance"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Strategy is a named set of rules for choosing bets from the runners a
+// model has scored, stored in Strategies.
+type Strategy struct {
+	ID          int           `json:"id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Rules       StrategyRules `json:"rules"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// StrategyRules are the rules of a strategy. A rule left at its zero value
+// does not restrict anything. Text rules match case-insensitively.
+type StrategyRules struct {
+	// MinOdds and MaxOdds bound the decimal price, exclusive of the ends
+	MinOdds float64 `json:"min_odds"`
+	MaxOdds float64 `json:"max_odds"`
+	// MinScore is the lowest model score kept; nil keeps any score
+	MinScore          *float64 `json:"min_score,omitempty"`
+	MinWinProbability float64  `json:"min_win_probability"`
+	// MaxRank keeps the runners ranked at most MaxRank by score in their
+	// race, before the other rules; PicksPerRace then keeps the best few
+	// of those left
+	MaxRank      int `json:"max_rank"`
+	PicksPerRace int `json:"picks_per_race"`
+
+	// Race rules, matched against the day's declarations. Going matches
+	// the declared going or its band, e.g. "Good to Soft"
+	RaceCategories []string `json:"race_categories,omitempty"`
+	Classes        []string `json:"classes,omitempty"`
+	Going          []string `json:"going,omitempty"`
+	MinRunners     int      `json:"min_runners"`
+	MaxRunners     int      `json:"max_runners"`
+
+	// Exclusions. ExcludeYears, ExcludePositions and ExcludeAges leave out
+	// horses whose form has a run in one of the years, a run in a field of
+	// one of the sizes after the slash in its position, or whose age is
+	// one of the ages; the model applies them while scoring
+	ExcludeCourses    []string `json:"exclude_courses,omitempty"`
+	ExcludeSelections []string `json:"exclude_selections,omitempty"`
+	ExcludeYears      []int    `json:"exclude_years,omitempty"`
+	ExcludePositions  []int    `json:"exclude_positions,omitempty"`
+	ExcludeAges       []int    `json:"exclude_ages,omitempty"`
+}
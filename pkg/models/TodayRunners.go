@@ -26,4 +26,6 @@ type RaceConditon struct {
 	NumberOfRunners string `json:"number_of_runners"`
 	RaceTrack       string `json:"race_track"`
 	RaceClass       string `json:"race_class"`
+	// Going is the going band of TrackCondition, "" if it is not known
+	Going string `json:"going"`
 }
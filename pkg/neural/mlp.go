@@ -0,0 +1,269 @@
+// Package neural is a small multilayer perceptron that runs inside the
+// server: one tanh hidden layer and a sigmoid output giving the probability
+// of a binary label. Without the hidden layer it is a logistic regression.
+// Inputs are standardised with the training set's mean and deviation, which
+// are saved with the weights.
+package neural
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+)
+
+// Network is a trained (or freshly initialised) perceptron. It encodes to
+// JSON as is, so it can be stored and loaded back.
+type Network struct {
+	Features []string    `json:"features"`
+	Mean     []float64   `json:"mean"`
+	Std      []float64   `json:"std"`
+	Hidden   [][]float64 `json:"hidden"` // [hidden][input]
+	HiddenB  []float64   `json:"hidden_bias"`
+	Output   []float64   `json:"output"` // [hidden], or [input] without a hidden layer
+	OutputB  float64     `json:"output_bias"`
+}
+
+// Options controls training. Zero values take the defaults.
+type Options struct {
+	HiddenUnits  int     `json:"hidden_units"`
+	Epochs       int     `json:"epochs"`
+	LearningRate float64 `json:"learning_rate"`
+	// L2 is the weight decay applied at each step.
+	L2 float64 `json:"l2"`
+	// Holdout is the share of samples, taken from the end, kept out of
+	// training to measure the network on.
+	Holdout float64 `json:"holdout"`
+	Seed    int64   `json:"seed"`
+}
+
+// Stats reports how training went. Losses are mean log loss.
+type Stats struct {
+	Samples         int     `json:"samples"`
+	TrainSamples    int     `json:"train_samples"`
+	HoldoutSamples  int     `json:"holdout_samples"`
+	Positives       int     `json:"positives"`
+	TrainLoss       float64 `json:"train_loss"`
+	HoldoutLoss     float64 `json:"holdout_loss"`
+	HoldoutAccuracy float64 `json:"holdout_accuracy"`
+}
+
+// WithDefaults fills in the fields left at zero.
+func (o Options) WithDefaults() Options {
+	if o.HiddenUnits <= 0 {
+		o.HiddenUnits = 8
+	}
+	if o.Epochs <= 0 {
+		o.Epochs = 30
+	}
+	if o.LearningRate <= 0 {
+		o.LearningRate = 0.01
+	}
+	if o.Holdout <= 0 || o.Holdout >= 1 {
+		o.Holdout = 0.2
+	}
+	if o.Seed == 0 {
+		o.Seed = 1
+	}
+	return o
+}
+
+// Train fits a new network to x and labels y. features names the columns
+// of x. epoch, if not nil, is called after each pass over the data.
+func Train(features []string, x [][]float64, y []bool, opts Options, epoch func(n int)) (*Network, Stats, error) {
+	opts = opts.WithDefaults()
+	return train(features, x, y, opts, opts.HiddenUnits, epoch)
+}
+
+// TrainLogistic fits a logistic regression, a network with no hidden
+// layer, in the same way as Train. opts.HiddenUnits is ignored.
+func TrainLogistic(features []string, x [][]float64, y []bool, opts Options, epoch func(n int)) (*Network, Stats, error) {
+	return train(features, x, y, opts.WithDefaults(), 0, epoch)
+}
+
+func train(features []string, x [][]float64, y []bool, opts Options, hiddenUnits int, epoch func(n int)) (*Network, Stats, error) {
+	if len(x) != len(y) {
+		return nil, Stats{}, errors.New("neural: inputs and labels differ in length")
+	}
+
+	split := len(x) - int(float64(len(x))*opts.Holdout)
+	if split < 1 {
+		return nil, Stats{}, errors.New("neural: no samples to train on")
+	}
+	for _, row := range x {
+		if len(row) != len(features) {
+			return nil, Stats{}, errors.New("neural: sample has the wrong number of features")
+		}
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	n := newNetwork(features, hiddenUnits, rng)
+	n.fitScaling(x[:split])
+
+	order := make([]int, split)
+	for i := range order {
+		order[i] = i
+	}
+	hidden := make([]float64, hiddenUnits)
+	for e := 0; e < opts.Epochs; e++ {
+		rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+		for _, i := range order {
+			n.step(n.scale(x[i]), y[i], hidden, opts.LearningRate, opts.L2)
+		}
+		if epoch != nil {
+			epoch(e + 1)
+		}
+	}
+
+	stats := Stats{Samples: len(x), TrainSamples: split, HoldoutSamples: len(x) - split}
+	for _, label := range y {
+		if label {
+			stats.Positives++
+		}
+	}
+	stats.TrainLoss, _ = n.evaluate(x[:split], y[:split])
+	if stats.HoldoutSamples > 0 {
+		stats.HoldoutLoss, stats.HoldoutAccuracy = n.evaluate(x[split:], y[split:])
+	}
+
+	return n, stats, nil
+}
+
+// Predict returns the probability of a positive label for one input row.
+func (n *Network) Predict(x []float64) float64 {
+	hidden := make([]float64, len(n.HiddenB))
+	return n.forward(n.scale(x), hidden)
+}
+
+func newNetwork(features []string, hiddenUnits int, rng *rand.Rand) *Network {
+	inputs := len(features)
+	n := &Network{
+		Features: append([]string(nil), features...),
+		Hidden:   make([][]float64, hiddenUnits),
+		HiddenB:  make([]float64, hiddenUnits),
+		Output:   make([]float64, hiddenUnits),
+	}
+	if hiddenUnits == 0 {
+		// A logistic regression starts from zero weights
+		n.Output = make([]float64, inputs)
+		return n
+	}
+
+	// Xavier initialisation keeps tanh out of saturation at the start
+	limit := math.Sqrt(6 / float64(inputs+hiddenUnits))
+	for h := range n.Hidden {
+		n.Hidden[h] = make([]float64, inputs)
+		for i := range n.Hidden[h] {
+			n.Hidden[h][i] = (rng.Float64()*2 - 1) * limit
+		}
+		n.Output[h] = (rng.Float64()*2 - 1) * math.Sqrt(6/float64(hiddenUnits+1))
+	}
+	return n
+}
+
+func (n *Network) fitScaling(x [][]float64) {
+	inputs := len(n.Features)
+	n.Mean = make([]float64, inputs)
+	n.Std = make([]float64, inputs)
+	for _, row := range x {
+		for i, v := range row {
+			n.Mean[i] += v
+		}
+	}
+	for i := range n.Mean {
+		n.Mean[i] /= float64(len(x))
+	}
+	for _, row := range x {
+		for i, v := range row {
+			n.Std[i] += (v - n.Mean[i]) * (v - n.Mean[i])
+		}
+	}
+	for i := range n.Std {
+		n.Std[i] = math.Sqrt(n.Std[i] / float64(len(x)))
+		if n.Std[i] == 0 {
+			n.Std[i] = 1
+		}
+	}
+}
+
+func (n *Network) scale(x []float64) []float64 {
+	scaled := make([]float64, len(x))
+	for i, v := range x {
+		scaled[i] = (v - n.Mean[i]) / n.Std[i]
+	}
+	return scaled
+}
+
+// forward fills hidden with the hidden activations and returns the output.
+func (n *Network) forward(x, hidden []float64) float64 {
+	z := n.OutputB
+	if len(n.Hidden) == 0 {
+		for i, w := range n.Output {
+			z += w * x[i]
+		}
+		return sigmoid(z)
+	}
+	for h, weights := range n.Hidden {
+		a := n.HiddenB[h]
+		for i, w := range weights {
+			a += w * x[i]
+		}
+		hidden[h] = math.Tanh(a)
+		z += n.Output[h] * hidden[h]
+	}
+	return sigmoid(z)
+}
+
+// step applies one stochastic gradient descent update for a single sample
+// under log loss.
+func (n *Network) step(x []float64, label bool, hidden []float64, rate, l2 float64) {
+	p := n.forward(x, hidden)
+	target := 0.0
+	if label {
+		target = 1
+	}
+	delta := p - target
+
+	if len(n.Hidden) == 0 {
+		for i := range n.Output {
+			n.Output[i] -= rate * (delta*x[i] + l2*n.Output[i])
+		}
+		n.OutputB -= rate * delta
+		return
+	}
+
+	for h := range n.Hidden {
+		// Back-propagate before the output weight is changed
+		hiddenDelta := delta * n.Output[h] * (1 - hidden[h]*hidden[h])
+		n.Output[h] -= rate * (delta*hidden[h] + l2*n.Output[h])
+		for i := range n.Hidden[h] {
+			n.Hidden[h][i] -= rate * (hiddenDelta*x[i] + l2*n.Hidden[h][i])
+		}
+		n.HiddenB[h] -= rate * hiddenDelta
+	}
+	n.OutputB -= rate * delta
+}
+
+// evaluate returns the mean log loss and the accuracy at a 0.5 threshold.
+func (n *Network) evaluate(x [][]float64, y []bool) (loss, accuracy float64) {
+	if len(x) == 0 {
+		return 0, 0
+	}
+	const eps = 1e-12
+	correct := 0
+	for i, row := range x {
+		p := n.Predict(row)
+		if y[i] {
+			loss -= math.Log(math.Max(p, eps))
+		} else {
+			loss -= math.Log(math.Max(1-p, eps))
+		}
+		if (p >= 0.5) == y[i] {
+			correct++
+		}
+	}
+	return loss / float64(len(x)), float64(correct) / float64(len(x))
+}
+
+func sigmoid(z float64) float64 {
+	return 1 / (1 + math.Exp(-z))
+}
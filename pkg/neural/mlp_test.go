@@ -0,0 +1,220 @@
+package neural
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestPredict(t *testing.T) {
+	tests := []struct {
+		name    string
+		network Network
+		x       []float64
+		want    float64
+	}{
+		{
+			name:    "logistic at zero is a half",
+			network: Network{Mean: []float64{0, 0}, Std: []float64{1, 1}, Output: []float64{0, 0}},
+			x:       []float64{3, -2},
+			want:    0.5,
+		},
+		{
+			name:    "logistic",
+			network: Network{Mean: []float64{0, 0}, Std: []float64{1, 1}, Output: []float64{1, -2}, OutputB: 0.5},
+			x:       []float64{1, 1},
+			want:    sigmoid(1 - 2 + 0.5),
+		},
+		{
+			name:    "inputs are standardised",
+			network: Network{Mean: []float64{10}, Std: []float64{4}, Output: []float64{2}},
+			x:       []float64{12},
+			want:    sigmoid(1),
+		},
+		{
+			name: "one hidden unit",
+			network: Network{
+				Mean: []float64{0}, Std: []float64{1},
+				Hidden: [][]float64{{2}}, HiddenB: []float64{-1},
+				Output: []float64{3}, OutputB: -1,
+			},
+			x:    []float64{1},
+			want: sigmoid(3*math.Tanh(1) - 1),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.network.Predict(tt.x); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("Predict(%v) = %v, want %v", tt.x, got, tt.want)
+			}
+		})
+	}
+}
+
+// step must move every weight against the gradient of the log loss; the
+// gradient is checked against finite differences.
+func TestStepFollowsLogLossGradient(t *testing.T) {
+	for _, hiddenUnits := range []int{0, 3} {
+		for _, label := range []bool{true, false} {
+			n := newNetwork([]string{"a", "b"}, hiddenUnits, rand.New(rand.NewSource(7)))
+			n.Mean, n.Std = []float64{0, 0}, []float64{1, 1}
+			n.OutputB = 0.3
+			x := []float64{0.7, -1.2}
+
+			const rate = 1e-3
+			stepped := clone(t, n)
+			stepped.step(x, label, make([]float64, hiddenUnits), rate, 0)
+
+			before, after := parameters(n), parameters(stepped)
+			for i := range before {
+				const eps = 1e-6
+				saved := *before[i]
+				*before[i] = saved + eps
+				up := logLoss(n, x, label)
+				*before[i] = saved - eps
+				down := logLoss(n, x, label)
+				*before[i] = saved
+
+				gradient := (up - down) / (2 * eps)
+				if got := (saved - *after[i]) / rate; math.Abs(got-gradient) > 1e-5 {
+					t.Errorf("%d hidden units, label %v: parameter %d stepped by %v times the rate, gradient is %v", hiddenUnits, label, i, got, gradient)
+				}
+			}
+		}
+	}
+}
+
+func TestTrainRejectsBadInput(t *testing.T) {
+	tests := []struct {
+		name string
+		x    [][]float64
+		y    []bool
+	}{
+		{"no samples", nil, nil},
+		{"labels differ in length", [][]float64{{1}, {2}}, []bool{true}},
+		{"wrong number of features", [][]float64{{1}, {2, 3}}, []bool{true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Train([]string{"a"}, tt.x, tt.y, Options{}, nil); err == nil {
+				t.Error("Train succeeded")
+			}
+		})
+	}
+}
+
+func TestTrainLearnsSeparableLabel(t *testing.T) {
+	var x [][]float64
+	var y []bool
+	for i := 0; i < 200; i++ {
+		v := float64(i%20) - 9.5
+		x = append(x, []float64{v, float64(i % 3)})
+		y = append(y, v > 0)
+	}
+
+	for name, train := range map[string]func([]string, [][]float64, []bool, Options, func(int)) (*Network, Stats, error){
+		"network":  Train,
+		"logistic": TrainLogistic,
+	} {
+		t.Run(name, func(t *testing.T) {
+			epochs := 0
+			n, stats, err := train([]string{"signal", "noise"}, x, y, Options{Epochs: 50, LearningRate: 0.05}, func(e int) { epochs = e })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if epochs != 50 {
+				t.Errorf("epoch called up to %d, want 50", epochs)
+			}
+			if stats.TrainSamples != 160 || stats.HoldoutSamples != 40 || stats.Positives != 100 {
+				t.Errorf("stats = %+v, want 160 train, 40 holdout, 100 positives", stats)
+			}
+			if stats.HoldoutAccuracy < 0.95 {
+				t.Errorf("holdout accuracy = %v, want at least 0.95", stats.HoldoutAccuracy)
+			}
+			if stats.HoldoutLoss >= math.Log(2) {
+				t.Errorf("holdout loss %v is no better than a coin", stats.HoldoutLoss)
+			}
+			if n.Predict([]float64{9, 1}) < 0.9 || n.Predict([]float64{-9, 1}) > 0.1 {
+				t.Errorf("Predict = %v and %v at the extremes", n.Predict([]float64{9, 1}), n.Predict([]float64{-9, 1}))
+			}
+
+			// Stored weights predict the same once loaded back
+			encoded, err := json.Marshal(n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded Network
+			if err := json.Unmarshal(encoded, &loaded); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := loaded.Predict([]float64{1.5, 2}), n.Predict([]float64{1.5, 2}); got != want {
+				t.Errorf("loaded network predicts %v, want %v", got, want)
+			}
+
+			// The seed makes training repeatable
+			again, _, err := train([]string{"signal", "noise"}, x, y, Options{Epochs: 50, LearningRate: 0.05}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(again, n) {
+				t.Error("training twice with the same seed gave different weights")
+			}
+		})
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	tests := []struct {
+		in, want Options
+	}{
+		{Options{}, Options{HiddenUnits: 8, Epochs: 30, LearningRate: 0.01, Holdout: 0.2, Seed: 1}},
+		{Options{Holdout: 1}, Options{HiddenUnits: 8, Epochs: 30, LearningRate: 0.01, Holdout: 0.2, Seed: 1}},
+		{Options{HiddenUnits: 2, Epochs: 5, LearningRate: 0.1, L2: 0.01, Holdout: 0.3, Seed: 9}, Options{HiddenUnits: 2, Epochs: 5, LearningRate: 0.1, L2: 0.01, Holdout: 0.3, Seed: 9}},
+	}
+	for _, tt := range tests {
+		if got := tt.in.WithDefaults(); got != tt.want {
+			t.Errorf("%+v.WithDefaults() = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func logLoss(n *Network, x []float64, label bool) float64 {
+	p := n.Predict(x)
+	if label {
+		return -math.Log(p)
+	}
+	return -math.Log(1 - p)
+}
+
+// parameters returns pointers to every trainable weight of n, in a fixed
+// order.
+func parameters(n *Network) []*float64 {
+	var params []*float64
+	for h := range n.Hidden {
+		for i := range n.Hidden[h] {
+			params = append(params, &n.Hidden[h][i])
+		}
+	}
+	for h := range n.HiddenB {
+		params = append(params, &n.HiddenB[h])
+	}
+	for i := range n.Output {
+		params = append(params, &n.Output[i])
+	}
+	return append(params, &n.OutputB)
+}
+
+func clone(t *testing.T, n *Network) *Network {
+	t.Helper()
+	encoded, err := json.Marshal(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c Network
+	if err := json.Unmarshal(encoded, &c); err != nil {
+		t.Fatal(err)
+	}
+	return &c
+}
@@ -0,0 +1,375 @@
+// Package optimise searches the heuristic scorer's weights against past
+// races, one race type at a time, and derives the optimal parameters of
+// each race type from the winners the best weights pick.
+package optimise
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/calibration"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// Search methods.
+const (
+	Grid              = "grid"
+	Random            = "random"
+	CoordinateDescent = "coordinate_descent"
+)
+
+// Objectives. Each is maximised; log loss is reported negated so that a
+// higher score is better for all three.
+const (
+	StrikeRate = "strike_rate"
+	ROI        = "roi"
+	LogLoss    = "log_loss"
+)
+
+// Scorer scores a runner's last limit runs with weights.
+type Scorer func(data models.AnalysisData, weights models.ScoringWeights, limit int) float64
+
+// Options sets the search. Holdout is the share of each race type's latest
+// dates kept out of the search to check the best weights on. Race types
+// with fewer than MinRaces races are skipped.
+type Options struct {
+	Method         string  `json:"method"`
+	Objective      string  `json:"objective"`
+	Holdout        float64 `json:"holdout"`
+	MaxEvaluations int     `json:"max_evaluations"`
+	MinRaces       int     `json:"min_races"`
+	Seed           int64   `json:"seed"`
+}
+
+// WithDefaults fills in the unset options: coordinate descent on strike
+// rate, a fifth of the dates held out, at most 200 evaluations per race
+// type and at least 20 races.
+func (o Options) WithDefaults() Options {
+	if o.Method == "" {
+		o.Method = CoordinateDescent
+	}
+	if o.Objective == "" {
+		o.Objective = StrikeRate
+	}
+	if o.Holdout == 0 {
+		o.Holdout = 0.2
+	}
+	if o.MaxEvaluations == 0 {
+		o.MaxEvaluations = 200
+	}
+	if o.MinRaces == 0 {
+		o.MinRaces = 20
+	}
+	if o.Seed == 0 {
+		o.Seed = 1
+	}
+	return o
+}
+
+// Validate reports options the search cannot run with.
+func (o Options) Validate() error {
+	switch o.Method {
+	case Grid, Random, CoordinateDescent:
+	default:
+		return fmt.Errorf("optimise: unknown method %q", o.Method)
+	}
+	switch o.Objective {
+	case StrikeRate, ROI, LogLoss:
+	default:
+		return fmt.Errorf("optimise: unknown objective %q", o.Objective)
+	}
+	if o.Holdout < 0 || o.Holdout >= 1 {
+		return fmt.Errorf("optimise: holdout must be in [0, 1)")
+	}
+	if o.MaxEvaluations < 1 || o.MinRaces < 1 {
+		return fmt.Errorf("optimise: max_evaluations and min_races must be positive")
+	}
+	return nil
+}
+
+// Score is an objective on the search races and on the held-out races.
+// Test is 0 when nothing is held out.
+type Score struct {
+	Train float64 `json:"train"`
+	Test  float64 `json:"test"`
+}
+
+// Candidate is a set of weights the search tried.
+type Candidate struct {
+	Weights models.ScoringWeights `json:"weights"`
+	Train   float64               `json:"train"`
+}
+
+// Result is the search of one race type.
+type Result struct {
+	RaceType    string                   `json:"race_type"`
+	TrainRaces  int                      `json:"train_races"`
+	TestRaces   int                      `json:"test_races"`
+	Evaluations int                      `json:"evaluations"`
+	Baseline    Score                    `json:"baseline"`
+	Best        Score                    `json:"best"`
+	Weights     models.ScoringWeights    `json:"weights"`
+	Top         []Candidate              `json:"top"`
+	Parameters  models.OptimalParameters `json:"parameters"`
+}
+
+// Report is a whole search.
+type Report struct {
+	Method    string   `json:"method"`
+	Objective string   `json:"objective"`
+	Races     int      `json:"races"`
+	Results   []Result `json:"results"`
+	// Skipped lists the race types with too few races
+	Skipped []string `json:"skipped"`
+}
+
+// topCandidates is how many of the best candidates a Result lists.
+const topCandidates = 10
+
+// Optimise searches weights for each race type of races, starting from
+// base, and returns what it found.
+func Optimise(races []Race, base models.ScoringWeights, score Scorer, opts Options) (Report, error) {
+	opts = opts.WithDefaults()
+	if err := opts.Validate(); err != nil {
+		return Report{}, err
+	}
+
+	report := Report{Method: opts.Method, Objective: opts.Objective, Races: len(races), Results: []Result{}, Skipped: []string{}}
+	for _, raceType := range RaceTypes(races) {
+		var ofType []Race
+		for _, race := range races {
+			if race.RaceType == raceType {
+				ofType = append(ofType, race)
+			}
+		}
+		if len(ofType) < opts.MinRaces {
+			report.Skipped = append(report.Skipped, raceType)
+			continue
+		}
+
+		report.Results = append(report.Results, optimiseRaceType(raceType, ofType, base, score, opts))
+	}
+	return report, nil
+}
+
+// RaceTypes returns the race types of races in alphabetical order.
+func RaceTypes(races []Race) []string {
+	seen := map[string]bool{}
+	var types []string
+	for _, race := range races {
+		if !seen[race.RaceType] {
+			seen[race.RaceType] = true
+			types = append(types, race.RaceType)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+func optimiseRaceType(raceType string, races []Race, base models.ScoringWeights, score Scorer, opts Options) Result {
+	train, test := split(races, opts.Holdout)
+	e := &evaluator{races: train, score: score, objective: opts.Objective}
+
+	var candidates []Candidate
+	try := func(w models.ScoringWeights) float64 {
+		v, _ := e.value(w)
+		candidates = append(candidates, Candidate{Weights: w, Train: v})
+		return v
+	}
+	try(base)
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	switch opts.Method {
+	case Grid:
+		grid(base, opts.MaxEvaluations-1, func(w models.ScoringWeights) { try(w) })
+	case Random:
+		random(base, opts.MaxEvaluations-1, rng.Intn, func(w models.ScoringWeights) { try(w) })
+	case CoordinateDescent:
+		coordinateDescent(base, candidates[0].Train, opts.MaxEvaluations-1, try)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Train > candidates[j].Train
+	})
+	best := candidates[0].Weights
+
+	result := Result{
+		RaceType:    raceType,
+		TrainRaces:  len(train),
+		TestRaces:   len(test),
+		Evaluations: len(candidates),
+		Baseline:    scoreOn(train, test, base, score, opts.Objective),
+		Best:        scoreOn(train, test, best, score, opts.Objective),
+		Weights:     best,
+		Parameters:  parameters(raceType, train, best, score),
+	}
+	if len(candidates) > topCandidates {
+		candidates = candidates[:topCandidates]
+	}
+	result.Top = candidates
+	return result
+}
+
+// split holds out the races of the latest share of dates. Races come in
+// date order.
+func split(races []Race, holdout float64) (train, test []Race) {
+	var dates []string
+	for _, race := range races {
+		if len(dates) == 0 || dates[len(dates)-1] != race.Date {
+			dates = append(dates, race.Date)
+		}
+	}
+	held := int(math.Round(float64(len(dates)) * holdout))
+	if held == 0 || held == len(dates) {
+		return races, nil
+	}
+	first := dates[len(dates)-held]
+	for i, race := range races {
+		if race.Date >= first {
+			return races[:i], races[i:]
+		}
+	}
+	return races, nil
+}
+
+// scoreOn is the objective of w on the search races and on the held-out
+// ones. For log loss the held-out races are calibrated on the search ones.
+func scoreOn(train, test []Race, w models.ScoringWeights, score Scorer, objective string) Score {
+	var s Score
+	var calibrator *calibration.Calibrator
+	s.Train, calibrator = (&evaluator{races: train, score: score, objective: objective}).value(w)
+	if len(test) > 0 {
+		s.Test, _ = (&evaluator{races: test, score: score, objective: objective, calibrator: calibrator}).value(w)
+	}
+	return s
+}
+
+// evaluator measures weights on a set of races.
+type evaluator struct {
+	races     []Race
+	score     Scorer
+	objective string
+	// calibrator turns scores into probabilities for log loss; if nil,
+	// one is fitted to the races for each set of weights
+	calibrator *calibration.Calibrator
+}
+
+// value is the objective of w, and for log loss the calibrator used.
+func (e *evaluator) value(w models.ScoringWeights) (float64, *calibration.Calibrator) {
+	var winners, priced int
+	var profit float64
+	scored := make([]calibration.Race, 0, len(e.races))
+	for _, race := range e.races {
+		scores := make([]float64, len(race.Runners))
+		top, winner := 0, 0
+		for i, runner := range race.Runners {
+			scores[i] = finite(e.score(runner.Data, w, runner.Limit))
+			if scores[i] > scores[top] {
+				top = i
+			}
+			if runner.Won {
+				winner = i
+			}
+		}
+		scored = append(scored, calibration.Race{Scores: scores, Winner: winner})
+
+		pick := race.Runners[top]
+		if pick.Won {
+			winners++
+		}
+		if pick.SP > 0 {
+			priced++
+			profit--
+			if pick.Won {
+				profit += pick.SP
+			}
+		}
+	}
+	if len(e.races) == 0 {
+		return 0, nil
+	}
+
+	switch e.objective {
+	case ROI:
+		if priced == 0 {
+			return 0, nil
+		}
+		return profit / float64(priced), nil
+	case LogLoss:
+		calibrator := e.calibrator
+		if calibrator == nil {
+			var err error
+			if calibrator, err = calibration.Fit(calibration.Temperature, scored); err != nil {
+				calibrator = calibration.Default
+			}
+		}
+		return -calibrator.LogLoss(scored), calibrator
+	default:
+		return float64(winners) / float64(len(e.races)), nil
+	}
+}
+
+// parameters derives a race type's optimal parameters from the form of the
+// winners w picks in races: the median of each measure.
+func parameters(raceType string, races []Race, w models.ScoringWeights, score Scorer) models.OptimalParameters {
+	var runs, years, wins, rating, position, distance []float64
+	for _, race := range races {
+		top := 0
+		best := math.Inf(-1)
+		for i, runner := range race.Runners {
+			if s := finite(score(runner.Data, w, runner.Limit)); s > best {
+				top, best = i, s
+			}
+		}
+		pick := race.Runners[top]
+		if !pick.Won {
+			continue
+		}
+		runs = append(runs, float64(pick.Data.NumRuns))
+		years = append(years, float64(pick.Data.Duration))
+		wins = append(wins, float64(pick.Data.WinCount))
+		rating = append(rating, pick.Data.AvgRating)
+		position = append(position, pick.Data.AvgPosition)
+		distance = append(distance, pick.Data.CurrentDistance)
+	}
+
+	return models.OptimalParameters{
+		RaceType:                     raceType,
+		OptimalNumRuns:               int(math.Round(median(runs))),
+		OptimalNumYearsInCompetition: int(math.Round(median(years))),
+		OptimalNumWins:               int(math.Round(median(wins))),
+		OptimalRating:                median(rating),
+		OptimalPosition:              median(position),
+		OptimalDistance:              median(distance),
+	}
+}
+
+// finite caps a score the scorer made infinite, from a position of 0,
+// so it still ranks first but can be calibrated. NaN counts as 0.
+func finite(score float64) float64 {
+	switch {
+	case math.IsNaN(score):
+		return 0
+	case math.IsInf(score, 0):
+		return math.Copysign(maxScore, score)
+	}
+	return score
+}
+
+// maxScore is far beyond any finite score but small enough to standardise.
+const maxScore = 1e6
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
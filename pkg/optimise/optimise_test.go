@@ -0,0 +1,208 @@
+package optimise
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/calibration"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/scoring"
+)
+
+func TestOptionsWithDefaultsAndValidate(t *testing.T) {
+	if got, want := (Options{}).WithDefaults(), (Options{Method: CoordinateDescent, Objective: StrikeRate, Holdout: 0.2, MaxEvaluations: 200, MinRaces: 20, Seed: 1}); got != want {
+		t.Errorf("WithDefaults = %+v, want %+v", got, want)
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		ok   bool
+	}{
+		{"defaults", Options{}.WithDefaults(), true},
+		{"no holdout", Options{Method: Grid, Objective: ROI, MaxEvaluations: 1, MinRaces: 1}, true},
+		{"unknown method", Options{Method: "annealing", Objective: ROI, MaxEvaluations: 1, MinRaces: 1}, false},
+		{"unknown objective", Options{Method: Grid, Objective: "profit", MaxEvaluations: 1, MinRaces: 1}, false},
+		{"holdout of everything", Options{Method: Grid, Objective: ROI, Holdout: 1, MaxEvaluations: 1, MinRaces: 1}, false},
+		{"negative holdout", Options{Method: Grid, Objective: ROI, Holdout: -0.1, MaxEvaluations: 1, MinRaces: 1}, false},
+		{"no evaluations", Options{Method: Grid, Objective: ROI, MinRaces: 1}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.opts.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: Validate = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	races := []Race{{Date: "2024-01-01"}, {Date: "2024-01-01"}, {Date: "2024-01-02"}, {Date: "2024-01-03"}, {Date: "2024-01-03"}}
+	tests := []struct {
+		holdout     float64
+		train, test int
+	}{
+		{0, 5, 0},
+		{0.2, 3, 2},
+		{0.5, 2, 3},
+		{0.6, 2, 3},
+		// Holding out every date holds out none
+		{0.99, 5, 0},
+	}
+	for _, tt := range tests {
+		train, test := split(races, tt.holdout)
+		if len(train) != tt.train || len(test) != tt.test {
+			t.Errorf("split(%v) = %d/%d races, want %d/%d", tt.holdout, len(train), len(test), tt.train, tt.test)
+		}
+	}
+}
+
+func TestMedianAndFinite(t *testing.T) {
+	medians := []struct {
+		values []float64
+		want   float64
+	}{
+		{nil, 0},
+		{[]float64{3}, 3},
+		{[]float64{5, 1, 3}, 3},
+		{[]float64{4, 1, 3, 2}, 2.5},
+	}
+	for _, tt := range medians {
+		if got := median(tt.values); got != tt.want {
+			t.Errorf("median(%v) = %v, want %v", tt.values, got, tt.want)
+		}
+	}
+
+	finites := []struct {
+		score, want float64
+	}{
+		{12.5, 12.5},
+		{math.Inf(1), maxScore},
+		{math.Inf(-1), -maxScore},
+		{math.NaN(), 0},
+	}
+	for _, tt := range finites {
+		if got := finite(tt.score); got != tt.want {
+			t.Errorf("finite(%v) = %v, want %v", tt.score, got, tt.want)
+		}
+	}
+}
+
+// ratingScorer scores a runner by its rating, so the highest rated runner
+// is picked.
+func ratingScorer(data models.AnalysisData, _ models.ScoringWeights, _ int) float64 {
+	return data.AvgRating
+}
+
+func runner(rating float64, won bool, sp float64) Runner {
+	return Runner{Data: models.AnalysisData{AvgRating: rating}, Won: won, SP: sp}
+}
+
+func TestEvaluatorObjectives(t *testing.T) {
+	races := []Race{
+		{Runners: []Runner{runner(2, true, 3), runner(1, false, 2)}},
+		{Runners: []Runner{runner(2, false, 4), runner(1, true, 2)}},
+		{Runners: []Runner{runner(2, true, 0), runner(1, false, 2)}},
+		{Runners: []Runner{runner(2, false, 5), runner(1, true, 2)}},
+	}
+	calibrator := &calibration.Calibrator{Method: calibration.Temperature, Temperature: 1}
+	// Scores standardise to 1 and -1: the top pick wins at 1/(1+e^-2)
+	p := 1 / (1 + math.Exp(-2))
+
+	tests := []struct {
+		objective  string
+		calibrator *calibration.Calibrator
+		want       float64
+	}{
+		// Two of four top picks won
+		{StrikeRate, nil, 0.5},
+		// Three picks priced: +2, -1 and -1 on three units staked
+		{ROI, nil, 0},
+		{LogLoss, calibrator, (math.Log(p) + math.Log(1-p)) / 2},
+		// At a 50% strike rate the best calibration is no edge at all
+		{LogLoss, nil, -math.Log(2)},
+	}
+	for _, tt := range tests {
+		e := &evaluator{races: races, score: ratingScorer, objective: tt.objective, calibrator: tt.calibrator}
+		if got, _ := e.value(scoring.Default()); math.Abs(got-tt.want) > 1e-4 {
+			t.Errorf("%s = %v, want %v", tt.objective, got, tt.want)
+		}
+	}
+
+	empty := &evaluator{score: ratingScorer, objective: StrikeRate}
+	if got, _ := empty.value(scoring.Default()); got != 0 {
+		t.Errorf("value with no races = %v, want 0", got)
+	}
+}
+
+// penaltyScorer rewards rating and, through NonFinishPenalty, a high
+// average position. The winners have the better rating and the worse
+// position, so the default penalty of 5 picks the losers and the search
+// has to bring it down to 0.
+func penaltyScorer(data models.AnalysisData, w models.ScoringWeights, _ int) float64 {
+	return w.GoingScore*data.AvgRating + w.NonFinishPenalty*data.AvgPosition
+}
+
+func TestOptimise(t *testing.T) {
+	var races []Race
+	dates := []string{"2024-01-01", "2024-01-02", "2024-01-03", "2024-01-04", "2024-01-05"}
+	for i := 0; i < 30; i++ {
+		races = append(races, Race{
+			Date:     dates[i*len(dates)/30],
+			RaceType: "Flat",
+			Runners: []Runner{
+				{Data: models.AnalysisData{AvgRating: 1, AvgPosition: 1, NumRuns: 4 + i%3, WinCount: 2}, Won: true, SP: 3},
+				{Data: models.AnalysisData{AvgRating: 0, AvgPosition: 10, NumRuns: 8}, SP: 2},
+			},
+		})
+	}
+	races = append(races, Race{Date: "2024-01-05", RaceType: "Hurdle", Runners: []Runner{runner(1, true, 2), runner(0, false, 2)}})
+
+	for _, method := range []string{CoordinateDescent, Random} {
+		t.Run(method, func(t *testing.T) {
+			report, err := Optimise(races, scoring.Default(), penaltyScorer, Options{Method: method, MaxEvaluations: 50})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(report.Skipped, []string{"Hurdle"}) || len(report.Results) != 1 {
+				t.Fatalf("results %d, skipped %v; want Flat searched and Hurdle skipped", len(report.Results), report.Skipped)
+			}
+
+			result := report.Results[0]
+			if result.TrainRaces != 24 || result.TestRaces != 6 {
+				t.Errorf("split %d/%d, want 24/6", result.TrainRaces, result.TestRaces)
+			}
+			if result.Baseline.Train != 0 || result.Best.Train != 1 || result.Best.Test != 1 {
+				t.Errorf("baseline %+v, best %+v; want 0 and 1", result.Baseline, result.Best)
+			}
+			if penaltyScorer(races[0].Runners[0].Data, result.Weights, 0) <= penaltyScorer(races[0].Runners[1].Data, result.Weights, 0) {
+				t.Errorf("best weights %+v still pick the loser", result.Weights)
+			}
+			if result.Evaluations > 50 || len(result.Top) > topCandidates {
+				t.Errorf("%d evaluations and %d top candidates", result.Evaluations, len(result.Top))
+			}
+			if result.Parameters.RaceType != "Flat" || result.Parameters.OptimalNumRuns != 5 || result.Parameters.OptimalNumWins != 2 {
+				t.Errorf("parameters = %+v, want the median winner's 5 runs and 2 wins", result.Parameters)
+			}
+		})
+	}
+
+	if _, err := Optimise(races, scoring.Default(), penaltyScorer, Options{Method: "annealing"}); err == nil {
+		t.Error("Optimise accepted an unknown method")
+	}
+}
+
+func TestGridStopsAtMax(t *testing.T) {
+	var tried []models.ScoringWeights
+	grid(scoring.Default(), 7, func(w models.ScoringWeights) { tried = append(tried, w) })
+	if len(tried) != 7 {
+		t.Fatalf("grid tried %d weights, want 7", len(tried))
+	}
+
+	// The last dimension turns first, like an odometer
+	values := dimensionsFor(scoring.Default())[len(dimensionsFor(scoring.Default()))-1].values
+	for i, w := range tried[:len(values)] {
+		if w.CourseDistanceWinnerScore != values[i] {
+			t.Errorf("try %d has course_distance_winner_score %v, want %v", i, w.CourseDistanceWinnerScore, values[i])
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package optimise
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/features"
+	"github.com/mmanjoura/race-picks-backend/pkg/going"
+	"github.com/mmanjoura/race-picks-backend/pkg/jobs"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/racing"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+	"github.com/mmanjoura/race-picks-backend/pkg/value"
+)
+
+// Runner is a runner's form before a race, as the scorer sees it, and how
+// it finished.
+type Runner struct {
+	Data models.AnalysisData
+	// Limit is how many recent runs the scorer reads
+	Limit int
+	Won   bool
+	// SP is the decimal starting price; 0 if unknown
+	SP float64
+}
+
+// Race is a past race with the form of its runners.
+type Race struct {
+	Date      string
+	EventName string
+	EventTime string
+	RaceType  string
+	Runners   []Runner
+}
+
+// Load rebuilds the races declared from from to to inclusive with each
+// runner's form from before the day. As in the live predictions, the
+// scorer reads as many recent runs as the least raced runner of the day
+// has. Only races in which every runner with form has a result and exactly
+// one of them won are returned. Progress counts days.
+func Load(ctx context.Context, repos repository.Repositories, from, to time.Time, progress *jobs.Progress) ([]Race, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("optimise: to is before from")
+	}
+	progress.SetTotal(int(to.Sub(from).Hours()/24) + 1)
+
+	var races []Race
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		loaded, err := loadDay(ctx, repos, day)
+		if err != nil {
+			return nil, fmt.Errorf("optimise %s: %w", day.Format(racing.EventDateLayout), err)
+		}
+		races = append(races, loaded...)
+		progress.Done()
+	}
+	return races, nil
+}
+
+func loadDay(ctx context.Context, repos repository.Repositories, day time.Time) ([]Race, error) {
+	date := day.Format(racing.EventDateLayout)
+
+	runners, err := repos.Runners.ByDate(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{}
+	var races []Race
+	complete := map[int]bool{}
+	limit := math.MaxInt
+	for _, runner := range runners {
+		key := runner.EventName + "|" + runner.EventTime
+		i, ok := index[key]
+		if !ok {
+			i = len(races)
+			index[key] = i
+			races = append(races, Race{Date: date, EventName: runner.EventName, EventTime: runner.EventTime, RaceType: runner.RaceCategory})
+			complete[i] = true
+		}
+
+		data, err := repos.Form.Summary(ctx, runner.ID, day)
+		if err != nil {
+			return nil, err
+		}
+		if data.SelectionID == 0 {
+			continue
+		}
+		data.CurrentDistance = racing.ParseDistance(runner.RaceDistance)
+		data.CurrentCourse = features.RaceCourse(runner)
+		data.GoingForm = going.Form(data.Features, runner.TrackCondition)
+		if data.NumRuns < limit {
+			limit = data.NumRuns
+		}
+
+		run, ok, err := repos.Form.RunOn(ctx, runner.ID, date)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || run.Position == "" {
+			complete[i] = false
+			continue
+		}
+		pos, _, finished := features.ParsePosition(run.Position)
+		races[i].Runners = append(races[i].Runners, Runner{
+			Data: data,
+			Won:  finished && pos == 1,
+			SP:   value.DecimalOdds(run.SPOdds),
+		})
+	}
+
+	var settled []Race
+	for i, race := range races {
+		winners := 0
+		for j := range race.Runners {
+			race.Runners[j].Limit = limit
+			if race.Runners[j].Won {
+				winners++
+			}
+		}
+		if complete[i] && winners == 1 {
+			settled = append(settled, race)
+		}
+	}
+	return settled, nil
+}
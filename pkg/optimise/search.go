@@ -0,0 +1,94 @@
+package optimise
+
+import "github.com/mmanjoura/race-picks-backend/pkg/models"
+
+// dimension is one weight the search varies and the values it tries.
+type dimension struct {
+	name   string
+	values []float64
+	set    func(w *models.ScoringWeights, v float64)
+}
+
+// dimensionsFor returns the weights searched from base. The distance
+// scores are searched as one scale on base's scores, keeping their shape.
+func dimensionsFor(base models.ScoringWeights) []dimension {
+	return []dimension{
+		{"few_runs", []float64{10, 15, 20, 25, 30}, func(w *models.ScoringWeights, v float64) { w.FewRuns = int(v) }},
+		{"few_runs_bonus", []float64{0, 1, 2, 4, 8}, func(w *models.ScoringWeights, v float64) { w.FewRunsBonus = v }},
+		{"distance_split", []float64{10, 12, 14}, func(w *models.ScoringWeights, v float64) { w.DistanceSplit = v }},
+		{"distance_scale", []float64{0, 0.5, 1, 1.5, 2}, func(w *models.ScoringWeights, v float64) {
+			scores := make([]float64, len(base.DistanceScores))
+			for i, s := range base.DistanceScores {
+				scores[i] = s * v
+			}
+			w.DistanceScores = scores
+		}},
+		{"non_finish_penalty", []float64{0, 2.5, 5, 10}, func(w *models.ScoringWeights, v float64) { w.NonFinishPenalty = v }},
+		{"position_multiplier", []float64{5, 10, 15, 20}, func(w *models.ScoringWeights, v float64) { w.PositionMultiplier = v }},
+		{"going_score", []float64{0, 10, 20, 40}, func(w *models.ScoringWeights, v float64) { w.GoingScore = v }},
+		{"course_distance_winner_score", []float64{0, 5, 10, 20}, func(w *models.ScoringWeights, v float64) { w.CourseDistanceWinnerScore = v }},
+	}
+}
+
+// grid tries the combinations of every dimension's values in order, up to
+// max of them.
+func grid(base models.ScoringWeights, max int, try func(models.ScoringWeights)) {
+	dims := dimensionsFor(base)
+	index := make([]int, len(dims))
+	for n := 0; n < max; n++ {
+		w := base
+		for d, dim := range dims {
+			dim.set(&w, dim.values[index[d]])
+		}
+		try(w)
+
+		// Advance the index like an odometer
+		d := len(dims) - 1
+		for ; d >= 0; d-- {
+			index[d]++
+			if index[d] < len(dims[d].values) {
+				break
+			}
+			index[d] = 0
+		}
+		if d < 0 {
+			return
+		}
+	}
+}
+
+// random tries max combinations of values drawn with intn.
+func random(base models.ScoringWeights, max int, intn func(int) int, try func(models.ScoringWeights)) {
+	dims := dimensionsFor(base)
+	for n := 0; n < max; n++ {
+		w := base
+		for _, dim := range dims {
+			dim.set(&w, dim.values[intn(len(dim.values))])
+		}
+		try(w)
+	}
+}
+
+// coordinateDescent moves one dimension at a time to its best value,
+// holding the others, until a full pass improves nothing or max tries are
+// spent. value is the objective at base.
+func coordinateDescent(base models.ScoringWeights, value float64, max int, try func(models.ScoringWeights) float64) {
+	dims := dimensionsFor(base)
+	current, tries := base, 0
+	for improved := true; improved; {
+		improved = false
+		for _, dim := range dims {
+			for _, v := range dim.values {
+				if tries == max {
+					return
+				}
+				w := current
+				dim.set(&w, v)
+				tries++
+				if got := try(w); got > value {
+					current, value, improved = w, got, true
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Package predict defines what a prediction model is and keeps the named
+// models the API can choose between.
+package predict
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// Race is the context a model predicts in: the race or day being predicted,
+// the filters sent with the request and the point in time form is read at.
+type Race struct {
+	Params models.RaceParameters
+	AsOf   time.Time
+}
+
+// Predictor scores the runners of one or more races. Every result carries
+// the runner's TotalScore, by which picks are ranked; models that produce
+// probabilities also set WinProbability and use it as the score. Runners
+// a model cannot score are left out.
+type Predictor interface {
+	Name() string
+	Version() string
+	Predict(ctx context.Context, race Race, runners []models.Runner) ([]models.SelectionResult, error)
+}
+
+// DefaultModel is used when a request does not name a model. It is the
+// heuristic the picks were made with before models could be chosen.
+const DefaultModel = "heuristic"
+
+// ErrNotTrained is returned for a learned model with no stored weights.
+var ErrNotTrained = errors.New("model has not been trained")
+
+// Loader returns the given version of a model. An empty version asks for
+// the current one.
+type Loader func(ctx context.Context, version string) (Predictor, error)
+
+// Fixed wraps a model that has only one version, so asking for any other
+// is an error.
+func Fixed(p Predictor) Loader {
+	return func(ctx context.Context, version string) (Predictor, error) {
+		if version != "" && version != p.Version() {
+			return nil, &UnknownModelError{Name: p.Name(), Version: version}
+		}
+		return p, nil
+	}
+}
+
+// UnknownModelError is returned for a model or version that does not
+// exist.
+type UnknownModelError struct {
+	Name    string
+	Version string
+}
+
+func (e *UnknownModelError) Error() string {
+	if e.Version != "" {
+		return fmt.Sprintf("model %q has no version %q", e.Name, e.Version)
+	}
+	return fmt.Sprintf("unknown model %q", e.Name)
+}
+
+// Registry holds the models by name.
+type Registry struct {
+	loaders map[string]Loader
+	names   []string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{loaders: map[string]Loader{}}
+}
+
+// Register adds a model under name, replacing any of the same name.
+func (r *Registry) Register(name string, load Loader) {
+	if _, ok := r.loaders[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.loaders[name] = load
+}
+
+// Get loads a model by name and version. An empty name is DefaultModel.
+func (r *Registry) Get(ctx context.Context, name, version string) (Predictor, error) {
+	if name == "" {
+		name = DefaultModel
+	}
+	load, ok := r.loaders[name]
+	if !ok {
+		return nil, &UnknownModelError{Name: name}
+	}
+	return load(ctx, version)
+}
+
+// Names returns the registered model names in alphabetical order.
+func (r *Registry) Names() []string {
+	names := append([]string(nil), r.names...)
+	sort.Strings(names)
+	return names
+}
+
+// Stamp records on each result which model and version produced it.
+func Stamp(p Predictor, results []models.SelectionResult) []models.SelectionResult {
+	for i := range results {
+		results[i].Model = p.Name()
+		results[i].ModelVersion = p.Version()
+	}
+	return results
+}
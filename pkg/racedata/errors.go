@@ -0,0 +1,32 @@
+package racedata
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrSelectorNoMatch is wrapped by every SelectorError.
+var ErrSelectorNoMatch = errors.New("selector matched zero rows")
+
+// SelectorError reports a page on which a required selector matched nothing,
+// or matched text the parser could not read, which usually means the site's
+// layout has changed.
+type SelectorError struct {
+	Page     string
+	Selector string
+
+	// Text is what the selector matched when it was not what the parser
+	// expected, "" when it matched nothing.
+	Text string
+}
+
+func (e *SelectorError) Error() string {
+	if e.Text != "" {
+		return fmt.Sprintf("racedata: %s: %q matched unexpected text %q", e.Page, e.Selector, e.Text)
+	}
+	return fmt.Sprintf("racedata: %s: %q: %v", e.Page, e.Selector, ErrSelectorNoMatch)
+}
+
+func (e *SelectorError) Unwrap() error {
+	return ErrSelectorNoMatch
+}
@@ -0,0 +1,99 @@
+package racedata
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// Fixture serves race data from JSON files recorded under Dir:
+//
+//	racecards/<YYYY-MM-DD>.json  []models.TodayRunners
+//	conditions/<event link>.json models.RaceConditon
+//	form/<selection link>.json   []models.SelectionsForm
+//
+// Links are turned into file names by FixtureKey.
+type Fixture struct {
+	Dir string
+}
+
+// NewFixture returns a source reading from dir.
+func NewFixture(dir string) *Fixture {
+	return &Fixture{Dir: dir}
+}
+
+// FixtureKey turns a site link such as /racing/profiles/horse/123 into the
+// file name used for it, e.g. racing_profiles_horse_123.
+func FixtureKey(link string) string {
+	return strings.ReplaceAll(strings.Trim(link, "/"), "/", "_")
+}
+
+func (f *Fixture) Racecards(date string) ([]models.TodayRunners, error) {
+	var runners []models.TodayRunners
+	if err := f.read(filepath.Join("racecards", date+".json"), &runners); err != nil {
+		return nil, err
+	}
+	return runners, nil
+}
+
+func (f *Fixture) RaceConditions(eventLink string) (models.RaceConditon, error) {
+	var conditions models.RaceConditon
+	err := f.read(filepath.Join("conditions", FixtureKey(eventLink)+".json"), &conditions)
+	return conditions, err
+}
+
+func (f *Fixture) FormHistory(selectionLink string) ([]models.SelectionsForm, error) {
+	var form []models.SelectionsForm
+	if err := f.read(filepath.Join("form", FixtureKey(selectionLink)+".json"), &form); err != nil {
+		return nil, err
+	}
+	return form, nil
+}
+
+func (f *Fixture) FormSince(selectionLink string, lastRunDate time.Time) ([]models.SelectionsForm, error) {
+	form, err := f.FormHistory(selectionLink)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest []models.SelectionsForm
+	for _, run := range form {
+		if run.RaceDate.After(lastRunDate) {
+			latest = append(latest, run)
+		}
+	}
+	return latest, nil
+}
+
+func (f *Fixture) HorseProfile(selectionLink string) (models.SelectionsForm, error) {
+	form, err := f.FormHistory(selectionLink)
+	if err != nil || len(form) == 0 {
+		return models.SelectionsForm{}, err
+	}
+
+	profile := form[0]
+	return models.SelectionsForm{
+		Age:     profile.Age,
+		Trainer: profile.Trainer,
+		Sex:     profile.Sex,
+		Sire:    profile.Sire,
+		Dam:     profile.Dam,
+		Owner:   profile.Owner,
+	}, nil
+}
+
+func (f *Fixture) read(name string, v interface{}) error {
+	data, err := os.ReadFile(filepath.Join(f.Dir, name))
+	if err != nil {
+		return fmt.Errorf("fixture %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("fixture %s: %w", name, err)
+	}
+	return nil
+}
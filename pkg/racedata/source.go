@@ -0,0 +1,47 @@
+// Package racedata abstracts where racecards, race conditions and horse form
+// come from, so the preparation handlers do not depend on a single website.
+package racedata
+
+import (
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// RaceDataSource is implemented by every provider of race data.
+type RaceDataSource interface {
+	// Racecards returns the runners declared for the given date (YYYY-MM-DD).
+	// Race conditions may be left empty, in which case the caller fetches
+	// them through RaceConditions.
+	Racecards(date string) ([]models.TodayRunners, error)
+
+	// RaceConditions returns the category, class, distance, going, field size
+	// and track of the race behind eventLink.
+	RaceConditions(eventLink string) (models.RaceConditon, error)
+
+	// FormHistory returns every run listed on the horse's profile.
+	FormHistory(selectionLink string) ([]models.SelectionsForm, error)
+
+	// FormSince returns the runs on the horse's profile dated after lastRunDate.
+	FormSince(selectionLink string, lastRunDate time.Time) ([]models.SelectionsForm, error)
+
+	// HorseProfile returns the horse's age, trainer, sex, sire, dam and owner.
+	HorseProfile(selectionLink string) (models.SelectionsForm, error)
+}
+
+// FromConfig returns the source named by the Configurations table:
+// recorded fixtures under RACE_DATA_FIXTURES, pages replayed from
+// RACE_DATA_REPLAY, or the live site, recording every page fetched into
+// RACE_DATA_RECORD when it is set.
+func FromConfig(config map[string]string) RaceDataSource {
+	switch {
+	case config["RACE_DATA_FIXTURES"] != "":
+		return NewFixture(config["RACE_DATA_FIXTURES"])
+	case config["RACE_DATA_REPLAY"] != "":
+		return NewReplay(config["RACE_DATA_REPLAY"])
+	}
+
+	source := NewSportingLife()
+	source.RecordDir = config["RACE_DATA_RECORD"]
+	return source
+}
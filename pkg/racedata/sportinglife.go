@@ -0,0 +1,334 @@
+package racedata
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocolly/colly"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// Pages and selectors of the site. The class names are generated by the
+// site's build and change without notice; the parsers report a SelectorError
+// when one of them stops matching.
+const (
+	abcGuidePath = "/racing/abc-guide/abc-guide"
+
+	racecardRowSelector   = "table.AbcTable__TableContent-sc-9z9a8v-3 tbody tr"
+	raceSummarySelector   = "li.RacingRacecardSummary__StyledAdditionalInfo-sc-1intsbr-2"
+	profileHeaderSelector = "table.Header__DataTable-xeaizz-1"
+	formTableSelector     = "table.FormTable__StyledTable-sc-1xr7jxa-1"
+	formRowSelector       = formTableSelector + " tbody tr"
+)
+
+// SportingLife scrapes race data from sportinglife.com.
+type SportingLife struct {
+	BaseURL string
+
+	// RecordDir, when set, receives a copy of every page fetched, named
+	// FixtureKey(path) + ".html".
+	RecordDir string
+
+	// ReplayDir, when set, serves pages from a directory previously filled
+	// through RecordDir instead of the live site.
+	ReplayDir string
+}
+
+// NewSportingLife returns a scraper pointed at the live site.
+func NewSportingLife() *SportingLife {
+	return &SportingLife{BaseURL: "https://www.sportinglife.com"}
+}
+
+// NewReplay returns a scraper that parses the pages recorded under dir.
+func NewReplay(dir string) *SportingLife {
+	return &SportingLife{ReplayDir: dir}
+}
+
+// newCollector returns a collector wired for recording or replay.
+func (s *SportingLife) newCollector() *colly.Collector {
+	c := colly.NewCollector()
+
+	if s.ReplayDir != "" {
+		t := &http.Transport{}
+		t.RegisterProtocol("file", http.NewFileTransport(http.Dir(s.ReplayDir)))
+		c.WithTransport(t)
+	}
+
+	if s.RecordDir != "" {
+		c.OnResponse(func(r *colly.Response) {
+			name := filepath.Join(s.RecordDir, FixtureKey(r.Request.URL.Path)+".html")
+			if err := os.WriteFile(name, r.Body, 0o644); err != nil {
+				log.Printf("racedata: recording %s: %v", name, err)
+			}
+		})
+	}
+
+	return c
+}
+
+// pageURL returns the address to visit for a site link.
+func (s *SportingLife) pageURL(link string) string {
+	if s.ReplayDir != "" {
+		return "file:///" + FixtureKey(link) + ".html"
+	}
+	return s.BaseURL + link
+}
+
+// Racecards scrapes the ABC guide. The guide only ever lists the current
+// day's runners, so any other date is refused on the live site, and date is
+// used to stamp EventDate on the results. Race conditions are left empty for
+// the caller to fetch through RaceConditions.
+func (s *SportingLife) Racecards(date string) ([]models.TodayRunners, error) {
+	if s.ReplayDir == "" && date != time.Now().Format("2006-01-02") {
+		return nil, fmt.Errorf("racedata: the ABC guide only lists today's runners, asked for %s", date)
+	}
+
+	// Initialize the collector
+	c := s.newCollector()
+
+	eventDate, _ := time.Parse("2006-01-02", date)
+
+	// Slice to store all horse information
+	horses := []models.TodayRunners{}
+
+	// Compile the regular expression to match digits at the end of the string
+	re := regexp.MustCompile(`/horse/(\d+)$`)
+
+	// On HTML element
+	matched := 0
+	c.OnHTML(racecardRowSelector, func(e *colly.HTMLElement) {
+		matched++
+		name := e.ChildText("td:nth-child(1) a")
+		selectionLink := e.ChildAttr("td:nth-child(1) a", "href") // Get the href attribute
+		event := e.ChildText("td:nth-child(3) a")
+		eventLink := e.ChildAttr("td:nth-child(3) a", "href") // Get the href attribute
+		price := e.ChildText("th:nth-child(5) span")
+
+		parts := strings.SplitN(event, " ", 2)
+		if len(parts) != 2 {
+			return
+		}
+		eventTime := parts[0]
+		eventName := parts[1]
+
+		// Find the substring that matches the pattern and extract the horse_Id
+		match := re.FindStringSubmatch(selectionLink)
+		selectionId := 0
+		if len(match) > 1 {
+			selectionId, _ = strconv.Atoi(match[1])
+		}
+
+		horse := models.TodayRunners{
+			SelectionName: name,
+			SelectionLink: selectionLink, // Add the selection link to the struct
+			EventLink:     eventLink,     // Add the event link to the struct
+			EventTime:     eventTime,
+			EventName:     eventName,
+			Price:         price,
+			SelectionID:   selectionId,
+			EventDate:     eventDate,
+		}
+
+		horses = append(horses, horse)
+	})
+
+	// Start scraping the URL
+	if err := c.Visit(s.pageURL(abcGuidePath)); err != nil {
+		return nil, err
+	}
+	if matched == 0 {
+		return nil, &SelectorError{Page: abcGuidePath, Selector: racecardRowSelector}
+	}
+
+	return horses, nil
+}
+
+// RaceConditions scrapes the summary line at the top of a racecard. The line
+// has five or six fields separated by '|'; anything else is reported as a
+// SelectorError.
+func (s *SportingLife) RaceConditions(eventLink string) (models.RaceConditon, error) {
+	// Initialize the collector
+	c := s.newCollector()
+	raceConditons := models.RaceConditon{}
+
+	// Set the HTML selector and processing logic
+	matched := 0
+	unexpected := ""
+	c.OnHTML(raceSummarySelector, func(e *colly.HTMLElement) {
+		// Split the content by '|' and trim whitespace from each part
+		parts := strings.Split(e.Text, "|")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+
+		switch len(parts) {
+		case 6:
+			raceConditons = models.RaceConditon{
+				RaceCategory:    parts[0],
+				RaceClass:       parts[1],
+				RaceDistance:    parts[2],
+				TrackCondition:  parts[3],
+				NumberOfRunners: parts[4],
+				RaceTrack:       parts[5],
+			}
+		case 5:
+			raceConditons = models.RaceConditon{
+				RaceCategory:    parts[0],
+				RaceDistance:    parts[1],
+				TrackCondition:  parts[2],
+				NumberOfRunners: parts[3],
+				RaceTrack:       parts[4],
+			}
+		default:
+			unexpected = strings.TrimSpace(e.Text)
+			return
+		}
+		matched++
+	})
+
+	// Visit the URL
+	if err := c.Visit(s.pageURL(eventLink)); err != nil {
+		return raceConditons, err
+	}
+	if matched == 0 {
+		return raceConditons, &SelectorError{Page: eventLink, Selector: raceSummarySelector, Text: unexpected}
+	}
+
+	return raceConditons, nil
+}
+
+// FormHistory scrapes every row of the horse's form table.
+func (s *SportingLife) FormHistory(selectionLink string) ([]models.SelectionsForm, error) {
+	return s.scrapeForm(selectionLink, time.Time{})
+}
+
+// FormSince scrapes the rows of the horse's form table dated after lastRunDate.
+func (s *SportingLife) FormSince(selectionLink string, lastRunDate time.Time) ([]models.SelectionsForm, error) {
+	return s.scrapeForm(selectionLink, lastRunDate)
+}
+
+// HorseProfile scrapes the header table of the horse's profile page.
+func (s *SportingLife) HorseProfile(selectionLink string) (models.SelectionsForm, error) {
+	c := s.newCollector()
+
+	selectionForm := models.SelectionsForm{}
+	matched := onProfileHeader(c, &selectionForm)
+
+	// Start scraping the URL
+	if err := c.Visit(s.pageURL(selectionLink)); err != nil {
+		return selectionForm, err
+	}
+	if *matched == 0 {
+		return selectionForm, &SelectorError{Page: selectionLink, Selector: profileHeaderSelector}
+	}
+
+	return selectionForm, nil
+}
+
+// scrapeForm reads the form table, skipping runs on or before after when it
+// is set.
+func (s *SportingLife) scrapeForm(selectionLink string, after time.Time) ([]models.SelectionsForm, error) {
+	c := s.newCollector()
+
+	// Slice to store all horse information
+	selectionsForm := []models.SelectionsForm{}
+
+	profile := models.SelectionsForm{}
+	headerMatched := onProfileHeader(c, &profile)
+
+	tableMatched := 0
+	c.OnHTML(formTableSelector, func(e *colly.HTMLElement) {
+		tableMatched++
+	})
+
+	c.OnHTML(formRowSelector, func(e *colly.HTMLElement) {
+		raceDate := e.ChildText("td:nth-child(1) a")
+		raceLink := e.ChildAttr("td:nth-child(1) a", "href")
+		position := e.ChildText("td:nth-child(2)")
+		rating := e.ChildText("td:nth-child(3)")
+		raceType := e.ChildText("td:nth-child(4)")
+		racecourse := e.ChildText("td:nth-child(5)")
+		distance := e.ChildText("td:nth-child(6)")
+		going := e.ChildText("td:nth-child(7)")
+		class := e.ChildText("td:nth-child(8)")
+		spOdds := e.ChildText("td:nth-child(9)")
+
+		// Race dates are listed in UK format, e.g. 21/09/24
+		parsedRaceDate, err := time.Parse("02/01/06", raceDate)
+		if err != nil {
+			return
+		}
+
+		if !after.IsZero() && !parsedRaceDate.After(after) {
+			return
+		}
+
+		selectionForm := models.SelectionsForm{
+			RaceDate:   parsedRaceDate,
+			Position:   position,
+			Rating:     rating,
+			RaceType:   raceType,
+			Racecourse: racecourse,
+			Distance:   distance,
+			Going:      going,
+			RaceClass:  class,
+			SPOdds:     spOdds,
+			RaceURL:    raceLink,
+			EventDate:  parsedRaceDate,
+			CreatedAt:  time.Now(),
+		}
+
+		selectionsForm = append(selectionsForm, selectionForm)
+	})
+
+	// Start scraping the URL
+	if err := c.Visit(s.pageURL(selectionLink)); err != nil {
+		return nil, err
+	}
+
+	// A horse that has never run has a form table without rows, so only a
+	// missing header or table is treated as a layout change.
+	if *headerMatched == 0 {
+		return nil, &SelectorError{Page: selectionLink, Selector: profileHeaderSelector}
+	}
+	if tableMatched == 0 {
+		return nil, &SelectorError{Page: selectionLink, Selector: formTableSelector}
+	}
+
+	// The header table may be rendered after the form table, so the profile
+	// fields are copied once the whole page has been processed.
+	for i := range selectionsForm {
+		selectionsForm[i].Age = profile.Age
+		selectionsForm[i].Trainer = profile.Trainer
+		selectionsForm[i].Sex = profile.Sex
+		selectionsForm[i].Sire = profile.Sire
+		selectionsForm[i].Dam = profile.Dam
+		selectionsForm[i].Owner = profile.Owner
+	}
+
+	return selectionsForm, nil
+}
+
+// onProfileHeader fills the profile fields of form from the header table and
+// returns a counter of the header tables matched.
+func onProfileHeader(c *colly.Collector, form *models.SelectionsForm) *int {
+	matched := 0
+	c.OnHTML(profileHeaderSelector, func(e *colly.HTMLElement) {
+		matched++
+		form.Age = e.ChildText("tr:nth-child(1) td.Header__DataValue-xeaizz-4")
+		form.Trainer = e.ChildText("tr:nth-child(2) td.Header__DataValue-xeaizz-4 a")
+		form.Sex = e.ChildText("tr:nth-child(3) td.Header__DataValue-xeaizz-4")
+		form.Sire = e.ChildText("tr:nth-child(4) td.Header__DataValue-xeaizz-4")
+		form.Dam = e.ChildText("tr:nth-child(5) td.Header__DataValue-xeaizz-4")
+		form.Owner = e.ChildText("tr:nth-child(6) td.Header__DataValue-xeaizz-4")
+	})
+
+	return &matched
+}
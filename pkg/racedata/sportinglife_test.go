@@ -0,0 +1,190 @@
+package racedata
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+const pagesDir = "testdata/pages"
+
+// renamedPages copies the recorded pages to a temporary directory, replacing
+// old with new in each of them, as a site rebuild renaming a class would.
+func renamedPages(t *testing.T, old, new string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	entries, err := os.ReadDir(pagesDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		page, err := os.ReadFile(filepath.Join(pagesDir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		page = []byte(strings.ReplaceAll(string(page), old, new))
+		if err := os.WriteFile(filepath.Join(dir, entry.Name()), page, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSportingLifeFormHistory(t *testing.T) {
+	form, err := NewReplay(pagesDir).FormHistory("/racing/profiles/horse/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []models.SelectionsForm{
+		{Position: "1/9", Rating: "88", Racecourse: "York", Distance: "1m 2f", Going: "Good", RaceClass: "C2", SPOdds: "4/1"},
+		{Position: "3/12", Rating: "85", Racecourse: "Sandown", Distance: "1m", Going: "Soft", RaceClass: "C3", SPOdds: "6/1"},
+	}
+	if len(form) != len(want) {
+		t.Fatalf("got %d runs, want %d", len(form), len(want))
+	}
+	for i, run := range form {
+		w := want[i]
+		if run.Position != w.Position || run.Rating != w.Rating || run.Racecourse != w.Racecourse ||
+			run.Distance != w.Distance || run.Going != w.Going || run.RaceClass != w.RaceClass || run.SPOdds != w.SPOdds {
+			t.Errorf("run %d = %+v, want %+v", i, run, w)
+		}
+		if run.Trainer != "J Smith" || run.Sire != "Frankel" || run.Age != "5" {
+			t.Errorf("run %d has profile %q/%q/%q, want the header's", i, run.Age, run.Trainer, run.Sire)
+		}
+	}
+	if got := form[0].RaceDate.Format("2006-01-02"); got != "2024-05-20" {
+		t.Errorf("first run dated %s, want 2024-05-20", got)
+	}
+
+	since, err := NewReplay(pagesDir).FormSince("/racing/profiles/horse/1", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(since) != 1 || since[0].Racecourse != "York" {
+		t.Errorf("FormSince = %+v, want the York run only", since)
+	}
+}
+
+func TestSportingLifeFormHistoryOfUnracedHorse(t *testing.T) {
+	form, err := NewReplay(pagesDir).FormHistory("/racing/profiles/horse/2")
+	if err != nil {
+		t.Fatalf("empty form table: %v", err)
+	}
+	if len(form) != 0 {
+		t.Fatalf("got %d runs, want none", len(form))
+	}
+}
+
+func TestSportingLifeRaceConditions(t *testing.T) {
+	conditions, err := NewReplay(pagesDir).RaceConditions("/racing/racecards/2024-06-01/ascot/racecard/100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.RaceConditon{
+		RaceCategory:    "Flat",
+		RaceClass:       "Class 2",
+		RaceDistance:    "1m 2f",
+		TrackCondition:  "Good to Firm",
+		NumberOfRunners: "8 Runners",
+		RaceTrack:       "Turf",
+	}
+	if conditions != want {
+		t.Fatalf("RaceConditions = %+v, want %+v", conditions, want)
+	}
+}
+
+func TestSportingLifeRacecards(t *testing.T) {
+	runners, err := NewReplay(pagesDir).Racecards("2024-06-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runners) != 2 {
+		t.Fatalf("got %d runners, want 2", len(runners))
+	}
+	alpha := runners[0]
+	if alpha.SelectionID != 1 || alpha.SelectionName != "Alpha Star" || alpha.EventName != "Ascot" ||
+		alpha.EventTime != "14:30" || alpha.Price != "3/1" || alpha.RaceConditon != (models.RaceConditon{}) {
+		t.Errorf("first runner = %+v", alpha)
+	}
+}
+
+func TestSportingLifeRacecardsOnlyToday(t *testing.T) {
+	// Refused before anything is fetched, so the live site is not visited
+	if _, err := NewSportingLife().Racecards("2024-06-01"); err == nil {
+		t.Error("Racecards accepted a date other than today")
+	}
+}
+
+func TestSportingLifeReportsRenamedSelectors(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		scrape   func(s *SportingLife) error
+		selector string
+	}{
+		{
+			name: "racecard table",
+			old:  "AbcTable__TableContent-sc-9z9a8v-3", new: "AbcTable__TableContent-sc-1a2b3c-3",
+			scrape: func(s *SportingLife) error {
+				_, err := s.Racecards("2024-06-01")
+				return err
+			},
+			selector: racecardRowSelector,
+		},
+		{
+			name: "race summary",
+			old:  "RacingRacecardSummary__StyledAdditionalInfo-sc-1intsbr-2", new: "RacingRacecardSummary__Info-sc-9xx-2",
+			scrape: func(s *SportingLife) error {
+				_, err := s.RaceConditions("/racing/racecards/2024-06-01/ascot/racecard/100")
+				return err
+			},
+			selector: raceSummarySelector,
+		},
+		{
+			name: "race summary layout",
+			old:  "| 8 Runners | Turf", new: "",
+			scrape: func(s *SportingLife) error {
+				_, err := s.RaceConditions("/racing/racecards/2024-06-01/ascot/racecard/100")
+				return err
+			},
+			selector: raceSummarySelector,
+		},
+		{
+			name: "profile header",
+			old:  "Header__DataTable-xeaizz-1", new: "Header__DataTable-abcdef-1",
+			scrape: func(s *SportingLife) error {
+				_, err := s.FormHistory("/racing/profiles/horse/1")
+				return err
+			},
+			selector: profileHeaderSelector,
+		},
+		{
+			name: "form table",
+			old:  "FormTable__StyledTable-sc-1xr7jxa-1", new: "FormTable__StyledTable-sc-2yz9q-1",
+			scrape: func(s *SportingLife) error {
+				_, err := s.FormHistory("/racing/profiles/horse/1")
+				return err
+			},
+			selector: formTableSelector,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.scrape(NewReplay(renamedPages(t, test.old, test.new)))
+			if !errors.Is(err, ErrSelectorNoMatch) {
+				t.Fatalf("err = %v, want ErrSelectorNoMatch", err)
+			}
+			var selectorErr *SelectorError
+			if !errors.As(err, &selectorErr) || selectorErr.Selector != test.selector {
+				t.Fatalf("err = %v, want a SelectorError for %q", err, test.selector)
+			}
+		})
+	}
+}
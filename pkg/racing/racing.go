@@ -0,0 +1,54 @@
+// Package racing reads the dates, distances and prices race data is
+// written in. It is shared by the handlers and the feature store, so it
+// depends on neither.
+package racing
+
+import (
+	"strconv"
+	"strings"
+)
+
+// EventDateLayout is the YYYY-MM-DD form event dates are passed around in.
+const EventDateLayout = "2006-01-02"
+
+// ParseDistance returns a distance such as "1m 2f 110y" in furlongs. Parts
+// it cannot read count 0.
+func ParseDistance(dist string) float64 {
+	var totalFurlongs float64
+
+	// Split the distance string into components (miles, furlongs, yards)
+	parts := strings.Split(dist, " ")
+
+	for _, part := range parts {
+		if strings.HasSuffix(part, "m") { // Handle miles
+			miles, _ := strconv.ParseFloat(strings.TrimSuffix(part, "m"), 64)
+			totalFurlongs += miles * 8.0 // 1 mile = 8 furlongs
+		} else if strings.HasSuffix(part, "f") { // Handle furlongs
+			furlongs, _ := strconv.ParseFloat(strings.TrimSuffix(part, "f"), 64)
+			totalFurlongs += furlongs
+		} else if strings.HasSuffix(part, "y") { // Handle yards
+			yards, _ := strconv.ParseFloat(strings.TrimSuffix(part, "y"), 64)
+			totalFurlongs += yards / 220.0 // 1 furlong = 220 yards
+		}
+	}
+
+	return totalFurlongs
+}
+
+// ParseOdds returns fractional odds such as "3/1" as decimal odds, or 0 if
+// they are not fractional.
+func ParseOdds(oddsStr string) float64 {
+	// Implement your logic to convert odds from string to a numeric value
+	// For example, convert odds from fractional to decimal format
+	if strings.Contains(oddsStr, "/") {
+		parts := strings.Split(oddsStr, "/")
+		if len(parts) == 2 {
+			numerator, err1 := strconv.ParseFloat(parts[0], 64)
+			denominator, err2 := strconv.ParseFloat(parts[1], 64)
+			if err1 == nil && err2 == nil && denominator != 0 {
+				return numerator/denominator + 1
+			}
+		}
+	}
+	return 0.0
+}
@@ -0,0 +1,40 @@
+package racing
+
+import "testing"
+
+func TestParseDistance(t *testing.T) {
+	tests := []struct {
+		dist string
+		want float64
+	}{
+		{"1m 2f", 10},
+		{"2m", 16},
+		{"5f 110y", 5.5},
+		{"1m 7f 66y", 15.3},
+		{"", 0},
+		{"long", 0},
+	}
+	for _, tt := range tests {
+		if got := ParseDistance(tt.dist); got != tt.want {
+			t.Errorf("ParseDistance(%q) = %v, want %v", tt.dist, got, tt.want)
+		}
+	}
+}
+
+func TestParseOdds(t *testing.T) {
+	tests := []struct {
+		odds string
+		want float64
+	}{
+		{"3/1", 4},
+		{"1/2", 1.5},
+		{"5/0", 0},
+		{"Evs", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := ParseOdds(tt.odds); got != tt.want {
+			t.Errorf("ParseOdds(%q) = %v, want %v", tt.odds, got, tt.want)
+		}
+	}
+}
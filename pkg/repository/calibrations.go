@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// CalibrationRepo stores the calibrators fitted to the models' scores.
+type CalibrationRepo struct {
+	db     *sql.DB
+	writer *database.Writer
+}
+
+func NewCalibrationRepo(db *sql.DB, writer *database.Writer) *CalibrationRepo {
+	return &CalibrationRepo{db: db, writer: writer}
+}
+
+// Save stores a calibrator for a model version and returns it. The latest
+// one saved is the one used.
+func (r *CalibrationRepo) Save(ctx context.Context, model, modelVersion, method string, params, stats []byte) (models.Calibration, error) {
+	release, err := r.writer.Acquire(ctx)
+	if err != nil {
+		return models.Calibration{}, err
+	}
+	defer release()
+
+	saved := models.Calibration{
+		Model:        model,
+		ModelVersion: modelVersion,
+		Method:       method,
+		Params:       params,
+		Stats:        stats,
+		FittedAt:     time.Now(),
+	}
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO Calibrations (model, model_version, method, params, stats, fitted_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		model, modelVersion, method, string(params), string(stats), saved.FittedAt)
+	if err != nil {
+		return models.Calibration{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.Calibration{}, err
+	}
+	saved.ID = int(id)
+	return saved, nil
+}
+
+// Latest returns the calibrator last fitted to a model version. ok is false
+// if it has never been calibrated.
+func (r *CalibrationRepo) Latest(ctx context.Context, model, modelVersion string) (calibration models.Calibration, ok bool, err error) {
+	var params string
+	var stats sql.NullString
+	err = r.db.QueryRowContext(ctx, `
+		SELECT id, model, model_version, method, params, stats, fitted_at
+		FROM Calibrations
+		WHERE model = ? AND model_version = ?
+		ORDER BY id DESC
+		LIMIT 1`, model, modelVersion).
+		Scan(&calibration.ID, &calibration.Model, &calibration.ModelVersion, &calibration.Method, &params, &stats, &calibration.FittedAt)
+	if err == sql.ErrNoRows {
+		return models.Calibration{}, false, nil
+	}
+	if err != nil {
+		return models.Calibration{}, false, err
+	}
+
+	calibration.Params = []byte(params)
+	if stats.String != "" {
+		calibration.Stats = []byte(stats.String)
+	}
+	return calibration, true, nil
+}
@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/features"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// FeatureRepo keeps the RunnerFeatures store in step with SelectionsForm
+// and reads it.
+type FeatureRepo struct {
+	db     *sql.DB
+	writer *database.Writer
+}
+
+func NewFeatureRepo(db *sql.DB, writer *database.Writer) *FeatureRepo {
+	return &FeatureRepo{db: db, writer: writer}
+}
+
+// At returns a horse's features going into a race on asOf: the latest row
+// dated on or before it. A zero asOf returns the latest row, counting every
+// run. ok is false if the horse had not run before. A horse whose runs have
+// not been added to the store yet has its features computed from them, so
+// form saved before the store existed is read the same way until it is
+// backfilled.
+func (r *FeatureRepo) At(ctx context.Context, selectionID int, asOf time.Time) (f models.RunnerFeatures, ok bool, err error) {
+	date := asOfDate(asOf)
+	f, err = scanFeatures(r.db.QueryRowContext(ctx, `
+		SELECT `+featureColumns+`
+		FROM RunnerFeatures
+		WHERE selection_id = ? AND (? = '' OR as_of_date <= ?)
+		ORDER BY as_of_date DESC
+		LIMIT 1`, selectionID, date, date))
+	if err == sql.ErrNoRows {
+		f, ok, err = r.compute(ctx, selectionID, date)
+		if err != nil || !ok {
+			return models.RunnerFeatures{}, false, err
+		}
+	} else if err != nil {
+		return models.RunnerFeatures{}, false, err
+	}
+
+	if date != "" {
+		if last, err := time.Parse("2006-01-02", f.LastRunDate); err == nil {
+			f.DaysSinceLastRun = int(asOf.Sub(last).Hours() / 24)
+		}
+	}
+	return f, true, nil
+}
+
+// compute returns the snapshot At would read for a horse with no stored
+// rows dated on or before date, computed from its runs.
+func (r *FeatureRepo) compute(ctx context.Context, selectionID int, date string) (models.RunnerFeatures, bool, error) {
+	runs, name, err := r.runs(ctx, selectionID)
+	if err != nil || len(runs) == 0 {
+		return models.RunnerFeatures{}, false, err
+	}
+
+	snapshots := features.Snapshots(runs)
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if date == "" || snapshots[i].AsOfDate <= date {
+			f := snapshots[i]
+			f.SelectionName = name
+			return f, true, nil
+		}
+	}
+	return models.RunnerFeatures{}, false, nil
+}
+
+// Refresh recomputes a horse's features from its stored runs and replaces
+// the rows dated after since, the earliest day a run was added or changed
+// on. A zero since rebuilds every row of the horse.
+func (r *FeatureRepo) Refresh(ctx context.Context, selectionID int, since time.Time) error {
+	runs, name, err := r.runs(ctx, selectionID)
+	if err != nil {
+		return err
+	}
+	after := asOfDate(since)
+
+	release, err := r.writer.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM RunnerFeatures WHERE selection_id = ? AND as_of_date > ?`, selectionID, after); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, f := range features.Snapshots(runs) {
+		if f.AsOfDate <= after {
+			continue
+		}
+		f.SelectionName = name
+
+		lists, err := encodeLists(f.Positions, f.Finishes, f.Distances, f.Courses, f.RaceDates, f.Goings, f.GoingRecords)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO RunnerFeatures (
+				selection_id, as_of_date, selection_name, age, trainer, sex, sire, dam, owner, race_class,
+				num_runs, win_count, first_run_date, last_run_date, duration,
+				avg_position, avg_rating, avg_distance, avg_odds,
+				positions, finishes, distances, courses, race_dates, goings, going_records,
+				rating_trend, last_class, class_change, computed_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			selectionID, f.AsOfDate, f.SelectionName, f.Age, f.Trainer, f.Sex, f.Sire, f.Dam, f.Owner, f.RaceClass,
+			f.NumRuns, f.WinCount, f.FirstRunDate, f.LastRunDate, f.Duration,
+			f.AvgPosition, f.AvgRating, f.AvgDistance, f.AvgOdds,
+			lists[0], lists[1], lists[2], lists[3], lists[4], lists[5], lists[6],
+			f.RatingTrend, f.LastClass, f.ClassChange, now); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UpdateProfile copies a horse's profile onto its stored features, as
+// FormRepo.UpdateProfile does onto its runs.
+func (r *FeatureRepo) UpdateProfile(ctx context.Context, selectionID int, age, trainer, sex, sire, dam, owner string) error {
+	release, err := r.writer.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE RunnerFeatures
+		SET age = ?, trainer = ?, sex = ?, sire = ?, dam = ?, owner = ?
+		WHERE selection_id = ?`,
+		age, trainer, sex, sire, dam, owner, selectionID)
+	return err
+}
+
+// SelectionIDs returns every horse with stored runs.
+func (r *FeatureRepo) SelectionIDs(ctx context.Context) ([]int, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT DISTINCT selection_id FROM SelectionsForm WHERE selection_id IS NOT NULL ORDER BY selection_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Stale returns every horse with stored runs whose features are missing,
+// such as form saved before the store existed, or were stored before the
+// going was recorded. A snapshot lists the going of each of its runs, so
+// a row with runs and no goings predates them.
+func (r *FeatureRepo) Stale(ctx context.Context) ([]int, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT DISTINCT selection_id FROM SelectionsForm sf
+		WHERE selection_id IS NOT NULL
+			AND (NOT EXISTS (SELECT 1 FROM RunnerFeatures rf WHERE rf.selection_id = sf.selection_id)
+				OR EXISTS (SELECT 1 FROM RunnerFeatures rf WHERE rf.selection_id = sf.selection_id AND rf.num_runs > 0 AND rf.goings = '[]'))
+		ORDER BY selection_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// runs returns every stored run of a horse, oldest first, and its latest
+// name.
+func (r *FeatureRepo) runs(ctx context.Context, selectionID int) ([]models.SelectionsForm, string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT selection_name, race_date, position, rating, race_class, racecourse, distance, going, sp_odds,
+			Age, Trainer, Sex, Sire, Dam, Owner
+		FROM SelectionsForm
+		WHERE selection_id = ?
+		ORDER BY race_date`, selectionID)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var runs []models.SelectionsForm
+	var name string
+	for rows.Next() {
+		run := models.SelectionsForm{SelectionID: selectionID}
+		var selectionName, position, rating, raceClass, racecourse, distance, runGoing, spOdds, age, trainer, sex, sire, dam, owner sql.NullString
+		var raceDate sql.NullTime
+		if err := rows.Scan(&selectionName, &raceDate, &position, &rating, &raceClass, &racecourse, &distance, &runGoing, &spOdds,
+			&age, &trainer, &sex, &sire, &dam, &owner); err != nil {
+			return nil, "", err
+		}
+		if selectionName.String != "" {
+			name = selectionName.String
+		}
+		run.RaceDate = raceDate.Time
+		run.Position = position.String
+		run.Rating = rating.String
+		run.RaceClass = raceClass.String
+		run.Racecourse = racecourse.String
+		run.Distance = distance.String
+		run.Going = runGoing.String
+		run.SPOdds = spOdds.String
+		run.Age = age.String
+		run.Trainer = trainer.String
+		run.Sex = sex.String
+		run.Sire = sire.String
+		run.Dam = dam.String
+		run.Owner = owner.String
+		runs = append(runs, run)
+	}
+	return runs, name, rows.Err()
+}
+
+const featureColumns = `selection_id, as_of_date, selection_name, age, trainer, sex, sire, dam, owner, race_class,
+	num_runs, win_count, first_run_date, last_run_date, duration,
+	avg_position, avg_rating, avg_distance, avg_odds,
+	positions, finishes, distances, courses, race_dates, goings, going_records,
+	rating_trend, last_class, class_change`
+
+func scanFeatures(row interface{ Scan(...interface{}) error }) (models.RunnerFeatures, error) {
+	var f models.RunnerFeatures
+	var selectionName, age, trainer, sex, sire, dam, owner, raceClass sql.NullString
+	var positions, finishes, distances, courses, raceDates, goings, goingRecords string
+	if err := row.Scan(&f.SelectionID, &f.AsOfDate, &selectionName, &age, &trainer, &sex, &sire, &dam, &owner, &raceClass,
+		&f.NumRuns, &f.WinCount, &f.FirstRunDate, &f.LastRunDate, &f.Duration,
+		&f.AvgPosition, &f.AvgRating, &f.AvgDistance, &f.AvgOdds,
+		&positions, &finishes, &distances, &courses, &raceDates, &goings, &goingRecords,
+		&f.RatingTrend, &f.LastClass, &f.ClassChange); err != nil {
+		return models.RunnerFeatures{}, err
+	}
+	f.SelectionName = selectionName.String
+	f.Age = age.String
+	f.Trainer = trainer.String
+	f.Sex = sex.String
+	f.Sire = sire.String
+	f.Dam = dam.String
+	f.Owner = owner.String
+	f.RaceClass = raceClass.String
+
+	for _, list := range []struct {
+		encoded string
+		into    interface{}
+	}{
+		{positions, &f.Positions},
+		{finishes, &f.Finishes},
+		{distances, &f.Distances},
+		{courses, &f.Courses},
+		{raceDates, &f.RaceDates},
+		{goings, &f.Goings},
+		{goingRecords, &f.GoingRecords},
+	} {
+		if err := json.Unmarshal([]byte(list.encoded), list.into); err != nil {
+			return models.RunnerFeatures{}, err
+		}
+	}
+	return f, nil
+}
+
+func encodeLists(lists ...interface{}) ([]string, error) {
+	encoded := make([]string, len(lists))
+	for i, list := range lists {
+		b, err := json.Marshal(list)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = string(b)
+	}
+	return encoded, nil
+}
@@ -0,0 +1,353 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// beforeClause keeps the runs dated before an as-of date. It takes the date
+// twice; an empty date disables the bound.
+const beforeClause = `(? = '' OR DATE(race_date) < ?)`
+
+// asOfDate formats asOf for beforeClause. Form is dated by day, so a run
+// on the as-of day itself is excluded.
+func asOfDate(asOf time.Time) string {
+	if asOf.IsZero() {
+		return ""
+	}
+	return asOf.Format("2006-01-02")
+}
+
+// FormRepo reads and stores the past runs in SelectionsForm.
+type FormRepo struct {
+	db       *sql.DB
+	writer   *database.Writer
+	features *FeatureRepo
+}
+
+func NewFormRepo(db *sql.DB, writer *database.Writer) *FormRepo {
+	return &FormRepo{db: db, writer: writer, features: NewFeatureRepo(db, writer)}
+}
+
+// Summary returns a horse's form going into a race on asOf from the
+// feature store. Only runs dated before asOf count, so a race's own result
+// and anything later never leak into its form; a zero asOf counts every
+// run. A horse with no runs comes back with a zero SelectionID.
+func (r *FormRepo) Summary(ctx context.Context, selectionID int, asOf time.Time) (models.AnalysisData, error) {
+	f, ok, err := r.features.At(ctx, selectionID, asOf)
+	if err != nil || !ok {
+		return models.AnalysisData{}, err
+	}
+
+	data := models.AnalysisData{
+		SelectionID:         f.SelectionID,
+		SelectionName:       f.SelectionName,
+		Age:                 f.Age,
+		Trainer:             f.Trainer,
+		Sex:                 f.Sex,
+		Sire:                f.Sire,
+		Dam:                 f.Dam,
+		Owner:               f.Owner,
+		EventClass:          f.RaceClass,
+		RecoveryDays:        float64(f.DaysSinceLastRun),
+		NumRuns:             f.NumRuns,
+		LastRunDate:         f.LastRunDate,
+		Duration:            f.Duration,
+		WinCount:            f.WinCount,
+		AvgPosition:         f.AvgPosition,
+		AvgRating:           f.AvgRating,
+		AvgDistanceFurlongs: f.AvgDistance,
+		AvgOdds:             f.AvgOdds,
+		Features:            f,
+	}
+	if len(f.Positions) > 0 {
+		data.Position = f.Positions[0]
+	}
+
+	// The joined lists are kept for API clients
+	distances := make([]string, len(f.Distances))
+	for i, distance := range f.Distances {
+		distances[i] = strconv.FormatFloat(distance, 'f', -1, 64)
+	}
+	data.AllPositions = strings.Join(f.Positions, ", ")
+	data.AllDistances = strings.Join(distances, ", ")
+	data.AllCources = strings.Join(f.Courses, ", ")
+	data.AllRaceDates = strings.Join(f.RaceDates, ", ")
+
+	return data, nil
+}
+
+// LeastRuns returns the number of past runs, dated before asOf, of the least
+// experienced runner in a race. ok is false when none of the runners has any
+// form.
+func (r *FormRepo) LeastRuns(ctx context.Context, eventName, eventTime, eventDate string, asOf time.Time) (runs int, ok bool, err error) {
+	err = r.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*) AS number_of_runs
+		FROM
+			SelectionsForm
+			INNER JOIN EventRunners ON SelectionsForm.selection_id = EventRunners.selection_id
+			WHERE EventRunners.event_name = ? and EventRunners.event_time = ? and DATE(EventRunners.event_date) = ?
+			AND `+beforeClause+`
+		GROUP BY
+			SelectionsForm.selection_id
+		ORDER BY number_of_runs
+		LIMIT 1`, eventName, eventTime, eventDate, asOfDate(asOf), asOfDate(asOf)).Scan(&runs)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return runs, true, nil
+}
+
+// RunOn returns the form row of a horse's run on date. ok is false if it
+// did not run that day or its result has not been scraped yet.
+func (r *FormRepo) RunOn(ctx context.Context, selectionID int, date string) (run models.SelectionsForm, ok bool, err error) {
+	var selectionName, position, rating, raceType, racecourse, distance, going, raceClass, spOdds sql.NullString
+	err = r.db.QueryRowContext(ctx, `
+		SELECT 	selection_id,
+				selection_name,
+				race_date,
+				position,
+				rating,
+				race_type,
+				racecourse,
+				distance,
+				going,
+				race_class,
+				sp_odds
+		FROM SelectionsForm
+		WHERE DATE(race_date) = ? and selection_id = ?
+		LIMIT 1`, date, selectionID).
+		Scan(
+			&run.SelectionID,
+			&selectionName,
+			&run.RaceDate,
+			&position,
+			&rating,
+			&raceType,
+			&racecourse,
+			&distance,
+			&going,
+			&raceClass,
+			&spOdds,
+		)
+	if err == sql.ErrNoRows {
+		return models.SelectionsForm{}, false, nil
+	}
+	if err != nil {
+		return models.SelectionsForm{}, false, err
+	}
+
+	run.Position = position.String
+	run.Rating = rating.String
+	run.RaceType = raceType.String
+	run.Racecourse = racecourse.String
+	run.Distance = distance.String
+	run.Going = going.String
+	run.RaceClass = raceClass.String
+	run.SPOdds = spOdds.String
+	run.EventDate = run.RaceDate
+	return run, true, nil
+}
+
+// History returns every run dated before asOf, ordered by horse and date.
+// Only the fields the learned predictors train on are filled in.
+func (r *FormRepo) History(ctx context.Context, asOf time.Time) ([]models.SelectionsForm, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT selection_id, race_date, position, rating, distance, racecourse, going
+		FROM SelectionsForm
+		WHERE `+beforeClause+`
+		ORDER BY selection_id, race_date`, asOfDate(asOf), asOfDate(asOf))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanRuns(rows)
+}
+
+func scanRuns(rows *sql.Rows) ([]models.SelectionsForm, error) {
+	runs := []models.SelectionsForm{}
+	for rows.Next() {
+		var run models.SelectionsForm
+		var raceDate sql.NullTime
+		var position, rating, distance, racecourse, going sql.NullString
+		if err := rows.Scan(&run.SelectionID, &raceDate, &position, &rating, &distance, &racecourse, &going); err != nil {
+			return nil, err
+		}
+		run.RaceDate = raceDate.Time
+		run.Position = position.String
+		run.Rating = rating.String
+		run.Distance = distance.String
+		run.Racecourse = racecourse.String
+		run.Going = going.String
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+// ResultOn returns how a horse finished in its run on date. The result is
+// empty if it did not run that day.
+func (r *FormRepo) ResultOn(ctx context.Context, selectionID int, date string) (models.WinLose, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT 	selection_id,
+				selection_name,
+				race_date,
+				SUBSTR(position, 1, INSTR(position, '/') - 1) as postion
+		FROM SelectionsForm
+		WHERE DATE(race_date) = ? and selection_id = ?`, date, selectionID)
+	if err != nil {
+		return models.WinLose{}, err
+	}
+	defer rows.Close()
+
+	var data models.WinLose
+	for rows.Next() {
+		var selectionName, raceDate, position sql.NullString
+		if err := rows.Scan(&data.SelectionID, &selectionName, &raceDate, &position); err != nil {
+			return models.WinLose{}, err
+		}
+		data.SelectionName = selectionName.String
+		data.EventDate = raceDate.String
+		data.Position = position.String
+	}
+
+	return data, rows.Err()
+}
+
+// Racecourses returns every course found in the stored form.
+func (r *FormRepo) Racecourses(ctx context.Context) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT DISTINCT racecourse FROM SelectionsForm WHERE racecourse IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	courses := []string{}
+	for rows.Next() {
+		var course string
+		if err := rows.Scan(&course); err != nil {
+			return nil, err
+		}
+		courses = append(courses, course)
+	}
+
+	return courses, rows.Err()
+}
+
+// LastRunDate returns the date of a horse's latest stored run. ok is false
+// if none is stored.
+func (r *FormRepo) LastRunDate(ctx context.Context, selectionID int) (date time.Time, ok bool, err error) {
+	var raceDate sql.NullTime
+	err = r.db.QueryRowContext(ctx, `
+		SELECT race_date FROM SelectionsForm
+		WHERE selection_id = ?
+		ORDER BY race_date DESC
+		LIMIT 1`, selectionID).Scan(&raceDate)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return raceDate.Time, true, nil
+}
+
+// Insert stores new runs of a horse in one transaction, then refreshes its
+// stored features from the earliest of them on.
+func (r *FormRepo) Insert(ctx context.Context, selectionID int, selectionName string, runs []models.SelectionsForm) error {
+	if len(runs) == 0 {
+		return nil
+	}
+
+	since := runs[0].RaceDate
+	for _, run := range runs {
+		if run.RaceDate.Before(since) {
+			since = run.RaceDate
+		}
+	}
+
+	err := r.writer.Do(ctx, func(ctx context.Context, db *sql.DB) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		now := time.Now()
+		for _, run := range runs {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO SelectionsForm (
+					selection_name,
+					selection_id,
+					race_class,
+					race_date,
+					position,
+					rating,
+					race_type,
+					racecourse,
+					distance,
+					going,
+					sp_odds,
+					Age,
+					Trainer,
+					Sex,
+					Sire,
+					Dam,
+					Owner,
+					created_at,
+					updated_at
+				)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				selectionName, selectionID, run.RaceClass, run.RaceDate, run.Position,
+				run.Rating, run.RaceType, run.Racecourse,
+				run.Distance, run.Going,
+				run.SPOdds, run.Age, run.Trainer,
+				run.Sex, run.Sire, run.Dam, run.Owner,
+				now,
+				now)
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.features.Refresh(ctx, selectionID, since)
+}
+
+// UpdateProfile copies a horse's age, trainer, sex, sire, dam and owner
+// from profile onto its stored runs and features.
+func (r *FormRepo) UpdateProfile(ctx context.Context, selectionID int, profile models.SelectionsForm) error {
+	err := r.writer.Do(ctx, func(ctx context.Context, db *sql.DB) error {
+		_, err := db.ExecContext(ctx, `
+			UPDATE SelectionsForm
+			SET Age = ?,
+				Trainer = ?,
+				Sex = ?,
+				Sire = ?,
+				Dam = ?,
+				Owner = ?
+			WHERE selection_id = ?`,
+			profile.Age, profile.Trainer, profile.Sex, profile.Sire, profile.Dam, profile.Owner, selectionID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.features.UpdateProfile(ctx, selectionID, profile.Age, profile.Trainer, profile.Sex, profile.Sire, profile.Dam, profile.Owner)
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestFormRepoInsertAndSummary(t *testing.T) {
+	ctx := context.Background()
+	_, repos := newTestRepos(t)
+	form := repos.Form
+
+	if _, ok, err := form.LastRunDate(ctx, 7); err != nil || ok {
+		t.Fatalf("LastRunDate before any run = %v, %v; want not ok", ok, err)
+	}
+
+	runs := []models.SelectionsForm{
+		{RaceDate: date("2024-05-01"), Position: "3/10", Racecourse: "Ascot", Distance: "1m", Going: "Good", Rating: "70"},
+		{RaceDate: date("2024-05-20"), Position: "1/8", Racecourse: "Ascot", Distance: "1m", Going: "Soft", Rating: "74"},
+		{RaceDate: date("2024-06-10"), Position: "2/9", Racecourse: "York", Distance: "1m2f", Going: "Good", Rating: "76"},
+	}
+	if err := form.Insert(ctx, 7, "Charlie", runs); err != nil {
+		t.Fatal(err)
+	}
+
+	last, ok, err := form.LastRunDate(ctx, 7)
+	if err != nil || !ok || !last.Equal(date("2024-06-10")) {
+		t.Fatalf("LastRunDate = %v, %v, %v; want 2024-06-10", last, ok, err)
+	}
+
+	// Going into a race on the day of the last run, that run does not count
+	data, err := form.Summary(ctx, 7, date("2024-06-10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.SelectionName != "Charlie" || data.NumRuns != 2 || data.WinCount != 1 {
+		t.Fatalf("Summary = %s, %d runs, %d wins; want Charlie, 2 runs, 1 win", data.SelectionName, data.NumRuns, data.WinCount)
+	}
+	if data.Position != "1/8" {
+		t.Errorf("latest position = %q, want 1/8", data.Position)
+	}
+	if data.RecoveryDays != 21 {
+		t.Errorf("RecoveryDays = %v, want 21", data.RecoveryDays)
+	}
+
+	all, err := form.Summary(ctx, 7, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all.NumRuns != 3 {
+		t.Errorf("Summary with no as-of date counts %d runs, want 3", all.NumRuns)
+	}
+
+	none, err := form.Summary(ctx, 7, date("2024-05-01"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if none.SelectionID != 0 {
+		t.Errorf("Summary before the first run = %+v, want empty", none)
+	}
+}
+
+func TestFormRepoUpdateProfile(t *testing.T) {
+	ctx := context.Background()
+	_, repos := newTestRepos(t)
+	form := repos.Form
+
+	runs := []models.SelectionsForm{{RaceDate: date("2024-05-01"), Position: "1/6", Trainer: "Old"}}
+	if err := form.Insert(ctx, 9, "Delta", runs); err != nil {
+		t.Fatal(err)
+	}
+	if err := form.UpdateProfile(ctx, 9, models.SelectionsForm{Age: "5", Trainer: "New", Sire: "Frankel"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := form.Summary(ctx, 9, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Trainer != "New" || data.Age != "5" || data.Sire != "Frankel" {
+		t.Fatalf("profile = %s, %s, %s; want New, 5, Frankel", data.Trainer, data.Age, data.Sire)
+	}
+}
+
+// Form saved before the feature store existed has no RunnerFeatures rows
+// until it is backfilled; Summary reads it the same way meanwhile.
+func TestFormRepoSummaryWithoutStoredFeatures(t *testing.T) {
+	ctx := context.Background()
+	db, repos := newTestRepos(t)
+
+	runs := []models.SelectionsForm{
+		{RaceDate: date("2024-05-01"), Position: "3/10", Racecourse: "Ascot", Distance: "1m", Going: "Good", Rating: "70"},
+		{RaceDate: date("2024-05-20"), Position: "1/8", Racecourse: "Ascot", Distance: "1m", Going: "Soft", Rating: "74"},
+	}
+	if err := repos.Form.Insert(ctx, 7, "Charlie", runs); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := map[string]models.AnalysisData{}
+	for _, asOf := range []string{"2024-05-10", "2024-06-01"} {
+		data, err := repos.Form.Summary(ctx, 7, date(asOf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored[asOf] = data
+	}
+	if stale, err := repos.Features.Stale(ctx); err != nil || len(stale) != 0 {
+		t.Fatalf("Stale after Insert = %v, %v; want none", stale, err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM RunnerFeatures`); err != nil {
+		t.Fatal(err)
+	}
+	missing, err := repos.Features.Stale(ctx)
+	if err != nil || len(missing) != 1 || missing[0] != 7 {
+		t.Fatalf("Stale = %v, %v; want [7]", missing, err)
+	}
+
+	for asOf, want := range stored {
+		got, err := repos.Form.Summary(ctx, 7, date(asOf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.SelectionName != want.SelectionName || got.NumRuns != want.NumRuns || got.WinCount != want.WinCount ||
+			got.AvgPosition != want.AvgPosition || got.RecoveryDays != want.RecoveryDays || got.AllPositions != want.AllPositions {
+			t.Errorf("Summary at %s without stored features = %+v, want %+v", asOf, got, want)
+		}
+	}
+
+	none, err := repos.Form.Summary(ctx, 7, date("2024-05-01"))
+	if err != nil || none.SelectionID != 0 {
+		t.Errorf("Summary before the first run = %+v, %v; want empty", none, err)
+	}
+
+	if err := repos.Features.Refresh(ctx, 7, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if stale, err := repos.Features.Stale(ctx); err != nil || len(stale) != 0 {
+		t.Errorf("Stale after Refresh = %v, %v; want none", stale, err)
+	}
+}
+
+// Rows stored before the going columns existed have empty going lists and
+// are refreshed too.
+func TestFeatureRepoStaleGoing(t *testing.T) {
+	ctx := context.Background()
+	db, repos := newTestRepos(t)
+
+	runs := []models.SelectionsForm{
+		{RaceDate: date("2024-05-01"), Position: "3/10", Going: "Good"},
+		{RaceDate: date("2024-05-20"), Position: "1/8", Going: "Soft"},
+	}
+	if err := repos.Form.Insert(ctx, 7, "Charlie", runs); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Form.Insert(ctx, 8, "Delta", runs[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE RunnerFeatures SET goings = '[]', going_records = '{}' WHERE selection_id = 7`); err != nil {
+		t.Fatal(err)
+	}
+
+	stale, err := repos.Features.Stale(ctx)
+	if err != nil || len(stale) != 1 || stale[0] != 7 {
+		t.Fatalf("Stale = %v, %v; want [7]", stale, err)
+	}
+
+	if err := repos.Features.Refresh(ctx, 7, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	f, ok, err := repos.Features.At(ctx, 7, time.Time{})
+	if err != nil || !ok {
+		t.Fatalf("At = %v, %v", ok, err)
+	}
+	if len(f.Goings) != 2 || f.GoingRecords["Soft"].Wins != 1 {
+		t.Errorf("refreshed goings = %v, records %v; want 2 goings and a win on Soft", f.Goings, f.GoingRecords)
+	}
+	if stale, err := repos.Features.Stale(ctx); err != nil || len(stale) != 0 {
+		t.Errorf("Stale after Refresh = %v, %v; want none", stale, err)
+	}
+}
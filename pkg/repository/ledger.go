@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// Ways the ledger's profit can be totalled.
+const (
+	ByDay      = "day"
+	ByWeek     = "week"
+	ByStrategy = "strategy"
+)
+
+// periods maps each grouping to the SQL for its period.
+var periods = map[string]string{
+	ByDay:      `event_date`,
+	ByWeek:     `strftime('%Y-W%W', event_date)`,
+	ByStrategy: `''`,
+}
+
+// LedgerRepo stores settled picks and totals their profit.
+type LedgerRepo struct {
+	db     *sql.DB
+	writer *database.Writer
+}
+
+func NewLedgerRepo(db *sql.DB, writer *database.Writer) *LedgerRepo {
+	return &LedgerRepo{db: db, writer: writer}
+}
+
+// Pending returns the picks of the current prediction runs for races on or
+// before through (YYYY-MM-DD) that have no ledger entry for their strategy,
+// oldest race first and best scored first within a race.
+func (r *LedgerRepo) Pending(ctx context.Context, through string) ([]models.Pick, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT 	rs.id,
+				rs.selection_id,
+				rs.selection_name,
+				rs.event_name,
+				DATE(rs.event_date),
+				rs.event_time,
+				rs.odds,
+				rs.clean_bet_score,
+				rs.win_probability,
+				rs.run_count,
+				rs.model,
+				rs.model_version,
+				rs.strategy
+		FROM RaceStatistics rs
+		LEFT JOIN Ledger l
+			ON l.strategy = rs.strategy
+			AND l.event_date = DATE(rs.event_date)
+			AND l.event_name = rs.event_name
+			AND l.event_time = rs.event_time
+			AND l.selection_id = rs.selection_id
+		WHERE l.id IS NULL AND DATE(rs.event_date) <= ? AND `+currentRun("rs")+`
+		ORDER BY DATE(rs.event_date), rs.event_time, rs.event_name, rs.clean_bet_score DESC`, through)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	picks := []models.Pick{}
+	for rows.Next() {
+		var pick models.Pick
+		var selectionName, eventName, eventTime, odds sql.NullString
+		var score, probability sql.NullFloat64
+		if err := rows.Scan(
+			&pick.ID,
+			&pick.SelectionID,
+			&selectionName,
+			&eventName,
+			&pick.EventDate,
+			&eventTime,
+			&odds,
+			&score,
+			&probability,
+			&pick.RunCount,
+			&pick.Model,
+			&pick.ModelVersion,
+			&pick.Strategy,
+		); err != nil {
+			return nil, err
+		}
+		pick.SelectionName = selectionName.String
+		pick.EventName = eventName.String
+		pick.EventTime = eventTime.String
+		pick.Odds = odds.String
+		pick.TotalScore = score.Float64
+		pick.WinProbability = probability.Float64
+		picks = append(picks, pick)
+	}
+
+	return picks, rows.Err()
+}
+
+// Balance returns the balance after the strategy's last entry. ok is false
+// if nothing has been settled for it.
+func (r *LedgerRepo) Balance(ctx context.Context, strategy string) (balance float64, ok bool, err error) {
+	err = r.db.QueryRowContext(ctx, `SELECT balance FROM Ledger WHERE strategy = ? ORDER BY id DESC LIMIT 1`, strategy).
+		Scan(&balance)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return balance, err == nil, err
+}
+
+// Insert adds entries to the ledger in one transaction.
+func (r *LedgerRepo) Insert(ctx context.Context, entries []models.LedgerEntry) error {
+	release, err := r.writer.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO Ledger (strategy, model, model_version, event_date, event_name, event_time, selection_id, selection_name,
+			position, won, price_source, odds, stake, return, profit, balance, settled_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range entries {
+		_, err = stmt.ExecContext(ctx, e.Strategy, e.Model, e.ModelVersion, e.EventDate, e.EventName, e.EventTime, e.SelectionID, e.SelectionName,
+			e.Position, e.Won, e.PriceSource, e.Odds, e.Stake, e.Return, e.Profit, e.Balance, e.SettledAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Entries returns the ledger between from and to inclusive (YYYY-MM-DD), in
+// the order it was settled. An empty strategy returns every strategy.
+func (r *LedgerRepo) Entries(ctx context.Context, from, to, strategy string) ([]models.LedgerEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, strategy, model, model_version, event_date, event_name, event_time, selection_id, selection_name,
+			position, won, price_source, odds, stake, return, profit, balance, settled_at
+		FROM Ledger
+		WHERE event_date BETWEEN ? AND ? AND (? = '' OR strategy = ?)
+		ORDER BY id`, from, to, strategy, strategy)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.LedgerEntry{}
+	for rows.Next() {
+		var e models.LedgerEntry
+		var selectionName, position sql.NullString
+		if err := rows.Scan(&e.ID, &e.Strategy, &e.Model, &e.ModelVersion, &e.EventDate, &e.EventName, &e.EventTime, &e.SelectionID, &selectionName,
+			&position, &e.Won, &e.PriceSource, &e.Odds, &e.Stake, &e.Return, &e.Profit, &e.Balance, &e.SettledAt); err != nil {
+			return nil, err
+		}
+		e.SelectionName = selectionName.String
+		e.Position = position.String
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// Profit totals the ledger between from and to inclusive by strategy and,
+// unless groupBy is ByStrategy, by day or week.
+func (r *LedgerRepo) Profit(ctx context.Context, groupBy, from, to, strategy string) ([]models.ProfitSummary, error) {
+	period, ok := periods[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("ledger: cannot group by %q", groupBy)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT 	`+period+` AS period,
+				strategy,
+				COUNT(*),
+				SUM(won),
+				SUM(stake),
+				SUM(return),
+				SUM(profit)
+		FROM Ledger
+		WHERE event_date BETWEEN ? AND ? AND (? = '' OR strategy = ?) AND stake > 0
+		GROUP BY period, strategy
+		ORDER BY period, strategy`, from, to, strategy, strategy)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []models.ProfitSummary{}
+	for rows.Next() {
+		var s models.ProfitSummary
+		if err := rows.Scan(&s.Period, &s.Strategy, &s.Bets, &s.Winners, &s.Staked, &s.Returned, &s.Profit); err != nil {
+			return nil, err
+		}
+		if s.Staked > 0 {
+			s.ROI = s.Profit / s.Staked
+		}
+		summaries = append(summaries, s)
+	}
+
+	return summaries, rows.Err()
+}
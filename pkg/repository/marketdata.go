@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// MarketDataRepo stores the Betfair price files loaded into MarketData.
+type MarketDataRepo struct {
+	db     *sql.DB
+	writer *database.Writer
+}
+
+func NewMarketDataRepo(db *sql.DB, writer *database.Writer) *MarketDataRepo {
+	return &MarketDataRepo{db: db, writer: writer}
+}
+
+// Insert stores rows in one transaction.
+func (r *MarketDataRepo) Insert(ctx context.Context, rows []models.MarketData) error {
+	release, err := r.writer.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO MarketData (
+			event_id,
+			menu_hint,
+			event_name,
+			event_dt,
+			selection_id,
+			selection_name,
+			win_lose,
+			bsp,
+			ppwap,
+			morning_wap,
+			ppmax,
+			ppmin,
+			ipmax,
+			ipmin,
+			morning_traded_vol,
+			pp_traded_vol,
+			ip_traded_vol,
+			created_at,
+			updated_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	for _, row := range rows {
+		_, err = stmt.ExecContext(ctx,
+			row.EventID,
+			row.MenuHint,
+			row.EventName,
+			row.EventDT,
+			row.SelectionID,
+			row.SelectionName,
+			row.WinLose,
+			row.BSP,
+			row.PPWAP,
+			row.MorningWAP,
+			row.PPMax,
+			row.PPMin,
+			row.IPMax,
+			row.IPMin,
+			row.MorningTradedVol,
+			row.PPTradedVol,
+			row.IPTradedVol,
+			now,
+			now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ByDate returns the rows of the races run on date (YYYY-MM-DD). Betfair
+// writes event_dt as DD-MM-YYYY HH:MM.
+func (r *MarketDataRepo) ByDate(ctx context.Context, date string) ([]models.MarketData, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT 	id,
+				event_id,
+				menu_hint,
+				event_name,
+				event_dt,
+				selection_id,
+				selection_name,
+				win_lose,
+				bsp
+		FROM MarketData
+		WHERE substr(event_dt, 7, 4) || '-' || substr(event_dt, 4, 2) || '-' || substr(event_dt, 1, 2) = ?`, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	markets := []models.MarketData{}
+	for rows.Next() {
+		var market models.MarketData
+		var eventID, selectionID sql.NullInt64
+		var menuHint, eventName, eventDT, selectionName, winLose sql.NullString
+		var bsp sql.NullFloat64
+		if err := rows.Scan(
+			&market.ID,
+			&eventID,
+			&menuHint,
+			&eventName,
+			&eventDT,
+			&selectionID,
+			&selectionName,
+			&winLose,
+			&bsp,
+		); err != nil {
+			return nil, err
+		}
+		market.EventID = int(eventID.Int64)
+		market.MenuHint = menuHint.String
+		market.EventName = eventName.String
+		market.EventDT = eventDT.String
+		market.SelectionID = int(selectionID.Int64)
+		market.SelectionName = selectionName.String
+		market.WinLose = winLose.String
+		market.BSP = bsp.Float64
+		markets = append(markets, market)
+	}
+
+	return markets, rows.Err()
+}
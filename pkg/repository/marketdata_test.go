@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+func TestMarketDataRepoStoresEveryRunnerOfARace(t *testing.T) {
+	ctx := context.Background()
+	_, repos := newTestRepos(t)
+	markets := repos.MarketData
+
+	rows := []models.MarketData{
+		{EventID: 100, EventName: "1m Hcap", EventDT: "01-06-2024 14:00", SelectionID: 1, SelectionName: "Alpha", WinLose: "1", BSP: 3.5},
+		{EventID: 100, EventName: "1m Hcap", EventDT: "01-06-2024 14:00", SelectionID: 2, SelectionName: "Bravo", WinLose: "0", BSP: 6},
+	}
+	if err := markets.Insert(ctx, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := markets.ByDate(ctx, "2024-06-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("ByDate returned %d rows, want 2", len(got))
+	}
+	for _, market := range got {
+		if market.EventID != 100 || market.ID == 0 {
+			t.Errorf("row %+v: want its own id and event_id 100", market)
+		}
+	}
+}
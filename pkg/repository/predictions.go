@@ -0,0 +1,345 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// PredictionRepo stores the picks written to RaceStatistics and the tuned
+// parameters the scoring reads from OptimalParameters.
+type PredictionRepo struct {
+	db     *sql.DB
+	writer *database.Writer
+}
+
+func NewPredictionRepo(db *sql.DB, writer *database.Writer) *PredictionRepo {
+	return &PredictionRepo{db: db, writer: writer}
+}
+
+// currentRun is the SQL condition that keeps the RaceStatistics rows,
+// aliased t, of the current run of their date, model and strategy: the last
+// one published, or the latest if none has been. Picks stored before runs
+// existed count while their date, model and strategy have no run.
+func currentRun(t string) string {
+	run := `FROM PredictionRuns pr WHERE pr.event_date = DATE(` + t + `.event_date) AND pr.model = ` + t + `.model AND pr.strategy = ` + t + `.strategy`
+	return `(
+		(` + t + `.run_id IS NULL AND NOT EXISTS (SELECT 1 ` + run + `))
+		OR ` + t + `.run_id = (SELECT pr.id ` + run + `
+			ORDER BY pr.published_at IS NULL, pr.published_at DESC, pr.id DESC
+			LIMIT 1))`
+}
+
+// SaveRun stores run and the picks it made, in one transaction, and
+// returns the run with its ID. Earlier runs are kept.
+func (r *PredictionRepo) SaveRun(ctx context.Context, run models.PredictionRun, results []models.SelectionResult) (models.PredictionRun, error) {
+	release, err := r.writer.Acquire(ctx)
+	if err != nil {
+		return models.PredictionRun{}, err
+	}
+	defer release()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.PredictionRun{}, err
+	}
+	defer tx.Rollback()
+
+	run.CreatedAt = time.Now()
+	run.Picks = len(results)
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO PredictionRuns (event_date, model, model_version, strategy, parameters, input_hash, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		run.EventDate, run.Model, run.ModelVersion, run.Strategy, string(run.Parameters), run.InputHash, run.CreatedAt)
+	if err != nil {
+		return models.PredictionRun{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.PredictionRun{}, err
+	}
+	run.ID = int(id)
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO RaceStatistics (event_date, selection_id, selection_name, odds, clean_bet_score, average_position, average_rating, event_name, event_time, model, model_version, win_probability, fair_decimal_odds, run_count, run_id, strategy)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return models.PredictionRun{}, err
+	}
+	defer stmt.Close()
+
+	for _, data := range results {
+		_, err = stmt.ExecContext(ctx, data.EventDate, data.SelectionID, data.SelectionName, data.Odds, data.TotalScore, data.AvgPosition, data.AvgRating, data.EventName, data.EventTime, run.Model, data.ModelVersion, data.WinProbability, data.FairDecimalOdds, data.RunCount, run.ID, run.Strategy)
+		if err != nil {
+			return models.PredictionRun{}, err
+		}
+	}
+
+	return run, tx.Commit()
+}
+
+// ForDate returns the picks of the current run of model and strategy for
+// date. An empty model or strategy returns the current picks of every one.
+func (r *PredictionRepo) ForDate(ctx context.Context, date, model, strategy string) ([]models.SelectionResult, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+pickColumns+`
+		FROM RaceStatistics rs
+		WHERE DATE(rs.event_date) = ? AND (? = '' OR rs.model = ?) AND (? = '' OR rs.strategy = ?) AND `+currentRun("rs"),
+		date, model, model, strategy, strategy)
+	if err != nil {
+		return nil, err
+	}
+	return scanPicks(rows)
+}
+
+// ForRun returns the picks of a run.
+func (r *PredictionRepo) ForRun(ctx context.Context, runID int) ([]models.SelectionResult, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+pickColumns+`
+		FROM RaceStatistics WHERE run_id = ?
+		ORDER BY event_time, event_name, clean_bet_score DESC`, runID)
+	if err != nil {
+		return nil, err
+	}
+	return scanPicks(rows)
+}
+
+// Runs returns the runs for date, newest first. An empty model or
+// strategy returns the runs of every one.
+func (r *PredictionRepo) Runs(ctx context.Context, date, model, strategy string) ([]models.PredictionRun, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+runColumns+`
+		FROM PredictionRuns pr
+		WHERE pr.event_date = ? AND (? = '' OR pr.model = ?) AND (? = '' OR pr.strategy = ?)
+		ORDER BY pr.id DESC`, date, model, model, strategy, strategy)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []models.PredictionRun{}
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// Run returns a run by ID. ok is false if there is none.
+func (r *PredictionRepo) Run(ctx context.Context, id int) (run models.PredictionRun, ok bool, err error) {
+	run, err = scanRun(r.db.QueryRowContext(ctx, `
+		SELECT `+runColumns+`
+		FROM PredictionRuns pr
+		WHERE pr.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return models.PredictionRun{}, false, nil
+	}
+	return run, err == nil, err
+}
+
+// Publish marks a run as published, which makes it the current run of its
+// date, model and strategy. ok is false if there is no such run.
+func (r *PredictionRepo) Publish(ctx context.Context, id int) (ok bool, err error) {
+	release, err := r.writer.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	res, err := r.db.ExecContext(ctx, `UPDATE PredictionRuns SET published_at = ? WHERE id = ?`, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+const runColumns = `
+	pr.id,
+	pr.event_date,
+	pr.model,
+	pr.model_version,
+	pr.strategy,
+	pr.parameters,
+	pr.input_hash,
+	pr.created_at,
+	pr.published_at,
+	(SELECT COUNT(*) FROM RaceStatistics rs WHERE rs.run_id = pr.id)`
+
+func scanRun(row interface{ Scan(...interface{}) error }) (models.PredictionRun, error) {
+	var run models.PredictionRun
+	var parameters string
+	var publishedAt sql.NullTime
+	if err := row.Scan(&run.ID, &run.EventDate, &run.Model, &run.ModelVersion, &run.Strategy, &parameters, &run.InputHash, &run.CreatedAt, &publishedAt, &run.Picks); err != nil {
+		return models.PredictionRun{}, err
+	}
+	run.Parameters = []byte(parameters)
+	if publishedAt.Valid {
+		run.PublishedAt = &publishedAt.Time
+	}
+	return run, nil
+}
+
+const pickColumns = `
+	selection_id,
+	clean_bet_score,
+	average_position,
+	average_rating,
+	event_name,
+	event_date,
+	event_time,
+	selection_name,
+	odds,
+	model,
+	model_version,
+	strategy,
+	win_probability,
+	fair_decimal_odds,
+	run_count`
+
+func scanPicks(rows *sql.Rows) ([]models.SelectionResult, error) {
+	defer rows.Close()
+
+	results := []models.SelectionResult{}
+	for rows.Next() {
+		var result models.SelectionResult
+		var totalScore, avgPosition, avgRating, winProbability, fairOdds sql.NullFloat64
+		var eventName, eventDate, eventTime, selectionName, odds sql.NullString
+		if err := rows.Scan(
+			&result.SelectionID,
+			&totalScore,
+			&avgPosition,
+			&avgRating,
+			&eventName,
+			&eventDate,
+			&eventTime,
+			&selectionName,
+			&odds,
+			&result.Model,
+			&result.ModelVersion,
+			&result.Strategy,
+			&winProbability,
+			&fairOdds,
+			&result.RunCount,
+		); err != nil {
+			return nil, err
+		}
+		result.TotalScore = totalScore.Float64
+		result.AvgPosition = avgPosition.Float64
+		result.AvgRating = avgRating.Float64
+		result.WinProbability = winProbability.Float64
+		result.FairDecimalOdds = fairOdds.Float64
+		result.EventName = eventName.String
+		result.EventDate = eventDate.String
+		result.EventTime = eventTime.String
+		result.SelectionName = selectionName.String
+		result.Odds = odds.String
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// OptimalParameters returns the parameters tuned for raceType. They are
+// zero if none have been stored.
+func (r *PredictionRepo) OptimalParameters(ctx context.Context, raceType string) (models.OptimalParameters, error) {
+	var params models.OptimalParameters
+	var weights, objective sql.NullString
+	var trainScore, testScore sql.NullFloat64
+	var optimisedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		SELECT 	id,
+				race_type,
+				optimal_num_runs,
+				optimal_num_years_in_competition,
+				optimal_num_wins,
+				optimal_rating,
+				optimal_position,
+				optimal_distance,
+				weights,
+				objective,
+				train_score,
+				test_score,
+				optimised_at
+			FROM OptimalParameters
+			WHERE race_type = ?
+			ORDER BY id DESC
+			LIMIT 1`, raceType).
+		Scan(
+			&params.ID,
+			&params.RaceType,
+			&params.OptimalNumRuns,
+			&params.OptimalNumYearsInCompetition,
+			&params.OptimalNumWins,
+			&params.OptimalRating,
+			&params.OptimalPosition,
+			&params.OptimalDistance,
+			&weights,
+			&objective,
+			&trainScore,
+			&testScore,
+			&optimisedAt,
+		)
+	if err == sql.ErrNoRows {
+		return models.OptimalParameters{}, nil
+	}
+	if err != nil {
+		return models.OptimalParameters{}, err
+	}
+
+	if weights.Valid {
+		params.Weights = &models.ScoringWeights{}
+		if err := json.Unmarshal([]byte(weights.String), params.Weights); err != nil {
+			return models.OptimalParameters{}, err
+		}
+	}
+	params.Objective = objective.String
+	params.TrainScore = trainScore.Float64
+	params.TestScore = testScore.Float64
+	if optimisedAt.Valid {
+		params.OptimisedAt = &optimisedAt.Time
+	}
+	return params, nil
+}
+
+// SaveOptimalParameters stores params as the latest for their race type
+// and returns them with their ID.
+func (r *PredictionRepo) SaveOptimalParameters(ctx context.Context, params models.OptimalParameters) (models.OptimalParameters, error) {
+	release, err := r.writer.Acquire(ctx)
+	if err != nil {
+		return models.OptimalParameters{}, err
+	}
+	defer release()
+
+	var weights sql.NullString
+	if params.Weights != nil {
+		encoded, err := json.Marshal(params.Weights)
+		if err != nil {
+			return models.OptimalParameters{}, err
+		}
+		weights = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO OptimalParameters (race_type, optimal_num_runs, optimal_num_years_in_competition, optimal_num_wins,
+			optimal_rating, optimal_position, optimal_distance, weights, objective, train_score, test_score, optimised_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		params.RaceType, params.OptimalNumRuns, params.OptimalNumYearsInCompetition, params.OptimalNumWins,
+		params.OptimalRating, params.OptimalPosition, params.OptimalDistance, weights, params.Objective, params.TrainScore, params.TestScore, params.OptimisedAt)
+	if err != nil {
+		return models.OptimalParameters{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.OptimalParameters{}, err
+	}
+	params.ID = int(id)
+	return params, nil
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+func TestPredictionRepoCurrentRunPerStrategy(t *testing.T) {
+	ctx := context.Background()
+	_, repos := newTestRepos(t)
+	predictions := repos.Predictions
+
+	save := func(strategy string, picks ...string) models.PredictionRun {
+		t.Helper()
+		var results []models.SelectionResult
+		for i, name := range picks {
+			results = append(results, models.SelectionResult{SelectionID: i + 1, SelectionName: name, EventName: "Ascot", EventDate: "2024-06-01", EventTime: "14:00"})
+		}
+		run, err := predictions.SaveRun(ctx, models.PredictionRun{EventDate: "2024-06-01", Model: "heuristic", Strategy: strategy, Parameters: []byte("{}")}, results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return run
+	}
+	names := func(strategy string) []string {
+		t.Helper()
+		picks, err := predictions.ForDate(ctx, "2024-06-01", "heuristic", strategy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, pick := range picks {
+			if strategy != "" && pick.Strategy != strategy {
+				t.Errorf("ForDate(%q) returned a pick of %q", strategy, pick.Strategy)
+			}
+			got = append(got, pick.SelectionName)
+		}
+		return got
+	}
+
+	first := save("default", "Alpha")
+	save("default", "Bravo")
+	save("longshots", "Charlie")
+
+	tests := []struct {
+		strategy string
+		want     []string
+	}{
+		// The latest run of each strategy is current while none is published
+		{"default", []string{"Bravo"}},
+		{"longshots", []string{"Charlie"}},
+		{"", []string{"Bravo", "Charlie"}},
+	}
+	for _, tt := range tests {
+		if got := names(tt.strategy); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ForDate(%q) = %v, want %v", tt.strategy, got, tt.want)
+		}
+	}
+
+	// Publishing a default run leaves the other strategy's current run alone
+	if _, err := predictions.Publish(ctx, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(""), []string{"Alpha", "Charlie"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ForDate after Publish = %v, want %v", got, want)
+	}
+
+	runs, err := predictions.Runs(ctx, "2024-06-01", "", "longshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Strategy != "longshots" || runs[0].Picks != 1 {
+		t.Errorf("Runs(longshots) = %+v, want its one run", runs)
+	}
+}
@@ -0,0 +1,41 @@
+// Package repository holds the SQL behind the API. Each repository wraps one
+// area of the schema and returns the types in pkg/models, so handlers and
+// prediction code can be run against any *sql.DB, including an in-memory one.
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+)
+
+// Repositories bundles every repository built on one database.
+type Repositories struct {
+	Runners      *RunnerRepo
+	Form         *FormRepo
+	Features     *FeatureRepo
+	Predictions  *PredictionRepo
+	MarketData   *MarketDataRepo
+	Weights      *WeightsRepo
+	Calibrations *CalibrationRepo
+	Ledger       *LedgerRepo
+	Strategies   *StrategyRepo
+	Scoring      *ScoringProfileRepo
+}
+
+// New returns the repositories backed by db. Their writes go through
+// writer, which must be the one shared by everything writing to db.
+func New(db *sql.DB, writer *database.Writer) Repositories {
+	return Repositories{
+		Runners:      NewRunnerRepo(db, writer),
+		Form:         NewFormRepo(db, writer),
+		Features:     NewFeatureRepo(db, writer),
+		Predictions:  NewPredictionRepo(db, writer),
+		MarketData:   NewMarketDataRepo(db, writer),
+		Weights:      NewWeightsRepo(db, writer),
+		Calibrations: NewCalibrationRepo(db, writer),
+		Ledger:       NewLedgerRepo(db, writer),
+		Strategies:   NewStrategyRepo(db, writer),
+		Scoring:      NewScoringProfileRepo(db, writer),
+	}
+}
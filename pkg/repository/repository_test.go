@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+)
+
+// newTestDB returns a migrated in-memory database private to the test.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := sql.Open("sqlite3", "file:"+name+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newTestRepos returns the repositories of a database from newTestDB.
+func newTestRepos(t *testing.T) (*sql.DB, Repositories) {
+	t.Helper()
+
+	db := newTestDB(t)
+	return db, New(db, database.NewWriter(db))
+}
@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// RunnerRepo reads and stores the runners declared in EventRunners.
+type RunnerRepo struct {
+	db     *sql.DB
+	writer *database.Writer
+}
+
+func NewRunnerRepo(db *sql.DB, writer *database.Writer) *RunnerRepo {
+	return &RunnerRepo{db: db, writer: writer}
+}
+
+const runnerColumns = `
+	selection_id,
+	selection_name,
+	event_name,
+	event_date,
+	event_time,
+	price,
+	race_distance,
+	race_category,
+	track_condition,
+	number_of_runners,
+	race_track,
+	race_class`
+
+// ByDate returns every runner declared for date (YYYY-MM-DD).
+func (r *RunnerRepo) ByDate(ctx context.Context, date string) ([]models.Runner, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+runnerColumns+`
+		FROM EventRunners
+		WHERE DATE(event_date) = ?`,
+		date)
+	if err != nil {
+		return nil, err
+	}
+	return scanRunners(rows)
+}
+
+// ByRace returns the runners of one race.
+func (r *RunnerRepo) ByRace(ctx context.Context, date, eventName, eventTime string) ([]models.Runner, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+runnerColumns+`
+		FROM EventRunners
+		WHERE DATE(event_date) = ? AND event_name = ? AND event_time = ?`,
+		date, eventName, eventTime)
+	if err != nil {
+		return nil, err
+	}
+	return scanRunners(rows)
+}
+
+// Meetings returns the courses racing on date with their race times joined
+// by commas.
+func (r *RunnerRepo) Meetings(ctx context.Context, date string) ([]models.Meeting, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT 	event_name,
+				GROUP_CONCAT(event_time ORDER BY event_time) AS event_times
+		FROM EventRunners WHERE DATE(event_date) = ? GROUP BY event_name ORDER BY event_name`,
+		date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	meetings := []models.Meeting{}
+	for rows.Next() {
+		var meeting models.Meeting
+		var eventName, eventTimes sql.NullString
+		if err := rows.Scan(&eventName, &eventTimes); err != nil {
+			return nil, err
+		}
+		meeting.EventName = eventName.String
+		meeting.EventTime = eventTimes.String
+		meetings = append(meetings, meeting)
+	}
+
+	return meetings, rows.Err()
+}
+
+func scanRunners(rows *sql.Rows) ([]models.Runner, error) {
+	defer rows.Close()
+
+	runners := []models.Runner{}
+	for rows.Next() {
+		var selectionID sql.NullInt64
+		var selectionName, eventName, eventDate, eventTime, odds, raceDistance, raceCategory, trackCondition, numberOfRunners, raceTrack, raceClass sql.NullString
+
+		if err := rows.Scan(
+			&selectionID,
+			&selectionName,
+			&eventName,
+			&eventDate,
+			&eventTime,
+			&odds,
+			&raceDistance,
+			&raceCategory,
+			&trackCondition,
+			&numberOfRunners,
+			&raceTrack,
+			&raceClass,
+		); err != nil {
+			return nil, err
+		}
+
+		runners = append(runners, models.Runner{
+			ID:              int(selectionID.Int64),
+			Name:            selectionName.String,
+			EventName:       eventName.String,
+			EventDate:       eventDate.String,
+			EventTime:       eventTime.String,
+			Odds:            odds.String,
+			RaceDistance:    raceDistance.String,
+			RaceCategory:    raceCategory.String,
+			TrackCondition:  trackCondition.String,
+			NumberOfRunners: numberOfRunners.String,
+			RaceTrack:       raceTrack.String,
+			RaceClass:       raceClass.String,
+		})
+	}
+
+	return runners, rows.Err()
+}
+
+// Pending returns the runners declared for date (YYYY-MM-DD) whose race
+// conditions have not been scraped yet.
+func (r *RunnerRepo) Pending(ctx context.Context, date string) ([]models.TodayRunners, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, selection_name, selection_link, event_link, event_time, event_name, price, selection_id
+		FROM EventRunners
+		WHERE event_link NOT NULL AND race_distance IS NULL AND DATE(event_date) = ?`, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runners := []models.TodayRunners{}
+	for rows.Next() {
+		var name, selectionLink, eventLink, eventTime, eventName, price sql.NullString
+		var id, selectionID sql.NullInt64
+		if err := rows.Scan(&id, &name, &selectionLink, &eventLink, &eventTime, &eventName, &price, &selectionID); err != nil {
+			return nil, err
+		}
+		runners = append(runners, models.TodayRunners{
+			ID:            int(id.Int64),
+			SelectionName: name.String,
+			SelectionLink: selectionLink.String,
+			EventLink:     eventLink.String,
+			EventTime:     eventTime.String,
+			EventName:     eventName.String,
+			Price:         price.String,
+			SelectionID:   int(selectionID.Int64),
+		})
+	}
+
+	return runners, rows.Err()
+}
+
+// Save stores a runner with its race conditions. A runner with an ID, as
+// returned by Pending, has its row updated so it is no longer pending; any
+// other runner is inserted, dated now if it has no EventDate.
+func (r *RunnerRepo) Save(ctx context.Context, runner models.TodayRunners) error {
+	release, err := r.writer.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if runner.ID > 0 {
+		res, err := r.db.ExecContext(ctx, `
+			UPDATE EventRunners SET
+				race_distance = ?,
+				race_category = ?,
+				track_condition = ?,
+				number_of_runners = ?,
+				race_track = ?,
+				race_class = ?
+			WHERE id = ?`,
+			runner.RaceConditon.RaceDistance,
+			runner.RaceConditon.RaceCategory,
+			runner.RaceConditon.TrackCondition,
+			runner.RaceConditon.NumberOfRunners,
+			runner.RaceConditon.RaceTrack,
+			runner.RaceConditon.RaceClass,
+			runner.ID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n > 0 {
+			return err
+		}
+	}
+
+	now := time.Now()
+	eventDate := runner.EventDate
+	if eventDate.IsZero() {
+		eventDate = now
+	}
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO EventRunners (
+			selection_link,
+			selection_id,
+			event_link,
+			selection_name,
+			event_time,
+			event_name,
+			price,
+			event_date,
+			race_distance,
+			race_category,
+			track_condition,
+			number_of_runners,
+			race_track,
+			race_class,
+			created_at
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		runner.SelectionLink,
+		runner.SelectionID,
+		runner.EventLink,
+		runner.SelectionName,
+		runner.EventTime,
+		runner.EventName,
+		runner.Price,
+		eventDate,
+		runner.RaceConditon.RaceDistance,
+		runner.RaceConditon.RaceCategory,
+		runner.RaceConditon.TrackCondition,
+		runner.RaceConditon.NumberOfRunners,
+		runner.RaceConditon.RaceTrack,
+		runner.RaceConditon.RaceClass,
+		now)
+	return err
+}
+
+// Selections returns the horses declared for date (YYYY-MM-DD) with the
+// links to their profiles. An empty date returns every declared horse.
+func (r *RunnerRepo) Selections(ctx context.Context, date string) ([]models.Selection, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT selection_id, selection_link, selection_name
+		FROM EventRunners
+		WHERE ? = '' OR DATE(event_date) = ?`, date, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	selections := []models.Selection{}
+	for rows.Next() {
+		var id sql.NullInt64
+		var link, name sql.NullString
+		if err := rows.Scan(&id, &link, &name); err != nil {
+			return nil, err
+		}
+		selections = append(selections, models.Selection{ID: int(id.Int64), Link: link.String, Name: name.String})
+	}
+
+	return selections, rows.Err()
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+func TestRunnerRepoPendingInsertSelections(t *testing.T) {
+	ctx := context.Background()
+	db, repos := newTestRepos(t)
+	runners := repos.Runners
+
+	_, err := db.Exec(`
+		INSERT INTO EventRunners (selection_id, selection_name, selection_link, event_link, event_name, event_time, event_date)
+		VALUES
+			(1, 'Alpha', '/horse/1', '/race/10', 'Ascot', '14:00', '2024-06-01 00:00:00'),
+			(2, 'Bravo', '/horse/2', '/race/10', 'Ascot', '14:00', '2024-06-02 00:00:00')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := runners.Pending(ctx, "2024-06-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].SelectionID != 1 || pending[0].EventLink != "/race/10" {
+		t.Fatalf("Pending = %+v, want Alpha only", pending)
+	}
+
+	runner := pending[0]
+	runner.RaceConditon = models.RaceConditon{RaceDistance: "1m", TrackCondition: "Good", RaceTrack: "Turf"}
+	if err := runners.Save(ctx, runner); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err = runners.Pending(ctx, "2024-06-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("Pending after Save = %+v, want none", pending)
+	}
+	declared, err := runners.ByDate(ctx, "2024-06-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(declared) != 1 || declared[0].RaceDistance != "1m" || declared[0].TrackCondition != "Good" {
+		t.Fatalf("ByDate after Save = %+v, want Alpha updated in place", declared)
+	}
+
+	if err := runners.Save(ctx, models.TodayRunners{SelectionID: 3, SelectionName: "Charlie", SelectionLink: "/horse/3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	selections, err := runners.Selections(ctx, "2024-06-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selections) != 1 || selections[0].Name != "Bravo" || selections[0].Link != "/horse/2" {
+		t.Fatalf("Selections(2024-06-02) = %+v, want Bravo", selections)
+	}
+
+	all, err := runners.Selections(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("Selections() returned %d rows, want 3", len(all))
+	}
+}
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// ScoringProfileRepo stores the versions of the heuristic scorer's weights.
+type ScoringProfileRepo struct {
+	db     *sql.DB
+	writer *database.Writer
+}
+
+func NewScoringProfileRepo(db *sql.DB, writer *database.Writer) *ScoringProfileRepo {
+	return &ScoringProfileRepo{db: db, writer: writer}
+}
+
+// List returns every profile by name and version.
+func (r *ScoringProfileRepo) List(ctx context.Context) ([]models.ScoringProfile, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, name, version, weights, active, based_on, created_at
+		FROM ScoringProfiles
+		ORDER BY name, version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := []models.ScoringProfile{}
+	for rows.Next() {
+		p, err := scanScoringProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, rows.Err()
+}
+
+// Get returns a profile by ID. ok is false if there is none.
+func (r *ScoringProfileRepo) Get(ctx context.Context, id int) (profile models.ScoringProfile, ok bool, err error) {
+	profile, err = scanScoringProfile(r.db.QueryRowContext(ctx, `
+		SELECT id, name, version, weights, active, based_on, created_at
+		FROM ScoringProfiles
+		WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return models.ScoringProfile{}, false, nil
+	}
+	return profile, err == nil, err
+}
+
+// Active returns the active profile. ok is false if none is.
+func (r *ScoringProfileRepo) Active(ctx context.Context) (profile models.ScoringProfile, ok bool, err error) {
+	profile, err = scanScoringProfile(r.db.QueryRowContext(ctx, `
+		SELECT id, name, version, weights, active, based_on, created_at
+		FROM ScoringProfiles
+		WHERE active = 1
+		ORDER BY id DESC
+		LIMIT 1`))
+	if err == sql.ErrNoRows {
+		return models.ScoringProfile{}, false, nil
+	}
+	return profile, err == nil, err
+}
+
+// Save stores weights as the next version of the profile called name and
+// returns it. basedOn is the profile they came from, or 0.
+func (r *ScoringProfileRepo) Save(ctx context.Context, name string, weights models.ScoringWeights, basedOn int) (models.ScoringProfile, error) {
+	release, err := r.writer.Acquire(ctx)
+	if err != nil {
+		return models.ScoringProfile{}, err
+	}
+	defer release()
+
+	encoded, err := json.Marshal(weights)
+	if err != nil {
+		return models.ScoringProfile{}, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ScoringProfile{}, err
+	}
+	defer tx.Rollback()
+
+	profile := models.ScoringProfile{Name: name, Weights: weights, CreatedAt: time.Now()}
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) + 1 FROM ScoringProfiles WHERE name = ?`, name).
+		Scan(&profile.Version); err != nil {
+		return models.ScoringProfile{}, err
+	}
+
+	var parent sql.NullInt64
+	if basedOn > 0 {
+		parent = sql.NullInt64{Int64: int64(basedOn), Valid: true}
+		profile.BasedOn = &basedOn
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO ScoringProfiles (name, version, weights, active, based_on, created_at)
+		VALUES (?, ?, ?, 0, ?, ?)`,
+		name, profile.Version, string(encoded), parent, profile.CreatedAt)
+	if err != nil {
+		return models.ScoringProfile{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.ScoringProfile{}, err
+	}
+	profile.ID = int(id)
+
+	return profile, tx.Commit()
+}
+
+// Activate makes a profile the active one. ok is false if there is none.
+func (r *ScoringProfileRepo) Activate(ctx context.Context, id int) (ok bool, err error) {
+	release, err := r.writer.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var found int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM ScoringProfiles WHERE id = ?`, id).Scan(&found); err != nil {
+		return false, err
+	}
+	if found == 0 {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE ScoringProfiles SET active = (id = ?)`, id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func scanScoringProfile(row interface{ Scan(...interface{}) error }) (models.ScoringProfile, error) {
+	var p models.ScoringProfile
+	var weights string
+	var basedOn sql.NullInt64
+	if err := row.Scan(&p.ID, &p.Name, &p.Version, &weights, &p.Active, &basedOn, &p.CreatedAt); err != nil {
+		return models.ScoringProfile{}, err
+	}
+	if err := json.Unmarshal([]byte(weights), &p.Weights); err != nil {
+		return models.ScoringProfile{}, err
+	}
+	if basedOn.Valid {
+		id := int(basedOn.Int64)
+		p.BasedOn = &id
+	}
+	return p, nil
+}
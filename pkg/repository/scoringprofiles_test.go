@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/scoring"
+)
+
+func TestScoringProfileRepoDefaultMatchesCode(t *testing.T) {
+	ctx := context.Background()
+	_, repos := newTestRepos(t)
+
+	active, ok, err := repos.Scoring.Active(ctx)
+	if err != nil || !ok {
+		t.Fatalf("Active = %v, %v; want the default profile", ok, err)
+	}
+	if active.Name != "default" || active.Version != 3 {
+		t.Errorf("active profile = %s v%d, want default v3", active.Name, active.Version)
+	}
+	if !reflect.DeepEqual(active.Weights, scoring.Default()) {
+		t.Errorf("stored default weights = %+v, want scoring.Default() %+v", active.Weights, scoring.Default())
+	}
+
+	profiles, err := repos.Scoring.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var activeCount int
+	for _, profile := range profiles {
+		if profile.Active {
+			activeCount++
+		}
+	}
+	if activeCount != 1 {
+		t.Errorf("%d active profiles, want 1", activeCount)
+	}
+}
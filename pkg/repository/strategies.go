@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// StrategyRepo stores the named bet-selection strategies.
+type StrategyRepo struct {
+	db     *sql.DB
+	writer *database.Writer
+}
+
+func NewStrategyRepo(db *sql.DB, writer *database.Writer) *StrategyRepo {
+	return &StrategyRepo{db: db, writer: writer}
+}
+
+// List returns every strategy by name.
+func (r *StrategyRepo) List(ctx context.Context) ([]models.Strategy, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, name, description, rules, created_at, updated_at
+		FROM Strategies
+		ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	strategies := []models.Strategy{}
+	for rows.Next() {
+		s, err := scanStrategy(rows)
+		if err != nil {
+			return nil, err
+		}
+		strategies = append(strategies, s)
+	}
+	return strategies, rows.Err()
+}
+
+// Get returns the strategy called name. ok is false if there is none.
+func (r *StrategyRepo) Get(ctx context.Context, name string) (strategy models.Strategy, ok bool, err error) {
+	strategy, err = scanStrategy(r.db.QueryRowContext(ctx, `
+		SELECT id, name, description, rules, created_at, updated_at
+		FROM Strategies
+		WHERE name = ?`, name))
+	if err == sql.ErrNoRows {
+		return models.Strategy{}, false, nil
+	}
+	return strategy, err == nil, err
+}
+
+// Create stores a new strategy and returns it with its ID.
+func (r *StrategyRepo) Create(ctx context.Context, strategy models.Strategy) (models.Strategy, error) {
+	release, err := r.writer.Acquire(ctx)
+	if err != nil {
+		return models.Strategy{}, err
+	}
+	defer release()
+
+	rules, err := json.Marshal(strategy.Rules)
+	if err != nil {
+		return models.Strategy{}, err
+	}
+	strategy.CreatedAt = time.Now()
+	strategy.UpdatedAt = strategy.CreatedAt
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO Strategies (name, description, rules, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		strategy.Name, strategy.Description, string(rules), strategy.CreatedAt, strategy.UpdatedAt)
+	if err != nil {
+		return models.Strategy{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.Strategy{}, err
+	}
+	strategy.ID = int(id)
+	return strategy, nil
+}
+
+// Update replaces the description and rules of the strategy called name.
+// ok is false if there is none.
+func (r *StrategyRepo) Update(ctx context.Context, name string, strategy models.Strategy) (ok bool, err error) {
+	release, err := r.writer.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	rules, err := json.Marshal(strategy.Rules)
+	if err != nil {
+		return false, err
+	}
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE Strategies SET description = ?, rules = ?, updated_at = ?
+		WHERE name = ?`,
+		strategy.Description, string(rules), time.Now(), name)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Delete removes the strategy called name. ok is false if there is none.
+func (r *StrategyRepo) Delete(ctx context.Context, name string) (ok bool, err error) {
+	release, err := r.writer.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM Strategies WHERE name = ?`, name)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func scanStrategy(row interface{ Scan(...interface{}) error }) (models.Strategy, error) {
+	var s models.Strategy
+	var rules string
+	if err := row.Scan(&s.ID, &s.Name, &s.Description, &rules, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return models.Strategy{}, err
+	}
+	if err := json.Unmarshal([]byte(rules), &s.Rules); err != nil {
+		return models.Strategy{}, err
+	}
+	return s, nil
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// WeightsRepo stores the trained versions of the in-process predictors.
+type WeightsRepo struct {
+	db     *sql.DB
+	writer *database.Writer
+}
+
+func NewWeightsRepo(db *sql.DB, writer *database.Writer) *WeightsRepo {
+	return &WeightsRepo{db: db, writer: writer}
+}
+
+// Save stores weights as the next version of model and returns it.
+func (r *WeightsRepo) Save(ctx context.Context, model string, weights, stats []byte) (models.ModelWeights, error) {
+	release, err := r.writer.Acquire(ctx)
+	if err != nil {
+		return models.ModelWeights{}, err
+	}
+	defer release()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ModelWeights{}, err
+	}
+	defer tx.Rollback()
+
+	saved := models.ModelWeights{Model: model, Weights: weights, Stats: stats, TrainedAt: time.Now()}
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) + 1 FROM ModelWeights WHERE model = ?`, model).
+		Scan(&saved.Version)
+	if err != nil {
+		return models.ModelWeights{}, err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO ModelWeights (model, version, weights, stats, trained_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		saved.Model, saved.Version, string(weights), string(stats), saved.TrainedAt)
+	if err != nil {
+		return models.ModelWeights{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return models.ModelWeights{}, err
+	}
+	saved.ID = int(id)
+
+	return saved, tx.Commit()
+}
+
+// Latest returns the most recent version of model. ok is false if it has
+// never been trained.
+func (r *WeightsRepo) Latest(ctx context.Context, model string) (models.ModelWeights, bool, error) {
+	return r.Version(ctx, model, 0)
+}
+
+// Version returns the given version of model, or the latest when version
+// is 0. ok is false if there is no such version.
+func (r *WeightsRepo) Version(ctx context.Context, model string, version int) (weights models.ModelWeights, ok bool, err error) {
+	var encoded string
+	var stats sql.NullString
+	err = r.db.QueryRowContext(ctx, `
+		SELECT id, model, version, weights, stats, trained_at
+		FROM ModelWeights
+		WHERE model = ? AND (? = 0 OR version = ?)
+		ORDER BY version DESC
+		LIMIT 1`, model, version, version).
+		Scan(&weights.ID, &weights.Model, &weights.Version, &encoded, &stats, &weights.TrainedAt)
+	if err == sql.ErrNoRows {
+		return models.ModelWeights{}, false, nil
+	}
+	if err != nil {
+		return models.ModelWeights{}, false, err
+	}
+
+	weights.Weights = []byte(encoded)
+	if stats.String != "" {
+		weights.Stats = []byte(stats.String)
+	}
+	return weights, true, nil
+}
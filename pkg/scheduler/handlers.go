@@ -0,0 +1,61 @@
+package scheduler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListRuns returns the latest job runs. Optional query parameters: stage and
+// limit (default 50).
+func ListRuns(c *gin.Context) {
+	if current == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "scheduler is not running"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	runs, err := current.Runs(c, c.Query("stage"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"runs": runs})
+}
+
+// TriggerStage starts the stage named in the path on demand. The race date
+// defaults to today and can be overridden with the date query parameter.
+func TriggerStage(c *gin.Context) {
+	if current == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "scheduler is not running"})
+		return
+	}
+
+	stage := c.Param("stage")
+	if _, ok := current.findStage(stage); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown stage " + stage})
+		return
+	}
+
+	day := c.DefaultQuery("date", time.Now().Format("2006-01-02"))
+	if _, err := time.Parse("2006-01-02", day); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date must be YYYY-MM-DD"})
+		return
+	}
+
+	runID, err := current.Trigger(c, stage, day, TriggerManual)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"run_id": runID})
+}
@@ -0,0 +1,346 @@
+// Package scheduler runs the daily ingest pipeline in-process at the times
+// configured in the Configurations table and records every run in JobRuns.
+// Each stage of a day starts only once the stage before it has succeeded
+// for that day.
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/api/analysis"
+	"github.com/mmanjoura/race-picks-backend/pkg/api/preparation"
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+	"github.com/mmanjoura/race-picks-backend/pkg/settlement"
+	"github.com/mmanjoura/race-picks-backend/pkg/strategy"
+	"github.com/mmanjoura/race-picks-backend/pkg/value"
+)
+
+// Run statuses and triggers stored in JobRuns.
+const (
+	StatusRunning     = "running"
+	StatusSucceeded   = "succeeded"
+	StatusFailed      = "failed"
+	StatusInterrupted = "interrupted"
+
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// ConfigPrefix is prepended to a stage name to form the Configurations key
+// holding its daily start time, e.g. SCHEDULE_TodayPredictions = 09:30.
+const ConfigPrefix = "SCHEDULE_"
+
+// retryDelay is how long a stage that failed waits before it is run again.
+const retryDelay = 15 * time.Minute
+
+// Stage is one step of the daily pipeline. day is the race date it works on.
+type Stage struct {
+	Name string
+	Run  func(ctx context.Context, day string) error
+}
+
+// stages lists the pipeline in the order it is meant to run.
+func stages(repos repository.Repositories, prep *preparation.Handler) []Stage {
+	return []Stage{
+		{
+			Name: "GetRacingMarketData",
+			Run: func(ctx context.Context, day string) error {
+				return prep.IngestRacingMarketData(ctx, day, nil)
+			},
+		},
+		{
+			Name: "GetRacingMarketWinners",
+			Run: func(ctx context.Context, day string) error {
+				// The results of the day before are in by the morning
+				date, err := time.Parse("2006-01-02", day)
+				if err != nil {
+					return err
+				}
+				return prep.IngestRacingMarketWinners(ctx, date.AddDate(0, 0, -1).Format("2006-01-02"))
+			},
+		},
+		{
+			Name: "UpdateSelectionsInfo",
+			Run: func(ctx context.Context, day string) error {
+				return prep.UpdateSelectionsProfiles(ctx, day, nil)
+			},
+		},
+		{
+			Name: "TodayPredictions",
+			Run: func(ctx context.Context, day string) error {
+				predictor, err := analysis.NewRegistry(repos).Get(ctx, "", "")
+				if err != nil {
+					return err
+				}
+				_, _, err = analysis.RunTodayPredictions(ctx, repos, predictor, strategy.Default, models.RaceParameters{EventDate: day})
+				return err
+			},
+		},
+		{
+			Name: "SettlePredictions",
+			Run: func(ctx context.Context, day string) error {
+				through, err := time.Parse("2006-01-02", day)
+				if err != nil {
+					return err
+				}
+				_, err = settlement.Settle(ctx, repos, settlement.Options{Through: through, Commission: value.DefaultCommission}, nil)
+				return err
+			},
+		},
+	}
+}
+
+// Scheduler starts each stage once its configured time has passed and the
+// stage before it has succeeded that day.
+type Scheduler struct {
+	db     *sql.DB
+	writer *database.Writer
+	stages []Stage
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+var current *Scheduler
+
+// Start marks runs left unfinished by a previous process as interrupted,
+// creates the scheduler used by the HTTP handlers and checks the schedule
+// once a minute until ctx is cancelled. The stages run through repos and the
+// preparation handler; runs are recorded through writer.
+func Start(ctx context.Context, db *sql.DB, writer *database.Writer, repos repository.Repositories, prep *preparation.Handler) (*Scheduler, error) {
+	s := &Scheduler{db: db, writer: writer, stages: stages(repos, prep), running: make(map[string]bool)}
+	if err := s.interrupt(ctx); err != nil {
+		return nil, err
+	}
+	current = s
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			s.tick(ctx, time.Now())
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return s, nil
+}
+
+// interrupt marks the runs still running as interrupted, so the stages they
+// belong to are run again.
+func (s *Scheduler) interrupt(ctx context.Context) error {
+	return s.writer.Do(ctx, func(ctx context.Context, db *sql.DB) error {
+		_, err := db.ExecContext(ctx, `
+			UPDATE JobRuns SET status = ?, finished_at = ?
+			WHERE status = ?`,
+			StatusInterrupted, time.Now(), StatusRunning)
+		return err
+	})
+}
+
+// tick starts the first stage of the day that has not succeeded yet, if its
+// time has passed. A stage that failed is retried after retryDelay; one that
+// is not scheduled is skipped. The schedule is re-read each time so edits to
+// Configurations apply without a restart.
+func (s *Scheduler) tick(ctx context.Context, now time.Time) {
+	config, err := database.GetConfigs(s.db)
+	if err != nil {
+		log.Println("scheduler: reading configuration:", err)
+		return
+	}
+
+	day := now.Format("2006-01-02")
+	for _, stage := range s.stages {
+		at, ok, err := startTime(config, stage.Name)
+		if err != nil {
+			log.Println("scheduler:", err)
+			return
+		}
+		if !ok {
+			continue
+		}
+
+		status, finishedAt, err := s.lastRun(ctx, stage.Name, day)
+		if err != nil {
+			log.Println("scheduler:", err)
+			return
+		}
+		switch {
+		case status == StatusSucceeded:
+			continue
+		case status == StatusRunning:
+			return
+		case status == StatusFailed && now.Sub(finishedAt) < retryDelay:
+			return
+		case now.Hour()*60+now.Minute() < at.Hour()*60+at.Minute():
+			return
+		}
+
+		if _, err := s.Trigger(ctx, stage.Name, day, TriggerSchedule); err != nil {
+			log.Println("scheduler:", err)
+		}
+		return
+	}
+}
+
+// startTime returns the time of day the stage is configured to start at.
+// ok is false if it is not scheduled.
+func startTime(config map[string]string, stage string) (at time.Time, ok bool, err error) {
+	value := config[ConfigPrefix+stage]
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+	at, err = time.Parse("15:04", value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%s%s = %q is not a time of day (HH:MM)", ConfigPrefix, stage, value)
+	}
+	return at, true, nil
+}
+
+// lastRun returns the status of the latest run of stage for day, however it
+// was triggered, and when it finished. status is "" if it has not run.
+func (s *Scheduler) lastRun(ctx context.Context, stage, day string) (status string, finishedAt time.Time, err error) {
+	var finished sql.NullTime
+	err = s.db.QueryRowContext(ctx, `
+		SELECT status, finished_at
+		FROM JobRuns
+		WHERE stage = ? AND run_date = ?
+		ORDER BY id DESC
+		LIMIT 1`, stage, day).Scan(&status, &finished)
+	if err == sql.ErrNoRows {
+		return "", time.Time{}, nil
+	}
+	return status, finished.Time, err
+}
+
+// Trigger records a new run of the named stage and executes it in the
+// background. It fails if the stage is unknown or already running.
+func (s *Scheduler) Trigger(ctx context.Context, name, day, triggeredBy string) (int64, error) {
+	stage, ok := s.findStage(name)
+	if !ok {
+		return 0, fmt.Errorf("unknown stage %q", name)
+	}
+
+	s.mu.Lock()
+	if s.running[name] {
+		s.mu.Unlock()
+		return 0, fmt.Errorf("stage %q is already running", name)
+	}
+	s.running[name] = true
+	s.mu.Unlock()
+
+	startedAt := time.Now()
+	var runID int64
+	err := s.writer.Do(ctx, func(ctx context.Context, db *sql.DB) error {
+		res, err := db.ExecContext(ctx, `
+			INSERT INTO JobRuns (stage, triggered_by, run_date, status, started_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			name, triggeredBy, day, StatusRunning, startedAt)
+		if err != nil {
+			return err
+		}
+		runID, err = res.LastInsertId()
+		return err
+	})
+	if err != nil {
+		s.release(name)
+		return 0, err
+	}
+
+	go func() {
+		defer s.release(name)
+
+		log.Printf("scheduler: stage %s started (run %d)", name, runID)
+		runErr := stage.Run(context.Background(), day)
+
+		status, message := StatusSucceeded, ""
+		if runErr != nil {
+			status, message = StatusFailed, runErr.Error()
+		}
+
+		finishedAt := time.Now()
+		err := s.writer.Do(context.Background(), func(ctx context.Context, db *sql.DB) error {
+			_, err := db.ExecContext(ctx, `
+				UPDATE JobRuns
+				SET status = ?, finished_at = ?, duration_ms = ?, error = ?
+				WHERE id = ?`,
+				status, finishedAt, finishedAt.Sub(startedAt).Milliseconds(), message, runID)
+			return err
+		})
+		if err != nil {
+			log.Printf("scheduler: recording run %d: %v", runID, err)
+		}
+		log.Printf("scheduler: stage %s %s (run %d)", name, status, runID)
+	}()
+
+	return runID, nil
+}
+
+func (s *Scheduler) release(name string) {
+	s.mu.Lock()
+	delete(s.running, name)
+	s.mu.Unlock()
+}
+
+// Runs returns the most recent runs, optionally restricted to one stage.
+func (s *Scheduler) Runs(ctx context.Context, stage string, limit int) ([]models.JobRun, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, stage, triggered_by, run_date, status, started_at, finished_at, duration_ms, error
+		FROM JobRuns
+		WHERE (? = '' OR stage = ?)
+		ORDER BY id DESC
+		`+database.FormatLimitOffset(limit, 0), stage, stage)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []models.JobRun{}
+	for rows.Next() {
+		var run models.JobRun
+		var finishedAt sql.NullTime
+		var message sql.NullString
+		if err := rows.Scan(
+			&run.ID,
+			&run.Stage,
+			&run.TriggeredBy,
+			&run.RunDate,
+			&run.Status,
+			&run.StartedAt,
+			&finishedAt,
+			&run.DurationMs,
+			&message,
+		); err != nil {
+			return nil, err
+		}
+		if finishedAt.Valid {
+			run.FinishedAt = &finishedAt.Time
+		}
+		run.Error = message.String
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+func (s *Scheduler) findStage(name string) (Stage, bool) {
+	for _, stage := range s.stages {
+		if stage.Name == name {
+			return stage, true
+		}
+	}
+	return Stage{}, false
+}
@@ -0,0 +1,192 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+)
+
+// newTestScheduler returns a scheduler over a migrated in-memory database
+// whose stages, first and second, record the days they were run on. first
+// fails while failFirst is set.
+func newTestScheduler(t *testing.T, schedule map[string]string) (*Scheduler, *sql.DB, *stageCalls) {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := sql.Open("sqlite3", "file:"+name+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if _, err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range schedule {
+		if _, err := db.Exec(`INSERT INTO Configurations (key, value) VALUES (?, ?)`, ConfigPrefix+key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	calls := &stageCalls{}
+	s := &Scheduler{
+		db:     db,
+		writer: database.NewWriter(db),
+		stages: []Stage{
+			{Name: "first", Run: calls.run("first")},
+			{Name: "second", Run: calls.run("second")},
+		},
+		running: make(map[string]bool),
+	}
+	return s, db, calls
+}
+
+type stageCalls struct {
+	mu        sync.Mutex
+	calls     []string
+	failFirst bool
+}
+
+func (c *stageCalls) run(name string) func(ctx context.Context, day string) error {
+	return func(ctx context.Context, day string) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.calls = append(c.calls, name+" "+day)
+		if name == "first" && c.failFirst {
+			return errors.New("no racecards")
+		}
+		return nil
+	}
+}
+
+func (c *stageCalls) get() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.calls...)
+}
+
+// waitForRuns waits until no run is recorded as running.
+func waitForRuns(t *testing.T, db *sql.DB) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var running int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM JobRuns WHERE status = ?`, StatusRunning).Scan(&running); err != nil {
+			t.Fatal(err)
+		}
+		if running == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("runs still running after 5s")
+}
+
+func at(clock string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", "2024-06-01 "+clock, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestTickRunsStagesInOrder(t *testing.T) {
+	ctx := context.Background()
+	s, db, calls := newTestScheduler(t, map[string]string{"first": "06:00", "second": "07:00"})
+
+	tests := []struct {
+		now  string
+		want []string
+	}{
+		{"05:59", nil},
+		// A restart after both times starts only the first stage
+		{"09:00", []string{"first 2024-06-01"}},
+		{"09:01", []string{"first 2024-06-01", "second 2024-06-01"}},
+		{"09:02", []string{"first 2024-06-01", "second 2024-06-01"}},
+	}
+	for _, test := range tests {
+		s.tick(ctx, at(test.now))
+		waitForRuns(t, db)
+		if got := calls.get(); strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Fatalf("after tick at %s calls = %v, want %v", test.now, got, test.want)
+		}
+	}
+}
+
+func TestTickRetriesFailedStage(t *testing.T) {
+	ctx := context.Background()
+	s, db, calls := newTestScheduler(t, map[string]string{"first": "06:00", "second": "06:00"})
+	calls.failFirst = true
+
+	s.tick(ctx, at("06:00"))
+	waitForRuns(t, db)
+
+	// The failure is recorded with the real clock; move it to the test's
+	if _, err := db.Exec(`UPDATE JobRuns SET finished_at = ?`, at("06:00")); err != nil {
+		t.Fatal(err)
+	}
+	s.tick(ctx, at("06:00").Add(retryDelay/2))
+	waitForRuns(t, db)
+	if got := len(calls.get()); got != 1 {
+		t.Fatalf("%d calls before the retry delay, want 1", got)
+	}
+
+	calls.mu.Lock()
+	calls.failFirst = false
+	calls.mu.Unlock()
+	s.tick(ctx, at("06:00").Add(retryDelay+time.Minute))
+	waitForRuns(t, db)
+	got := calls.get()
+	if len(got) != 2 || !strings.HasPrefix(got[1], "first ") {
+		t.Fatalf("calls = %v, want first retried and second still waiting", got)
+	}
+}
+
+func TestTickRejectsBadTimes(t *testing.T) {
+	for _, value := range []string{"9:30am", "25:00", "0930"} {
+		t.Run(value, func(t *testing.T) {
+			s, db, calls := newTestScheduler(t, map[string]string{"first": value, "second": "06:00"})
+
+			s.tick(context.Background(), at("23:00"))
+			waitForRuns(t, db)
+			if got := calls.get(); len(got) != 0 {
+				t.Fatalf("calls = %v, want none with SCHEDULE_first = %q", got, value)
+			}
+		})
+	}
+}
+
+func TestInterruptMarksRunningRuns(t *testing.T) {
+	ctx := context.Background()
+	s, db, calls := newTestScheduler(t, map[string]string{"first": "06:00"})
+
+	if _, err := db.Exec(`
+		INSERT INTO JobRuns (stage, triggered_by, run_date, status, started_at)
+		VALUES ('first', ?, '2024-06-01', ?, ?)`, TriggerSchedule, StatusRunning, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.interrupt(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var status string
+	if err := db.QueryRow(`SELECT status FROM JobRuns`).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status != StatusInterrupted {
+		t.Fatalf("status = %q, want %q", status, StatusInterrupted)
+	}
+
+	s.tick(ctx, at("06:30"))
+	waitForRuns(t, db)
+	if got := calls.get(); len(got) != 1 {
+		t.Fatalf("calls = %v, want the interrupted stage run again", got)
+	}
+}
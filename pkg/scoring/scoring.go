@@ -0,0 +1,74 @@
+// Package scoring holds the weights of the heuristic scorer: the built-in
+// ones and the checks a stored profile has to pass.
+package scoring
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/features"
+	"github.com/mmanjoura/race-picks-backend/pkg/going"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+// Default is the weights ScoreSelection was written with, used when no
+// profile is stored. GoingScore rewards a horse that finishes further up
+// the field on the day's going than it does overall: a quarter of the
+// field better is worth 5 points, about half a placed run. A course or a
+// distance win is worth another half a placed run, a win over both a whole
+// one on top, and the strike rates a placed run for winning every time.
+func Default() models.ScoringWeights {
+	return models.ScoringWeights{
+		FewRuns:                   20,
+		FewRunsBonus:              2,
+		DistanceSplit:             12,
+		ShortDistanceThresholds:   []float64{0.5, 1.0, 1.5},
+		LongDistanceThresholds:    []float64{1.5, 2.0, 3.5},
+		DistanceScores:            []float64{30, 15, 10, 8, 5},
+		NonFinishCodes:            []string{"F", "PU", "U", "R"},
+		NonFinishPenalty:          5,
+		UnreadablePositionPenalty: 1,
+		PositionMultiplier:        10,
+		GoingScore:                20,
+		GoingMinRuns:              going.MinRuns,
+		CourseWinnerScore:         5,
+		DistanceWinnerScore:       5,
+		CourseDistanceWinnerScore: 10,
+		CourseStrikeRateScore:     10,
+		DistanceStrikeRateScore:   10,
+		DistanceTolerance:         features.DefaultDistanceTolerance,
+	}
+}
+
+// Validate reports weights ScoreSelection cannot score with.
+func Validate(w models.ScoringWeights) error {
+	if w.FewRuns < 0 {
+		return fmt.Errorf("scoring: few_runs must not be negative")
+	}
+	if w.DistanceSplit <= 0 {
+		return fmt.Errorf("scoring: distance_split must be positive")
+	}
+	for name, thresholds := range map[string][]float64{
+		"short_distance_thresholds": w.ShortDistanceThresholds,
+		"long_distance_thresholds":  w.LongDistanceThresholds,
+	} {
+		if len(thresholds) > len(w.DistanceScores) {
+			return fmt.Errorf("scoring: %s has more thresholds than distance_scores", name)
+		}
+		if !sort.Float64sAreSorted(thresholds) {
+			return fmt.Errorf("scoring: %s must be in ascending order", name)
+		}
+	}
+	if w.DistanceTolerance < 0 {
+		return fmt.Errorf("scoring: distance_tolerance must not be negative")
+	}
+	if w.GoingMinRuns < 0 {
+		return fmt.Errorf("scoring: going_min_runs must not be negative")
+	}
+	for _, code := range w.NonFinishCodes {
+		if code == "" {
+			return fmt.Errorf("scoring: non_finish_codes must not be empty strings")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+// Package settlement reconciles the stored picks with how their races
+// finished and writes each settled pick to the profit and loss ledger.
+package settlement
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/backtest"
+	"github.com/mmanjoura/race-picks-backend/pkg/features"
+	"github.com/mmanjoura/race-picks-backend/pkg/jobs"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+	"github.com/mmanjoura/race-picks-backend/pkg/staking"
+	"github.com/mmanjoura/race-picks-backend/pkg/value"
+)
+
+// Price sources a pick can be settled at.
+const (
+	PriceBSP = "bsp"
+	PriceSP  = "sp"
+)
+
+// NonRunner is the position of a pick that did not run.
+const NonRunner = "NR"
+
+// Options sets how picks are settled.
+type Options struct {
+	// Through is the last race day settled; zero means today.
+	Through time.Time
+	// Commission is taken off net winnings at BSP.
+	Commission float64
+	// Staking sizes each pick from its strategy's balance, which starts
+	// at Bankroll (backtest.DefaultBankroll if 0) for a new strategy. The
+	// picks of one race are staked together.
+	Staking  staking.Plan
+	Bankroll float64
+}
+
+// Summary reports one settlement run.
+type Summary struct {
+	Through string `json:"through"`
+	Pending int    `json:"pending"`
+	Settled int    `json:"settled"`
+	// Waiting counts picks whose race has no result yet.
+	Waiting int `json:"waiting"`
+}
+
+// Settle settles every pending pick whose race has a result. Picks are
+// settled at BSP when MarketData has it, otherwise at the SP in the form;
+// the winner is taken from MarketData's win_lose, otherwise from the
+// finishing position. A pick with a result but no price, or that did not
+// run, returns its stake.
+// Progress counts races.
+func Settle(ctx context.Context, repos repository.Repositories, opts Options, progress *jobs.Progress) (Summary, error) {
+	if err := opts.Staking.Validate(); err != nil {
+		return Summary{}, err
+	}
+	if opts.Through.IsZero() {
+		opts.Through = time.Now()
+	}
+	if opts.Bankroll <= 0 {
+		opts.Bankroll = backtest.DefaultBankroll
+	}
+
+	summary := Summary{Through: opts.Through.Format("2006-01-02")}
+	picks, err := repos.Ledger.Pending(ctx, summary.Through)
+	if err != nil {
+		return Summary{}, err
+	}
+	summary.Pending = len(picks)
+
+	races := groupRaces(picks)
+	progress.SetTotal(len(races))
+
+	balances := map[string]float64{}
+	markets := map[string]map[string]market{}
+	for _, race := range races {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+
+		date := race[0].EventDate
+		if _, ok := markets[date]; !ok {
+			if markets[date], err = loadMarkets(ctx, repos.MarketData, date); err != nil {
+				return summary, err
+			}
+		}
+
+		entries, err := settleRace(ctx, repos, race, markets[date], balances, opts)
+		if err != nil {
+			return summary, err
+		}
+		if len(entries) == 0 {
+			summary.Waiting += len(race)
+			progress.Done()
+			continue
+		}
+		if err := repos.Ledger.Insert(ctx, entries); err != nil {
+			return summary, err
+		}
+		summary.Settled += len(entries)
+		progress.Done()
+	}
+
+	return summary, nil
+}
+
+// settleRace settles the picks one strategy made in one race, or returns
+// nothing if none of them has a result yet. A pick without a result in a
+// race another pick has one for did not run, and returns its stake.
+func settleRace(ctx context.Context, repos repository.Repositories, race []models.Pick, markets map[string]market, balances map[string]float64, opts Options) ([]models.LedgerEntry, error) {
+	strategy := race[0].Strategy
+	balance, ok := balances[strategy]
+	if !ok {
+		stored, found, err := repos.Ledger.Balance(ctx, strategy)
+		if err != nil {
+			return nil, err
+		}
+		balance = opts.Bankroll
+		if found {
+			balance = stored
+		}
+	}
+
+	entries := make([]models.LedgerEntry, len(race))
+	bets := make([]staking.Bet, len(race))
+	resulted := false
+	for i, pick := range race {
+		run, ran, err := repos.Form.RunOn(ctx, pick.SelectionID, pick.EventDate)
+		if err != nil {
+			return nil, err
+		}
+		m, priced := markets[marketKey(pick.EventTime, pick.SelectionName)]
+		bets[i] = staking.Bet{Probability: pick.WinProbability, Odds: value.DecimalOdds(pick.Odds)}
+
+		entry := models.LedgerEntry{
+			Strategy:      strategy,
+			Model:         pick.Model,
+			ModelVersion:  pick.ModelVersion,
+			EventDate:     pick.EventDate,
+			EventName:     pick.EventName,
+			EventTime:     pick.EventTime,
+			SelectionID:   pick.SelectionID,
+			SelectionName: pick.SelectionName,
+			Position:      run.Position,
+			PriceSource:   PriceSP,
+			Odds:          value.DecimalOdds(run.SPOdds),
+		}
+		if (!ran || run.Position == "") && (!priced || m.winLose == "") {
+			entry.Position = NonRunner
+			entry.Odds = 0
+			entries[i] = entry
+			continue
+		}
+		resulted = true
+
+		if priced && m.winLose != "" {
+			entry.Won = m.winLose == "1"
+		} else {
+			pos, _, finished := features.ParsePosition(run.Position)
+			entry.Won = finished && pos == 1
+		}
+		if priced && m.bsp > 0 {
+			entry.PriceSource = PriceBSP
+			entry.Odds = m.bsp
+		}
+		entries[i] = entry
+	}
+	if !resulted {
+		return nil, nil
+	}
+
+	now := time.Now()
+	for i, stake := range opts.Staking.Race(balance, bets) {
+		entry := &entries[i]
+		entry.Stake = stake
+		switch {
+		case entry.Odds == 0:
+			entry.Return = stake
+		case entry.Won && entry.PriceSource == PriceBSP:
+			entry.Return = stake * (1 + (entry.Odds-1)*(1-opts.Commission))
+		case entry.Won:
+			entry.Return = stake * entry.Odds
+		}
+		entry.Profit = entry.Return - entry.Stake
+		balance += entry.Profit
+		entry.Balance = balance
+		entry.SettledAt = now
+	}
+	balances[strategy] = balance
+
+	return entries, nil
+}
+
+// groupRaces splits picks, which come ordered by race, into the picks of
+// each strategy in each race. A horse picked for a strategy by more than
+// one model is settled once, for the first pick of it.
+func groupRaces(picks []models.Pick) [][]models.Pick {
+	var races [][]models.Pick
+	index := map[string]int{}
+	picked := map[string]bool{}
+	for _, pick := range picks {
+		key := strings.Join([]string{pick.Strategy, pick.EventDate, pick.EventName, pick.EventTime}, "|")
+		selection := key + "|" + strconv.Itoa(pick.SelectionID)
+		if picked[selection] {
+			continue
+		}
+		picked[selection] = true
+
+		i, ok := index[key]
+		if !ok {
+			i = len(races)
+			index[key] = i
+			races = append(races, nil)
+		}
+		races[i] = append(races[i], pick)
+	}
+	return races
+}
+
+// market is a runner's row in the Betfair win market.
+type market struct {
+	bsp     float64
+	winLose string
+}
+
+func loadMarkets(ctx context.Context, markets *repository.MarketDataRepo, date string) (map[string]market, error) {
+	rows, err := markets.ByDate(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+
+	byRunner := map[string]market{}
+	for _, row := range rows {
+		if strings.Contains(row.EventName, "To Be Placed") {
+			continue
+		}
+		// event_dt is DD-MM-YYYY HH:MM
+		fields := strings.Fields(row.EventDT)
+		if len(fields) != 2 {
+			continue
+		}
+		byRunner[marketKey(fields[1], row.SelectionName)] = market{bsp: row.BSP, winLose: strings.TrimSpace(row.WinLose)}
+	}
+	return byRunner, nil
+}
+
+func marketKey(eventTime, name string) string {
+	return eventTime + "|" + value.HorseKey(name)
+}
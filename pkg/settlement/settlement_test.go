@@ -0,0 +1,158 @@
+package settlement
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/database"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+	"github.com/mmanjoura/race-picks-backend/pkg/staking"
+)
+
+// newTestRepos returns the repositories of a migrated in-memory database
+// private to the test.
+func newTestRepos(t *testing.T) (*sql.DB, repository.Repositories) {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := sql.Open("sqlite3", "file:"+name+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db, repository.New(db, database.NewWriter(db))
+}
+
+// saveRun stores a run of model and strategy making picks, best scored
+// first, each at 3/1.
+func saveRun(t *testing.T, repos repository.Repositories, date, model, strategy string, picks ...models.SelectionResult) {
+	t.Helper()
+
+	for i := range picks {
+		picks[i].EventDate = date
+		picks[i].Odds = "3/1"
+		picks[i].TotalScore = float64(len(picks) - i)
+	}
+	run := models.PredictionRun{EventDate: date, Model: model, Strategy: strategy, Parameters: []byte("{}")}
+	if _, err := repos.Predictions.SaveRun(context.Background(), run, picks); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func pick(id int, name, course, eventTime string) models.SelectionResult {
+	return models.SelectionResult{SelectionID: id, SelectionName: name, EventName: course, EventTime: eventTime}
+}
+
+func TestSettle(t *testing.T) {
+	ctx := context.Background()
+	db, repos := newTestRepos(t)
+
+	_, err := db.Exec(`
+		INSERT INTO SelectionsForm (selection_id, selection_name, race_date, position, sp_odds)
+		VALUES
+			(1, 'Alpha', '2024-06-01 00:00:00', '1/6', '3/1'),
+			(2, 'Bravo', '2024-06-01 00:00:00', '2/6', '2/1'),
+			(4, 'Delta', '2024-06-01 00:00:00', '1/5', ''),
+			(6, 'Foxtrot', '2024-06-02 00:00:00', '1/8', 'Evs');
+		INSERT INTO MarketData (event_id, event_name, event_dt, selection_id, selection_name, win_lose, bsp)
+		VALUES (1, 'Ascot 1m', '01-06-2024 16:00', 5, 'Echo', '0', 6.0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveRun(t, repos, "2024-06-01", "heuristic", "default",
+		// Won at SP, lost at SP and did not run
+		pick(1, "Alpha", "Ascot", "14:00"), pick(2, "Bravo", "Ascot", "14:00"), pick(3, "Charlie", "Ascot", "14:00"),
+		// Won with no price
+		pick(4, "Delta", "Ascot", "15:00"),
+		// Lost at BSP
+		pick(5, "Echo", "Ascot", "16:00"))
+	// The same horse for the same strategy from another model is settled once
+	saveRun(t, repos, "2024-06-01", "logit", "default", pick(1, "Alpha", "Ascot", "14:00"))
+	// Another strategy has a balance of its own
+	saveRun(t, repos, "2024-06-01", "heuristic", "longshots", pick(1, "Alpha", "Ascot", "14:00"))
+	saveRun(t, repos, "2024-06-02", "heuristic", "default",
+		pick(6, "Foxtrot", "York", "14:00"),
+		// No result yet
+		pick(7, "Golf", "York", "15:00"))
+
+	opts := Options{Staking: staking.Plan{Kind: staking.Percentage, Percent: 10}, Bankroll: 100}
+
+	opts.Through = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	summary, err := Settle(ctx, repos, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Pending != 7 || summary.Settled != 6 || summary.Waiting != 0 {
+		t.Errorf("first summary = %+v, want 7 pending, 6 settled and none waiting", summary)
+	}
+
+	// Carried over from the default strategy's balance of 108
+	opts.Through = time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)
+	summary, err = Settle(ctx, repos, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Pending != 2 || summary.Settled != 1 || summary.Waiting != 1 {
+		t.Errorf("second summary = %+v, want 2 pending, 1 settled and 1 waiting", summary)
+	}
+
+	entries, err := repos.Ledger.Entries(ctx, "2024-06-01", "2024-06-02", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]models.LedgerEntry{}
+	for _, entry := range entries {
+		got[entry.Strategy+"|"+entry.SelectionName] = entry
+	}
+
+	tests := []struct {
+		key         string
+		won         bool
+		position    string
+		priceSource string
+		odds        float64
+		stake       float64
+		profit      float64
+		balance     float64
+	}{
+		// The three picks of a race are staked from the balance before it
+		{"default|Alpha", true, "1/6", PriceSP, 4, 10, 30, 130},
+		{"default|Bravo", false, "2/6", PriceSP, 3, 10, -10, 120},
+		{"default|Charlie", false, NonRunner, PriceSP, 0, 10, 0, 120},
+		{"default|Delta", true, "1/5", PriceSP, 0, 12, 0, 120},
+		{"default|Echo", false, "", PriceBSP, 6, 12, -12, 108},
+		{"longshots|Alpha", true, "1/6", PriceSP, 4, 10, 30, 130},
+		{"default|Foxtrot", true, "1/8", PriceSP, 2, 10.8, 10.8, 118.8},
+	}
+	if len(entries) != len(tests) {
+		t.Errorf("%d ledger entries, want %d", len(entries), len(tests))
+	}
+	for _, tt := range tests {
+		e, ok := got[tt.key]
+		if !ok {
+			t.Errorf("%s was not settled", tt.key)
+			continue
+		}
+		if e.Won != tt.won || e.Position != tt.position || e.PriceSource != tt.priceSource || e.Odds != tt.odds ||
+			math.Abs(e.Stake-tt.stake) > 1e-9 || math.Abs(e.Profit-tt.profit) > 1e-9 || math.Abs(e.Balance-tt.balance) > 1e-9 {
+			t.Errorf("%s = %+v, want won %v, position %q, %v at %s, stake %v, profit %v, balance %v",
+				tt.key, e, tt.won, tt.position, tt.odds, tt.priceSource, tt.stake, tt.profit, tt.balance)
+		}
+	}
+
+	balance, ok, err := repos.Ledger.Balance(ctx, "longshots")
+	if err != nil || !ok || balance != 130 {
+		t.Errorf("Balance(longshots) = %v, %v, %v; want 130", balance, ok, err)
+	}
+}
@@ -0,0 +1,171 @@
+// Package staking sizes bets from a bankroll under the usual staking
+// plans: level stakes, a percentage of the bank, and full or fractional
+// Kelly, including Kelly across several runners of one race.
+package staking
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Plans.
+const (
+	Level           = "level"
+	Percentage      = "percentage"
+	Kelly           = "kelly"
+	FractionalKelly = "fractional_kelly"
+)
+
+// Plan is a staking plan. Unit is the stake of a level plan, Percent the
+// share of the bank staked by a percentage plan (2 means 2%) and Fraction
+// the share of the Kelly stake a fractional Kelly plan bets. The zero Plan
+// is level stakes of one unit.
+type Plan struct {
+	Kind     string  `json:"plan"`
+	Unit     float64 `json:"unit"`
+	Percent  float64 `json:"percent"`
+	Fraction float64 `json:"fraction"`
+}
+
+// Bet is a win bet at decimal Odds on a runner given Probability of
+// winning. Commission is taken off net winnings.
+type Bet struct {
+	Probability float64 `json:"probability"`
+	Odds        float64 `json:"odds"`
+	Commission  float64 `json:"commission"`
+}
+
+// NetOdds is the decimal price once commission is taken off the winnings.
+func (b Bet) NetOdds() float64 {
+	return 1 + (b.Odds-1)*(1-b.Commission)
+}
+
+// Validate reports a plan that cannot size a bet.
+func (p Plan) Validate() error {
+	switch p.Kind {
+	case "", Level:
+		if p.Unit < 0 {
+			return fmt.Errorf("staking: level unit must not be negative")
+		}
+	case Percentage:
+		if p.Percent <= 0 || p.Percent > 100 {
+			return fmt.Errorf("staking: percent must be in (0, 100]")
+		}
+	case Kelly:
+	case FractionalKelly:
+		if p.Fraction <= 0 || p.Fraction > 1 {
+			return fmt.Errorf("staking: fraction must be in (0, 1]")
+		}
+	default:
+		return fmt.Errorf("staking: unknown plan %q", p.Kind)
+	}
+	return nil
+}
+
+// Stake is what the plan bets on bet from bankroll. Kelly plans bet
+// nothing without an edge; no plan bets more than the bank.
+func (p Plan) Stake(bankroll float64, bet Bet) float64 {
+	return p.Race(bankroll, []Bet{bet})[0]
+}
+
+// Race sizes bets on several runners of the same race from bankroll. Level
+// and percentage plans stake each bet as if it were alone; Kelly plans
+// share the bank out with SimultaneousKelly, as only one runner can win.
+// The stakes never add up to more than the bank.
+func (p Plan) Race(bankroll float64, bets []Bet) []float64 {
+	stakes := make([]float64, len(bets))
+	if bankroll <= 0 {
+		return stakes
+	}
+
+	switch p.Kind {
+	case Percentage:
+		for i := range bets {
+			stakes[i] = bankroll * p.Percent / 100
+		}
+	case Kelly, FractionalKelly:
+		fraction := 1.0
+		if p.Kind == FractionalKelly {
+			fraction = p.Fraction
+		}
+		for i, f := range SimultaneousKelly(bets) {
+			stakes[i] = bankroll * f * fraction
+		}
+	default:
+		unit := p.Unit
+		if unit == 0 {
+			unit = 1
+		}
+		for i := range bets {
+			stakes[i] = unit
+		}
+	}
+
+	var total float64
+	for _, stake := range stakes {
+		total += stake
+	}
+	if total > bankroll {
+		for i := range stakes {
+			stakes[i] *= bankroll / total
+		}
+	}
+	return stakes
+}
+
+// KellyFraction is the share of the bank the Kelly criterion bets on a
+// single bet: the edge over the net odds less one, or 0 without an edge.
+func KellyFraction(bet Bet) float64 {
+	odds := bet.NetOdds()
+	if odds <= 1 {
+		return 0
+	}
+	return math.Max(0, (bet.Probability*odds-1)/(odds-1))
+}
+
+// SimultaneousKelly returns the Kelly share of the bank for each of bets on
+// runners of one race, at most one of which can win. Runners are added in
+// order of expected return while they return more than the bank kept back
+// (Smoczynski and Tomkins); the rest get nothing.
+func SimultaneousKelly(bets []Bet) []float64 {
+	fractions := make([]float64, len(bets))
+
+	order := make([]int, 0, len(bets))
+	for i, bet := range bets {
+		if bet.NetOdds() > 1 && bet.Probability > 0 {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return bets[order[a]].Probability*bets[order[a]].NetOdds() > bets[order[b]].Probability*bets[order[b]].NetOdds()
+	})
+
+	// reserve is the return per unit of the bank not staked
+	reserve := 1.0
+	var probability, implied float64
+	chosen := 0
+	for _, i := range order {
+		bet := bets[i]
+		if bet.Probability*bet.NetOdds() <= reserve {
+			break
+		}
+		// The reserve is only defined while the chosen runners' implied
+		// probabilities add up to less than 1; backing all of them is then
+		// a sure profit if they are the whole field. A runner that would
+		// take the total to 1 or more is left out, which only happens when
+		// the probabilities given add up to more than 1.
+		if implied+1/bet.NetOdds() >= 1 {
+			break
+		}
+		probability += bet.Probability
+		implied += 1 / bet.NetOdds()
+		chosen++
+		reserve = (1 - probability) / (1 - implied)
+	}
+
+	for _, i := range order[:chosen] {
+		fractions[i] = math.Max(0, bets[i].Probability-reserve/bets[i].NetOdds())
+	}
+	return fractions
+}
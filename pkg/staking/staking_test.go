@@ -0,0 +1,187 @@
+package staking
+
+import (
+	"math"
+	"testing"
+)
+
+const tolerance = 1e-9
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < tolerance
+}
+
+func TestKellyFraction(t *testing.T) {
+	tests := []struct {
+		name string
+		bet  Bet
+		want float64
+	}{
+		{"edge", Bet{Probability: 0.5, Odds: 2.2}, 0.1 / 1.2},
+		{"evens at a coin toss", Bet{Probability: 0.5, Odds: 2}, 0},
+		{"no edge", Bet{Probability: 0.2, Odds: 4}, 0},
+		{"commission removes the edge", Bet{Probability: 0.5, Odds: 2.1, Commission: 0.1}, 0},
+		{"commission", Bet{Probability: 0.6, Odds: 2, Commission: 0.05}, (0.6*1.95 - 1) / 0.95},
+		{"odds of 1", Bet{Probability: 0.9, Odds: 1}, 0},
+	}
+	for _, test := range tests {
+		if got := KellyFraction(test.bet); !near(got, test.want) {
+			t.Errorf("%s: KellyFraction = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// The example follows the steps of Smoczynski and Tomkins' algorithm by
+// hand. Expected returns p*o are 1.2, 1.2, 0.8 and 0.5:
+//
+//	add 1: P = 0.4, I = 1/3,  R = 0.6 / (2/3) = 0.9
+//	add 2: P = 0.7, I = 7/12, R = 0.3 / (5/12) = 0.72
+//	add 3: P = 0.9, I = 5/6,  R = 0.1 / (1/6) = 0.6
+//	stop:  0.5 <= 0.6
+//
+// and each chosen runner gets p - R/o.
+func TestSimultaneousKellyWorkedExample(t *testing.T) {
+	bets := []Bet{
+		{Probability: 0.4, Odds: 3},
+		{Probability: 0.3, Odds: 4},
+		{Probability: 0.2, Odds: 4},
+		{Probability: 0.1, Odds: 5},
+	}
+	want := []float64{0.2, 0.15, 0.05, 0}
+
+	got := SimultaneousKelly(bets)
+	for i := range want {
+		if !near(got[i], want[i]) {
+			t.Fatalf("SimultaneousKelly = %v, want %v", got, want)
+		}
+	}
+
+	// At the optimum every backed runner and the bank kept back return the
+	// same marginal growth, and no runner left out returns more
+	reserve := 1.0
+	for _, f := range got {
+		reserve -= f
+	}
+	var marginal float64
+	for i, bet := range bets {
+		wealth := reserve + got[i]*bet.Odds
+		marginal += bet.Probability / wealth
+		if got[i] > 0 && !near(bet.Probability*bet.Odds/wealth, 1) {
+			t.Errorf("runner %d: marginal growth %v, want 1", i, bet.Probability*bet.Odds/wealth)
+		}
+		if got[i] == 0 && bet.Probability*bet.Odds/wealth > 1 {
+			t.Errorf("runner %d left out but returns %v", i, bet.Probability*bet.Odds/wealth)
+		}
+	}
+	if !near(marginal, 1) {
+		t.Errorf("marginal growth of the reserve = %v, want 1", marginal)
+	}
+}
+
+func TestSimultaneousKelly(t *testing.T) {
+	tests := []struct {
+		name string
+		bets []Bet
+		want []float64
+	}{
+		{
+			name: "single bet is plain Kelly",
+			bets: []Bet{{Probability: 0.5, Odds: 2.2}},
+			want: []float64{0.1 / 1.2},
+		},
+		{
+			name: "second runner below the reserve",
+			bets: []Bet{{Probability: 0.5, Odds: 2.2}, {Probability: 0.3, Odds: 3}},
+			want: []float64{0.1 / 1.2, 0},
+		},
+		{
+			name: "order of the bets does not matter",
+			bets: []Bet{{Probability: 0.1, Odds: 5}, {Probability: 0.2, Odds: 4}, {Probability: 0.3, Odds: 4}, {Probability: 0.4, Odds: 3}},
+			want: []float64{0, 0.05, 0.15, 0.2},
+		},
+		{
+			// Backing the whole field at a book under 100% is a sure
+			// profit: the whole bank is staked in proportion to p
+			name: "whole field under the book",
+			bets: []Bet{{Probability: 0.5, Odds: 2.5}, {Probability: 0.5, Odds: 2.5}},
+			want: []float64{0.5, 0.5},
+		},
+		{
+			// 0.7 + 0.6 > 1: adding the second runner would take the
+			// implied total to 1, so it is left out and the first keeps
+			// the reserve it was sized with
+			name: "probabilities adding up to more than 1",
+			bets: []Bet{{Probability: 0.7, Odds: 2}, {Probability: 0.6, Odds: 2}},
+			want: []float64{0.4, 0},
+		},
+		{
+			name: "no edge",
+			bets: []Bet{{Probability: 0.2, Odds: 4}, {Probability: 0.1, Odds: 0}},
+			want: []float64{0, 0},
+		},
+	}
+	for _, test := range tests {
+		got := SimultaneousKelly(test.bets)
+		total := 0.0
+		for i := range test.want {
+			if !near(got[i], test.want[i]) {
+				t.Errorf("%s: SimultaneousKelly = %v, want %v", test.name, got, test.want)
+				break
+			}
+			total += got[i]
+		}
+		if total > 1+tolerance {
+			t.Errorf("%s: stakes add up to %v of the bank", test.name, total)
+		}
+	}
+}
+
+func TestPlanRace(t *testing.T) {
+	bets := []Bet{{Probability: 0.4, Odds: 3}, {Probability: 0.3, Odds: 4}}
+	tests := []struct {
+		name     string
+		plan     Plan
+		bankroll float64
+		want     []float64
+	}{
+		{"zero plan", Plan{}, 100, []float64{1, 1}},
+		{"level", Plan{Kind: Level, Unit: 5}, 100, []float64{5, 5}},
+		{"level capped by the bank", Plan{Kind: Level, Unit: 10}, 10, []float64{5, 5}},
+		{"percentage", Plan{Kind: Percentage, Percent: 2}, 200, []float64{4, 4}},
+		// Two runners: P = 0.7, I = 7/12, R = 0.72
+		{"kelly", Plan{Kind: Kelly}, 100, []float64{100 * (0.4 - 0.24), 100 * (0.3 - 0.18)}},
+		{"half kelly", Plan{Kind: FractionalKelly, Fraction: 0.5}, 100, []float64{50 * (0.4 - 0.24), 50 * (0.3 - 0.18)}},
+		{"empty bank", Plan{Kind: Level, Unit: 5}, 0, []float64{0, 0}},
+	}
+	for _, test := range tests {
+		got := test.plan.Race(test.bankroll, bets)
+		for i := range test.want {
+			if !near(got[i], test.want[i]) {
+				t.Errorf("%s: Race = %v, want %v", test.name, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestPlanValidate(t *testing.T) {
+	tests := []struct {
+		plan Plan
+		ok   bool
+	}{
+		{Plan{}, true},
+		{Plan{Kind: Level, Unit: -1}, false},
+		{Plan{Kind: Percentage, Percent: 2}, true},
+		{Plan{Kind: Percentage}, false},
+		{Plan{Kind: Percentage, Percent: 101}, false},
+		{Plan{Kind: Kelly}, true},
+		{Plan{Kind: FractionalKelly, Fraction: 0.25}, true},
+		{Plan{Kind: FractionalKelly, Fraction: 1.5}, false},
+		{Plan{Kind: "martingale"}, false},
+	}
+	for _, test := range tests {
+		if err := test.plan.Validate(); (err == nil) != test.ok {
+			t.Errorf("%+v: Validate() = %v, want ok %v", test.plan, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Package strategy chooses the bets of a day from the runners a model has
+// scored, by the rules of a named strategy.
+package strategy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/going"
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+	"github.com/mmanjoura/race-picks-backend/pkg/value"
+)
+
+// Default is used when no strategy is named: the top 3 of each race. Its
+// name is reserved, so its runs and ledger entries are told apart from a
+// stored strategy's.
+var Default = models.Strategy{Name: "default", Rules: models.StrategyRules{MaxRank: 3}}
+
+// UnknownStrategyError is returned for a strategy name that is not stored.
+type UnknownStrategyError struct {
+	Name string
+}
+
+func (e *UnknownStrategyError) Error() string {
+	return fmt.Sprintf("unknown strategy %q", e.Name)
+}
+
+// Resolve returns the strategy called name, or Default for an empty name
+// or Default's.
+func Resolve(ctx context.Context, strategies *repository.StrategyRepo, name string) (models.Strategy, error) {
+	if name == "" || name == Default.Name {
+		return Default, nil
+	}
+	s, ok, err := strategies.Get(ctx, name)
+	if err != nil {
+		return models.Strategy{}, err
+	}
+	if !ok {
+		return models.Strategy{}, &UnknownStrategyError{Name: name}
+	}
+	return s, nil
+}
+
+// Validate reports rules that cannot be applied.
+func Validate(rules models.StrategyRules) error {
+	switch {
+	case rules.MinOdds < 0 || rules.MaxOdds < 0:
+		return fmt.Errorf("strategy: odds must not be negative")
+	case rules.MaxOdds > 0 && rules.MinOdds >= rules.MaxOdds:
+		return fmt.Errorf("strategy: min_odds must be below max_odds")
+	case rules.MinWinProbability < 0 || rules.MinWinProbability > 1:
+		return fmt.Errorf("strategy: min_win_probability must be in [0, 1]")
+	case rules.MaxRank < 0 || rules.PicksPerRace < 0:
+		return fmt.Errorf("strategy: max_rank and picks_per_race must not be negative")
+	case rules.MinRunners < 0 || rules.MaxRunners < 0:
+		return fmt.Errorf("strategy: field sizes must not be negative")
+	case rules.MaxRunners > 0 && rules.MinRunners > rules.MaxRunners:
+		return fmt.Errorf("strategy: min_runners must not be above max_runners")
+	}
+	return nil
+}
+
+// Params returns params with the form exclusions of rules, in the comma
+// separated form the models read. Exclusions the rules leave empty keep
+// the ones already in params.
+func Params(rules models.StrategyRules, params models.RaceParameters) models.RaceParameters {
+	if len(rules.ExcludeYears) > 0 {
+		params.Years = joinInts(rules.ExcludeYears)
+	}
+	if len(rules.ExcludePositions) > 0 {
+		params.Positions = joinInts(rules.ExcludePositions)
+	}
+	if len(rules.ExcludeAges) > 0 {
+		params.Ages = joinInts(rules.ExcludeAges)
+	}
+	return params
+}
+
+// Select returns the runners of results that rules bet on, race by race
+// in the order the races first appear and best scored first within a
+// race. runners are the day's declarations, which the race rules are
+// matched against; a race with no declaration fails any race rule.
+func Select(rules models.StrategyRules, results []models.SelectionResult, runners []models.Runner) []models.SelectionResult {
+	declared := map[string]models.Runner{}
+	fields := map[string]int{}
+	for _, runner := range runners {
+		key := raceKey(runner.EventTime, runner.EventName)
+		if _, ok := declared[key]; !ok {
+			declared[key] = runner
+		}
+		fields[key]++
+	}
+
+	var order []string
+	races := map[string][]models.SelectionResult{}
+	for _, result := range results {
+		key := raceKey(result.EventTime, result.EventName)
+		if _, ok := races[key]; !ok {
+			order = append(order, key)
+		}
+		races[key] = append(races[key], result)
+	}
+
+	selected := []models.SelectionResult{}
+	for _, key := range order {
+		runner, ok := declared[key]
+		if !raceMatches(rules, runner, ok, fields[key]) {
+			continue
+		}
+
+		race := races[key]
+		sort.SliceStable(race, func(i, j int) bool {
+			return race[i].TotalScore > race[j].TotalScore
+		})
+
+		picks := 0
+		for i, result := range race {
+			if rules.MaxRank > 0 && i >= rules.MaxRank {
+				break
+			}
+			if rules.PicksPerRace > 0 && picks == rules.PicksPerRace {
+				break
+			}
+			if !runnerMatches(rules, result) {
+				continue
+			}
+			selected = append(selected, result)
+			picks++
+		}
+	}
+	return selected
+}
+
+func raceMatches(rules models.StrategyRules, runner models.Runner, declared bool, declarations int) bool {
+	hasRaceRules := len(rules.RaceCategories) > 0 || len(rules.Classes) > 0 || len(rules.Going) > 0 ||
+		rules.MinRunners > 0 || rules.MaxRunners > 0 || len(rules.ExcludeCourses) > 0
+	if !hasRaceRules {
+		return true
+	}
+	if !declared {
+		return false
+	}
+
+	if len(rules.RaceCategories) > 0 && !oneOf(runner.RaceCategory, rules.RaceCategories) {
+		return false
+	}
+	if len(rules.Classes) > 0 && !oneOf(runner.RaceClass, rules.Classes) {
+		return false
+	}
+	if len(rules.Going) > 0 && !oneOf(runner.TrackCondition, rules.Going) && !oneOf(going.Normalise(runner.TrackCondition), rules.Going) {
+		return false
+	}
+	if oneOf(runner.EventName, rules.ExcludeCourses) {
+		return false
+	}
+
+	size := fieldSize(runner.NumberOfRunners, declarations)
+	if rules.MinRunners > 0 && size < rules.MinRunners {
+		return false
+	}
+	if rules.MaxRunners > 0 && size > rules.MaxRunners {
+		return false
+	}
+	return true
+}
+
+func runnerMatches(rules models.StrategyRules, result models.SelectionResult) bool {
+	if rules.MinOdds > 0 || rules.MaxOdds > 0 {
+		odds := value.DecimalOdds(result.Odds)
+		if odds == 0 || (rules.MinOdds > 0 && odds <= rules.MinOdds) || (rules.MaxOdds > 0 && odds >= rules.MaxOdds) {
+			return false
+		}
+	}
+	if rules.MinScore != nil && result.TotalScore < *rules.MinScore {
+		return false
+	}
+	if result.WinProbability < rules.MinWinProbability {
+		return false
+	}
+	for _, name := range rules.ExcludeSelections {
+		if value.HorseKey(name) == value.HorseKey(result.SelectionName) {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldSize is the number of runners the declaration gives, or the number
+// of runners declared if it gives none.
+func fieldSize(numberOfRunners string, declarations int) int {
+	if fields := strings.Fields(numberOfRunners); len(fields) > 0 {
+		if n, err := strconv.Atoi(fields[0]); err == nil {
+			return n
+		}
+	}
+	return declarations
+}
+
+func oneOf(s string, values []string) bool {
+	s = strings.TrimSpace(s)
+	for _, v := range values {
+		if strings.EqualFold(s, strings.TrimSpace(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func raceKey(eventTime, eventName string) string {
+	return eventTime + "|" + eventName
+}
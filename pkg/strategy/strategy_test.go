@@ -0,0 +1,99 @@
+package strategy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules models.StrategyRules
+		ok    bool
+	}{
+		{"default", Default.Rules, true},
+		{"odds range", models.StrategyRules{MinOdds: 2, MaxOdds: 10}, true},
+		{"no upper odds", models.StrategyRules{MinOdds: 5}, true},
+		{"negative odds", models.StrategyRules{MinOdds: -1}, false},
+		{"empty odds range", models.StrategyRules{MinOdds: 5, MaxOdds: 5}, false},
+		{"probability above 1", models.StrategyRules{MinWinProbability: 1.5}, false},
+		{"negative rank", models.StrategyRules{MaxRank: -1}, false},
+		{"negative picks", models.StrategyRules{PicksPerRace: -1}, false},
+		{"field sizes reversed", models.StrategyRules{MinRunners: 10, MaxRunners: 8}, false},
+		{"only a minimum field", models.StrategyRules{MinRunners: 10}, true},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.rules); (err == nil) != tt.ok {
+			t.Errorf("%s: Validate = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestParams(t *testing.T) {
+	base := models.RaceParameters{Years: "2019", Positions: "12", Ages: "9"}
+	rules := models.StrategyRules{ExcludeYears: []int{2020, 2021}, ExcludeAges: []int{3}}
+
+	got := Params(rules, base)
+	if got.Years != "2020,2021" || got.Positions != "12" || got.Ages != "3" {
+		t.Errorf("Params = years %q, positions %q, ages %q; want 2020,2021, 12 and 3", got.Years, got.Positions, got.Ages)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	runners := []models.Runner{
+		{EventName: "Ascot", EventTime: "13:00", RaceCategory: "Flat", RaceClass: "Class 2", TrackCondition: "Good To Soft (Soft in places)", NumberOfRunners: "8 Runners"},
+		{EventName: "Ascot", EventTime: "13:00"},
+		{EventName: "York", EventTime: "14:00", RaceCategory: "Hurdle", RaceClass: "Class 4", TrackCondition: "Heavy"},
+		{EventName: "York", EventTime: "14:00"},
+		{EventName: "York", EventTime: "14:00"},
+	}
+	results := []models.SelectionResult{
+		{EventName: "Ascot", EventTime: "13:00", SelectionName: "A3", TotalScore: 10, Odds: "10/1", WinProbability: 0.05},
+		{EventName: "Ascot", EventTime: "13:00", SelectionName: "A1", TotalScore: 30, Odds: "2/1", WinProbability: 0.4},
+		{EventName: "Ascot", EventTime: "13:00", SelectionName: "A2 (IRE)", TotalScore: 20, Odds: "4/1F", WinProbability: 0.2},
+		{EventName: "York", EventTime: "14:00", SelectionName: "Y1", TotalScore: 50, Odds: "Evs", WinProbability: 0.5},
+		{EventName: "York", EventTime: "14:00", SelectionName: "Y2", TotalScore: 5, Odds: "", WinProbability: 0.1},
+		// Not declared: fails any race rule
+		{EventName: "Newbury", EventTime: "15:00", SelectionName: "N1", TotalScore: 1, Odds: "3/1", WinProbability: 0.3},
+	}
+	minScore := 15.0
+
+	tests := []struct {
+		name  string
+		rules models.StrategyRules
+		want  []string
+	}{
+		{"no rules", models.StrategyRules{}, []string{"A1", "A2 (IRE)", "A3", "Y1", "Y2", "N1"}},
+		{"default top 3", Default.Rules, []string{"A1", "A2 (IRE)", "A3", "Y1", "Y2", "N1"}},
+		{"top of each race", models.StrategyRules{MaxRank: 1}, []string{"A1", "Y1", "N1"}},
+		{"odds range", models.StrategyRules{MinOdds: 2, MaxOdds: 5.5}, []string{"A1", "A2 (IRE)", "N1"}},
+		{"odds bounds are exclusive", models.StrategyRules{MinOdds: 3, MaxOdds: 5}, []string{"N1"}},
+		{"unreadable prices fail an odds rule", models.StrategyRules{MinOdds: 1}, []string{"A1", "A2 (IRE)", "A3", "Y1", "N1"}},
+		{"minimum score", models.StrategyRules{MinScore: &minScore}, []string{"A1", "A2 (IRE)", "Y1"}},
+		{"minimum probability", models.StrategyRules{MinWinProbability: 0.3}, []string{"A1", "Y1", "N1"}},
+		{"rank is taken before the other rules", models.StrategyRules{MaxRank: 1, MinWinProbability: 0.45}, []string{"Y1"}},
+		{"picks are taken after the other rules", models.StrategyRules{PicksPerRace: 1, MinOdds: 3.5}, []string{"A2 (IRE)", "N1"}},
+		{"race category", models.StrategyRules{RaceCategories: []string{"flat"}}, []string{"A1", "A2 (IRE)", "A3"}},
+		{"class", models.StrategyRules{Classes: []string{"Class 4"}}, []string{"Y1", "Y2"}},
+		{"going band", models.StrategyRules{Going: []string{"Good to Soft"}}, []string{"A1", "A2 (IRE)", "A3"}},
+		{"declared going", models.StrategyRules{Going: []string{"heavy"}}, []string{"Y1", "Y2"}},
+		{"declared field size", models.StrategyRules{MinRunners: 5}, []string{"A1", "A2 (IRE)", "A3"}},
+		{"counted field size", models.StrategyRules{MaxRunners: 3}, []string{"Y1", "Y2"}},
+		{"excluded course", models.StrategyRules{ExcludeCourses: []string{"York"}}, []string{"A1", "A2 (IRE)", "A3"}},
+		{"excluded horse", models.StrategyRules{ExcludeSelections: []string{"a2", "Y1 (GB)"}}, []string{"A1", "A3", "Y2", "N1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := append([]models.SelectionResult(nil), results...)
+			got := []string{}
+			for _, result := range Select(tt.rules, input, runners) {
+				got = append(got, result.SelectionName)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Select = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package value
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/repository"
+)
+
+var favouriteMark = regexp.MustCompile(`[FJC]+$`)
+
+// DecimalOdds converts a fractional price ("11/4", "5/2F", "Evs") to
+// decimal odds. It returns 0 when the price cannot be read.
+func DecimalOdds(price string) float64 {
+	price = favouriteMark.ReplaceAllString(strings.TrimSpace(price), "")
+	if strings.EqualFold(price, "evs") || strings.EqualFold(price, "evens") {
+		return 2
+	}
+	parts := strings.Split(price, "/")
+	if len(parts) != 2 {
+		return 0
+	}
+	num, err1 := strconv.ParseFloat(parts[0], 64)
+	den, err2 := strconv.ParseFloat(parts[1], 64)
+	if err1 != nil || err2 != nil || den == 0 {
+		return 0
+	}
+	return num/den + 1
+}
+
+var countrySuffix = regexp.MustCompile(`\s*\([A-Z]{2,3}\)$`)
+
+// HorseKey normalises a horse name so the sportinglife and Betfair spellings
+// of it match.
+func HorseKey(name string) string {
+	name = countrySuffix.ReplaceAllString(strings.TrimSpace(name), "")
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// BSPPrices holds the win market Betfair SP of each runner of a day, by
+// race time and horse.
+type BSPPrices map[string]float64
+
+// LoadBSP reads the win market BSPs of date from MarketData.
+func LoadBSP(ctx context.Context, markets *repository.MarketDataRepo, date string) (BSPPrices, error) {
+	rows, err := markets.ByDate(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := BSPPrices{}
+	for _, market := range rows {
+		if strings.Contains(market.EventName, "To Be Placed") || market.BSP <= 0 {
+			continue
+		}
+		// event_dt is DD-MM-YYYY HH:MM
+		fields := strings.Fields(market.EventDT)
+		if len(fields) != 2 {
+			continue
+		}
+		prices[bspKey(fields[1], market.SelectionName)] = market.BSP
+	}
+	return prices, nil
+}
+
+// Get returns the BSP of the horse in the race at eventTime, or 0 if the
+// market has none.
+func (p BSPPrices) Get(eventTime, name string) float64 {
+	return p[bspKey(eventTime, name)]
+}
+
+func bspKey(eventTime, name string) string {
+	return eventTime + "|" + HorseKey(name)
+}
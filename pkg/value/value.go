@@ -0,0 +1,167 @@
+// Package value compares a model's win probabilities with the prices on
+// offer and flags the selections priced longer than they should be.
+package value
+
+import (
+	"math"
+	"sort"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/staking"
+)
+
+// DefaultCommission is the exchange commission assumed when none is given.
+const DefaultCommission = 0.05
+
+// Options sets what counts as a value bet.
+type Options struct {
+	// MinEdge is the smallest edge, in percentage points of win
+	// probability, a selection needs to be flagged.
+	MinEdge float64
+	// Commission is the exchange's cut of net winnings, taken off BSP
+	// returns. Bookmaker prices pay no commission.
+	Commission float64
+}
+
+// Quote assesses one price. Edge is the model's probability less the
+// probability the price breaks even at after commission, in percentage
+// points; ExpectedValue is the return per unit staked. Confidence is the
+// chance the edge is real if the probability were a win rate measured over
+// the horse's runs.
+type Quote struct {
+	Odds          float64 `json:"odds"`
+	Breakeven     float64 `json:"breakeven_probability"`
+	Edge          float64 `json:"edge_percent"`
+	ExpectedValue float64 `json:"expected_value"`
+	Confidence    float64 `json:"confidence"`
+	Value         bool    `json:"value"`
+}
+
+// Assessment is a selection with its price and, once the race is off, its
+// BSP assessed against its win probability.
+type Assessment struct {
+	models.SelectionResult
+	Price *Quote `json:"price,omitempty"`
+	BSP   *Quote `json:"bsp,omitempty"`
+	Value bool   `json:"value"`
+	// Stake is set by Stake
+	Stake float64 `json:"stake,omitempty"`
+}
+
+// Assess compares each result's win probability with its price, read from
+// Odds, and its BSP in bsp, which may be nil before the off. Results
+// without a probability or a readable price are assessed as no value.
+func Assess(results []models.SelectionResult, bsp BSPPrices, opts Options) []Assessment {
+	assessments := make([]Assessment, len(results))
+	for i, result := range results {
+		a := Assessment{SelectionResult: result}
+		if odds := DecimalOdds(result.Odds); odds > 1 {
+			a.Price = quote(result.WinProbability, odds, 0, result.RunCount, opts.MinEdge)
+		}
+		if odds := bsp.Get(result.EventTime, result.SelectionName); odds > 1 {
+			a.BSP = quote(result.WinProbability, odds, opts.Commission, result.RunCount, opts.MinEdge)
+		}
+		a.Value = (a.Price != nil && a.Price.Value) || (a.BSP != nil && a.BSP.Value)
+		assessments[i] = a
+	}
+	return assessments
+}
+
+// Stake sizes bets on the value selections of each race from bankroll
+// under plan, together, so Kelly plans share the race out. Bets are struck
+// at the price, or at BSP after commission when there is no price.
+func Stake(assessments []Assessment, bankroll float64, plan staking.Plan, opts Options) {
+	races := map[string][]int{}
+	var keys []string
+	for i, a := range assessments {
+		if !a.Value {
+			continue
+		}
+		key := a.EventName + "|" + a.EventTime
+		if _, ok := races[key]; !ok {
+			keys = append(keys, key)
+		}
+		races[key] = append(races[key], i)
+	}
+
+	for _, key := range keys {
+		bets := make([]staking.Bet, len(races[key]))
+		for j, i := range races[key] {
+			a := assessments[i]
+			bets[j] = staking.Bet{Probability: a.WinProbability}
+			if a.Price != nil && a.Price.Value {
+				bets[j].Odds = a.Price.Odds
+			} else {
+				bets[j].Odds = a.BSP.Odds
+				bets[j].Commission = opts.Commission
+			}
+		}
+		for j, stake := range plan.Race(bankroll, bets) {
+			assessments[races[key][j]].Stake = stake
+		}
+	}
+}
+
+// Best returns the value selection with the highest expected value in each
+// race, in race time order. A selection's best expected value across its
+// price and BSP is used.
+func Best(assessments []Assessment) []Assessment {
+	best := map[string]Assessment{}
+	for _, a := range assessments {
+		if !a.Value {
+			continue
+		}
+		key := a.EventName + "|" + a.EventTime
+		if current, ok := best[key]; !ok || a.expectedValue() > current.expectedValue() {
+			best[key] = a
+		}
+	}
+
+	bets := make([]Assessment, 0, len(best))
+	for _, a := range best {
+		bets = append(bets, a)
+	}
+	sort.Slice(bets, func(i, j int) bool {
+		if bets[i].EventTime != bets[j].EventTime {
+			return bets[i].EventTime < bets[j].EventTime
+		}
+		return bets[i].EventName < bets[j].EventName
+	})
+	return bets
+}
+
+func (a Assessment) expectedValue() float64 {
+	ev := math.Inf(-1)
+	if a.Price != nil && a.Price.Value {
+		ev = a.Price.ExpectedValue
+	}
+	if a.BSP != nil && a.BSP.Value {
+		ev = math.Max(ev, a.BSP.ExpectedValue)
+	}
+	return ev
+}
+
+func quote(probability, odds, commission float64, runs int, minEdge float64) *Quote {
+	// Decimal odds once commission is taken off the winnings
+	net := 1 + (odds-1)*(1-commission)
+
+	q := &Quote{Odds: odds, Breakeven: 1 / net}
+	q.Edge = (probability - q.Breakeven) * 100
+	q.ExpectedValue = probability*net - 1
+	q.Confidence = confidence(probability, q.Breakeven, runs)
+	q.Value = probability > 0 && q.Edge > minEdge
+	return q
+}
+
+// confidence is the normal approximation of the chance that a win rate of
+// probability over runs races comes from a true rate above breakeven.
+func confidence(probability, breakeven float64, runs int) float64 {
+	if probability <= 0 || probability >= 1 {
+		if probability > breakeven {
+			return 1
+		}
+		return 0
+	}
+	se := math.Sqrt(probability * (1 - probability) / float64(runs+1))
+	return 0.5 * math.Erfc(-(probability-breakeven)/(se*math.Sqrt2))
+}
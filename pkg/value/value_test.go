@@ -0,0 +1,176 @@
+package value
+
+import (
+	"math"
+	"testing"
+
+	"github.com/mmanjoura/race-picks-backend/pkg/models"
+	"github.com/mmanjoura/race-picks-backend/pkg/staking"
+)
+
+func TestDecimalOdds(t *testing.T) {
+	tests := []struct {
+		price string
+		want  float64
+	}{
+		{"11/4", 3.75},
+		{"5/2F", 3.5},
+		{"2/1JF", 3},
+		{"6/4C", 2.5},
+		{" 1/2 ", 1.5},
+		{"100/30", 100.0/30 + 1},
+		{"Evs", 2},
+		{"evens", 2},
+		{"EvsF", 2},
+		{"", 0},
+		{"SP", 0},
+		{"5/0", 0},
+		{"5-2", 0},
+		{"1/2/3", 0},
+		{"a/b", 0},
+	}
+	for _, tt := range tests {
+		if got := DecimalOdds(tt.price); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("DecimalOdds(%q) = %v, want %v", tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestHorseKey(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"Frankel", "frankel"},
+		{"Frankel (GB)", "frankel"},
+		{"  Sea  The Stars (IRE) ", "sea the stars"},
+		{"Enable (USA)", "enable"},
+		{"Not A Country (Gb)", "not a country (gb)"},
+	}
+	for _, tt := range tests {
+		if got := HorseKey(tt.name); got != tt.want {
+			t.Errorf("HorseKey(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAssess(t *testing.T) {
+	bsp := BSPPrices{bspKey("14:00", "Frankel"): 5}
+
+	tests := []struct {
+		name      string
+		result    models.SelectionResult
+		opts      Options
+		price     *Quote
+		bsp       *Quote
+		wantValue bool
+	}{
+		{
+			name:      "priced longer than its chance",
+			result:    models.SelectionResult{EventTime: "13:00", SelectionName: "Enable", Odds: "3/1", WinProbability: 0.3},
+			price:     &Quote{Odds: 4, Breakeven: 0.25, Edge: 5, ExpectedValue: 0.2, Value: true},
+			wantValue: true,
+		},
+		{
+			name:   "edge below the minimum",
+			result: models.SelectionResult{EventTime: "13:00", SelectionName: "Enable", Odds: "3/1", WinProbability: 0.3},
+			opts:   Options{MinEdge: 6},
+			price:  &Quote{Odds: 4, Breakeven: 0.25, Edge: 5, ExpectedValue: 0.2},
+		},
+		{
+			name:   "priced shorter than its chance",
+			result: models.SelectionResult{EventTime: "13:00", SelectionName: "Enable", Odds: "Evs", WinProbability: 0.4},
+			price:  &Quote{Odds: 2, Breakeven: 0.5, Edge: -10, ExpectedValue: -0.2},
+		},
+		{
+			// 5.0 less 5% of the winnings is 4.8, breaking even at 1/4.8
+			name:      "BSP pays commission",
+			result:    models.SelectionResult{EventTime: "14:00", SelectionName: "Frankel (GB)", Odds: "SP", WinProbability: 0.25},
+			opts:      Options{Commission: 0.05},
+			bsp:       &Quote{Odds: 5, Breakeven: 1 / 4.8, Edge: (0.25 - 1/4.8) * 100, ExpectedValue: 0.25*4.8 - 1, Value: true},
+			wantValue: true,
+		},
+		{
+			name:   "no probability is no value",
+			result: models.SelectionResult{EventTime: "13:00", SelectionName: "Enable", Odds: "20/1"},
+			price:  &Quote{Odds: 21, Breakeven: 1.0 / 21, Edge: -100.0 / 21, ExpectedValue: -1},
+		},
+		{
+			name:   "unreadable price",
+			result: models.SelectionResult{EventTime: "13:00", SelectionName: "Enable", Odds: "", WinProbability: 0.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := Assess([]models.SelectionResult{tt.result}, bsp, tt.opts)[0]
+			if a.Value != tt.wantValue {
+				t.Errorf("Value = %v, want %v", a.Value, tt.wantValue)
+			}
+			checkQuote(t, "price", a.Price, tt.price)
+			checkQuote(t, "BSP", a.BSP, tt.bsp)
+		})
+	}
+}
+
+func checkQuote(t *testing.T, name string, got, want *Quote) {
+	t.Helper()
+	if (got == nil) != (want == nil) {
+		t.Errorf("%s quote = %+v, want %+v", name, got, want)
+		return
+	}
+	if got == nil {
+		return
+	}
+	if got.Odds != want.Odds || got.Value != want.Value ||
+		math.Abs(got.Breakeven-want.Breakeven) > 1e-12 ||
+		math.Abs(got.Edge-want.Edge) > 1e-9 ||
+		math.Abs(got.ExpectedValue-want.ExpectedValue) > 1e-12 {
+		t.Errorf("%s quote = %+v, want %+v", name, got, want)
+	}
+}
+
+func TestConfidence(t *testing.T) {
+	tests := []struct {
+		name                   string
+		probability, breakeven float64
+		runs                   int
+		want                   float64
+	}{
+		{"at breakeven is a coin toss", 0.25, 0.25, 10, 0.5},
+		{"certain winner above breakeven", 1, 0.5, 3, 1},
+		{"no chance", 0, 0.5, 3, 0},
+		// One standard error above breakeven: 0.2 over 24 runs and one
+		// has an error of sqrt(0.2*0.8/25) = 0.08
+		{"one standard error above", 0.2, 0.12, 24, 0.5 * math.Erfc(-1/math.Sqrt2)},
+	}
+	for _, tt := range tests {
+		if got := confidence(tt.probability, tt.breakeven, tt.runs); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("%s: confidence = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBestAndStake(t *testing.T) {
+	results := []models.SelectionResult{
+		{EventName: "Ascot", EventTime: "14:00", SelectionName: "A", Odds: "3/1", WinProbability: 0.3},
+		{EventName: "Ascot", EventTime: "14:00", SelectionName: "B", Odds: "4/1", WinProbability: 0.3},
+		{EventName: "Ascot", EventTime: "13:00", SelectionName: "C", Odds: "1/1", WinProbability: 0.6},
+		{EventName: "Ascot", EventTime: "13:00", SelectionName: "D", Odds: "1/2", WinProbability: 0.5},
+	}
+	assessments := Assess(results, nil, Options{})
+
+	best := Best(assessments)
+	if len(best) != 2 || best[0].SelectionName != "C" || best[1].SelectionName != "B" {
+		t.Fatalf("Best = %+v, want C at 13:00 then B at 14:00", best)
+	}
+
+	Stake(assessments, 100, staking.Plan{Kind: staking.Level, Unit: 2}, Options{})
+	for _, a := range assessments {
+		want := 0.0
+		if a.Value {
+			want = 2
+		}
+		if a.Stake != want {
+			t.Errorf("%s staked %v, want %v", a.SelectionName, a.Stake, want)
+		}
+	}
+}